@@ -0,0 +1,70 @@
+package mobster
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// protect room with password, empty password removes protection
+func (o *Ops) SetRoomPassword(room, password string) {
+	if password == "" {
+		delete(o.server.roomPasswords, room)
+		return
+	}
+	o.server.roomPasswords[room] = password
+}
+
+// create single use token letting its holder into protected room
+func (o *Ops) CreateInvite(room string) string {
+	var token [16]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		panic(err)
+	}
+	invite := hex.EncodeToString(token[:])
+	o.server.invites[invite] = room
+	return invite
+}
+
+// removes unused invite
+func (o *Ops) RevokeInvite(invite string) {
+	delete(o.server.invites, invite)
+}
+
+// default secret is optional fourth token of "a <username> <room> <secret>" auth packet
+func authSecret(message string) string {
+	tokens := strings.Split(message, " ")
+	if len(tokens) != 4 {
+		return ""
+	}
+	return tokens[3]
+}
+
+// checks room password or invite of joining client, invite is used up,
+// must be called from processingLoop only
+func (s *Server) canJoin(c *Client) bool {
+	password, protected := s.roomPasswords[c.room]
+	if !protected {
+		return true
+	}
+	if c.secret == "" {
+		return false
+	}
+	if room, ok := s.invites[c.secret]; ok && room == c.room {
+		delete(s.invites, c.secret)
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(c.secret), []byte(password)) == 1
+}
+
+// rejects client that is not allowed into its room, must be called from processingLoop only
+func (s *Server) denyJoin(c *Client) {
+	s.auditf(c.room, c.user, "denied", "%s: %s denied", c.room, c.user)
+	if s.JoinDeniedMessage != "" {
+		s.write(c, s.JoinDeniedMessage)
+	}
+	s.sendClose(c.conn, c.codec, CloseJoinDenied)
+	c.conn.Close()
+	s.OnJoinDenied(&Ops{s}, c.user, c.room)
+}
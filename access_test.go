@@ -0,0 +1,42 @@
+package mobster
+
+import "testing"
+
+func TestFlow_roomPassword(t *testing.T) {
+	var joined, denied []string
+	var invite string
+	s := NewServer()
+	s.JoinDeniedMessage = "denied"
+	s.OnConnect = func(ops *Ops, name, room string) {
+		joined = append(joined, name)
+		if name == "owner" {
+			ops.SetRoomPassword("123", "secret")
+			invite = ops.CreateInvite("123")
+		}
+	}
+	s.OnJoinDenied = func(ops *Ops, name, room string) {
+		denied = append(denied, name)
+	}
+	s.StartServer(4009)
+
+	connectAndSend(t, "a owner 123")
+	connectAndSend(t, "a friend 123 secret")
+	c := connectAndSend(t, "a stranger 123")
+	connectAndSend(t, "a stranger2 123 wrong")
+	connectAndSend(t, "a guest 123 "+invite)
+	connectAndSend(t, "a guest2 123 "+invite)
+	connectAndSend(t, "a other 456")
+
+	if r := readFromServer(t, c); r != "denied" {
+		t.Errorf("expected denied packet, got %q", r)
+	}
+
+	s.StopServer()
+
+	if len(joined) != 4 || joined[1] != "friend" || joined[2] != "guest" || joined[3] != "other" {
+		t.Errorf("unexpected clients joined: %v", joined)
+	}
+	if len(denied) != 3 || denied[2] != "guest2" {
+		t.Errorf("unexpected clients denied: %v", denied)
+	}
+}
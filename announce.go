@@ -0,0 +1,56 @@
+package mobster
+
+import (
+	"errors"
+	"slices"
+)
+
+// ErrNoOperator is returned by Announce called without AnnounceOptions.Operator
+var ErrNoOperator = errors.New("announcement needs operator")
+
+type AnnounceOptions struct {
+	// who makes the announcement, e.g. admin login, recorded in audit trail
+	Operator string
+	// rooms which do not get the announcement
+	Exclude []string
+}
+
+// default FormatAnnouncement, "announce <message>"
+func formatAnnouncement(message string) string {
+	return "announce " + message
+}
+
+// Announce delivers system announcement formatted with FormatAnnouncement to every room,
+// except excluded ones, and records it in audit trail with its operator; returns number
+// of connections here which got it, rooms of other instances are reached by backplane.
+// Must not be called from handlers, use Ops.Announce instead.
+func (s *Server) Announce(message string, opts AnnounceOptions) (int, error) {
+	if opts.Operator == "" {
+		return 0, ErrNoOperator
+	}
+	n, err := safeCall(s.Ops(), func(ops *Ops) int {
+		n, _ := ops.Announce(message, opts)
+		return n
+	})
+	return n, err
+}
+
+// like Server.Announce, for handlers
+func (o *Ops) Announce(message string, opts AnnounceOptions) (int, error) {
+	if opts.Operator == "" {
+		return 0, ErrNoOperator
+	}
+	s := o.server
+	announcement := s.FormatAnnouncement(message)
+	rooms, recipients := 0, 0
+	for _, room := range s.clientHolder.GetRooms() {
+		if slices.Contains(opts.Exclude, room) {
+			continue
+		}
+		rooms++
+		recipients += s.clientHolder.GetRoomCount(room)
+		s.writeToRoom(room, announcement)
+	}
+	s.auditf("", opts.Operator, "announce", "announcement by %s to %d rooms, %d recipients: %s", opts.Operator, rooms, recipients, message)
+	return recipients, nil
+}
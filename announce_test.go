@@ -0,0 +1,55 @@
+package mobster
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFlow_announce(t *testing.T) {
+	sink := &recordingSink{}
+	s := NewServer()
+	s.AuditSink = sink
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.StartServer(4009)
+	foo := connectAndSend(t, "a foo lobby")
+	bar := connectAndSend(t, "s bar lobby")
+	baz := connectAndSend(t, "a baz match")
+	qux := connectAndSend(t, "a qux private")
+
+	n, err := s.Announce("restart in 5 minutes", AnnounceOptions{Operator: "admin", Exclude: []string{"private"}})
+	if err != nil || n != 3 {
+		t.Errorf("expected 3 recipients, got %d, %v", n, err)
+	}
+	for _, c := range []net.Conn{foo, bar, baz} {
+		if msg := readFromServer(t, c); msg != "announce restart in 5 minutes" {
+			t.Errorf("unexpected announcement %q", msg)
+		}
+	}
+	qux.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if n, _ := qux.Read(make([]byte, 64)); n != 0 {
+		t.Error("excluded room should not get announcement")
+	}
+	s.StopServer()
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	var audited *AuditEvent
+	for i, e := range sink.events {
+		if e.Action == "announce" {
+			audited = &sink.events[i]
+		}
+	}
+	if audited == nil || audited.User != "admin" || audited.Detail != "announcement by admin to 2 rooms, 3 recipients: restart in 5 minutes" {
+		t.Errorf("announcement should be audited with operator, got %+v", audited)
+	}
+}
+
+func TestAnnounce_needsOperator(t *testing.T) {
+	s := NewServer()
+	if _, err := s.Announce("hi", AnnounceOptions{}); !errors.Is(err, ErrNoOperator) {
+		t.Errorf("expected ErrNoOperator, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package mobster
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// passed to Ask callback when client does not reply in time
+var ErrAskTimeout = errors.New("no reply in time")
+
+// called from processing loop with reply of client or error
+type ReplyHandler func(ops *Ops, reply string, err error)
+
+type pendingAsk struct {
+	user    string
+	handler ReplyHandler
+	timer   *time.Timer
+}
+
+// default request is "ask <id> <request>"
+func formatAsk(id uint64, request string) string {
+	return "ask " + strconv.FormatUint(id, 10) + " " + request
+}
+
+// default reply is "reply <id> <reply>"
+func parseReply(message string) (id uint64, reply string, ok bool) {
+	rest, found := strings.CutPrefix(message, "reply ")
+	if !found {
+		return 0, "", false
+	}
+	idText, reply, _ := strings.Cut(rest, " ")
+	id, err := strconv.ParseUint(idText, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return id, reply, true
+}
+
+// send request to user and pass its correlated reply to handler, or ErrAskTimeout
+// when there is none in time, or ErrNotConnected when user is gone; reply does not
+// reach OnMessage. Handlers cannot block waiting for replies, hence the callback.
+func (o *Ops) Ask(user, request string, timeout time.Duration, handler ReplyHandler) {
+	s := o.server
+	c := s.clientHolder.GetByName(user)
+	if c == nil {
+		handler(o, "", ErrNotConnected)
+		return
+	}
+	s.lastAskID++
+	id := s.lastAskID
+	if err := s.write(c, s.FormatAsk(id, request)); err != nil {
+		handler(o, "", err)
+		return
+	}
+	timer := time.AfterFunc(timeout, func() {
+		select {
+		case s.askTimeouts <- id:
+		case <-s.stopping:
+		}
+	})
+	s.asks[id] = &pendingAsk{user: user, handler: handler, timer: timer}
+}
+
+// passes reply to waiting handler, tells if message was a reply,
+// must be called from processingLoop only
+func (s *Server) handleReply(ops *Ops, user, message string) bool {
+	if len(s.asks) == 0 {
+		return false
+	}
+	id, reply, ok := s.ParseReply(message)
+	if !ok {
+		return false
+	}
+	// replies to someone else's request are not intercepted
+	p := s.asks[id]
+	if p == nil || p.user != user {
+		return false
+	}
+	delete(s.asks, id)
+	p.timer.Stop()
+	p.handler(ops, reply, nil)
+	return true
+}
+
+// must be called from processingLoop only
+func (s *Server) expireAsk(id uint64) {
+	if p := s.asks[id]; p != nil {
+		delete(s.asks, id)
+		p.handler(&Ops{s}, "", ErrAskTimeout)
+	}
+}
+
+// fails requests waiting for reply of user which is gone,
+// must be called from processingLoop only
+func (s *Server) forgetAsks(user string) {
+	for id, p := range s.asks {
+		if p.user == user {
+			delete(s.asks, id)
+			p.timer.Stop()
+			p.handler(&Ops{s}, "", ErrNotConnected)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAsk(t *testing.T) {
+	replies := make(chan string, 10)
+	var messages []string
+	s := NewServer()
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		if message == "play" {
+			ops.Ask(user, "your move?", time.Second, func(ops *Ops, reply string, err error) {
+				replies <- reply
+			})
+			ops.Ask(user, "still there?", 10*time.Millisecond, func(ops *Ops, reply string, err error) {
+				if err == ErrAskTimeout {
+					replies <- "timeout"
+				}
+			})
+			return
+		}
+		messages = append(messages, message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	send(t, c, "play")
+	if msg := readFromServer(t, c); msg != "ask 1 your move?ask 2 still there?" && msg != "ask 1 your move?" {
+		t.Errorf("unexpected request %q", msg)
+	}
+	send(t, c, "reply 1 e4")
+	send(t, c, "reply 7 unknown")
+
+	for _, expected := range []string{"e4", "timeout"} {
+		select {
+		case reply := <-replies:
+			if reply != expected {
+				t.Errorf("expected %q, got %q", expected, reply)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no reply passed to handler")
+		}
+	}
+	s.StopServer()
+
+	if len(messages) != 1 || messages[0] != "reply 7 unknown" {
+		t.Errorf("only uncorrelated replies should reach OnMessage, got %v", messages)
+	}
+}
+
+func TestAsk_disconnected(t *testing.T) {
+	s := NewServer()
+	ops := &Ops{s}
+	c := NewClient("foo", "123", &fakeConn{})
+	s.clientHolder.Add(c)
+
+	var errs []error
+	ops.Ask("foo", "ready?", time.Minute, func(ops *Ops, reply string, err error) {
+		errs = append(errs, err)
+	})
+	s.removeClient(c)
+	ops.Ask("foo", "ready?", time.Minute, func(ops *Ops, reply string, err error) {
+		errs = append(errs, err)
+	})
+
+	if len(errs) != 2 || errs[0] != ErrNotConnected || errs[1] != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected twice, got %v", errs)
+	}
+}
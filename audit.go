@@ -0,0 +1,33 @@
+package mobster
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// what happened to whom, logged as [audit] line and passed to AuditSink
+type AuditEvent struct {
+	Time time.Time
+	Room string
+	User string
+	// short machine readable kind, e.g. "join", "message", "mute" or "ban"
+	Action string
+	// same text as in log line
+	Detail string
+}
+
+// receives audit events, e.g. to store them in database; called from processing loop,
+// so it must not block
+type AuditSink interface {
+	Audit(e AuditEvent)
+}
+
+// logs audit line and passes it to AuditSink
+func (s *Server) auditf(room, user, action, format string, args ...any) {
+	detail := fmt.Sprintf(format, args...)
+	log.Print("[audit] " + detail)
+	if s.AuditSink != nil {
+		s.AuditSink.Audit(AuditEvent{Time: time.Now(), Room: room, User: user, Action: action, Detail: detail})
+	}
+}
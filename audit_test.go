@@ -0,0 +1,41 @@
+package mobster
+
+import (
+	"sync"
+	"testing"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func (r *recordingSink) Audit(e AuditEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func TestFlow_auditSink(t *testing.T) {
+	sink := &recordingSink{}
+	s := NewServer()
+	s.AuditSink = sink
+	s.OnMessage = func(ops *Ops, user, room, message string) {}
+	s.StartServer(4009)
+	connectAndSend(t, "a foo room", "hello")
+	sleep()
+	s.StopServer()
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.events) < 2 {
+		t.Fatalf("unexpected events %+v", sink.events)
+	}
+	join, message := sink.events[0], sink.events[1]
+	if join.Action != "join" || join.User != "foo" || join.Room != "room" || join.Detail != "room: foo joins" {
+		t.Errorf("unexpected join event %+v", join)
+	}
+	if message.Action != "message" || message.Detail != "room: foo -> hello" || message.Time.IsZero() {
+		t.Errorf("unexpected message event %+v", message)
+	}
+}
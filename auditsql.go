@@ -0,0 +1,197 @@
+package mobster
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sql flavour of SQLAuditSink, drivers are not imported by mobster
+type SQLDialect int
+
+const (
+	SQLite SQLDialect = iota
+	Postgres
+)
+
+// defaults of SQLAuditConfig
+const (
+	DefaultAuditBatchSize     = 100
+	DefaultAuditFlushInterval = time.Second
+	DefaultAuditQueueSize     = 10000
+)
+
+// keeps number of placeholders of single insert below old sqlite limit of 999
+const maxAuditBatchSize = 190
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type SQLAuditConfig struct {
+	Dialect SQLDialect
+	// "audit" when empty
+	Table string
+	// events written by single insert, DefaultAuditBatchSize when zero
+	BatchSize int
+	// how often incomplete batch is written, DefaultAuditFlushInterval when zero
+	FlushInterval time.Duration
+	// events waiting for write, above it events are dropped, DefaultAuditQueueSize when zero
+	QueueSize int
+	// if set, called with failed writes, their events are lost
+	OnError func(err error)
+}
+
+// SQLAuditSink batches audit events into sql table in background, so that
+// processing loop never waits for database
+type SQLAuditSink struct {
+	db      *sql.DB
+	cfg     SQLAuditConfig
+	events  chan AuditEvent
+	dropped atomic.Uint64
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// starts writing events to table of db, see CreateTable
+func NewSQLAuditSink(db *sql.DB, cfg SQLAuditConfig) (*SQLAuditSink, error) {
+	if cfg.Table == "" {
+		cfg.Table = "audit"
+	}
+	if !sqlIdentifier.MatchString(cfg.Table) {
+		return nil, fmt.Errorf("invalid audit table name %q", cfg.Table)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultAuditBatchSize
+	}
+	cfg.BatchSize = min(cfg.BatchSize, maxAuditBatchSize)
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultAuditFlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultAuditQueueSize
+	}
+	s := &SQLAuditSink{
+		db:     db,
+		cfg:    cfg,
+		events: make(chan AuditEvent, cfg.QueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+// creates audit table with indexes by room and user unless it exists
+func (s *SQLAuditSink) CreateTable(ctx context.Context) error {
+	id := "id INTEGER PRIMARY KEY AUTOINCREMENT"
+	at := "at TIMESTAMP NOT NULL"
+	if s.cfg.Dialect == Postgres {
+		id = "id BIGSERIAL PRIMARY KEY"
+		at = "at TIMESTAMPTZ NOT NULL"
+	}
+	t := s.cfg.Table
+	for _, stmt := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s, %s, room TEXT NOT NULL, username TEXT NOT NULL, action TEXT NOT NULL, detail TEXT NOT NULL)", t, id, at),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_room_at ON %s (room, at)", t, t),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_username_at ON %s (username, at)", t, t),
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queues event, drops it when queue is full
+func (s *SQLAuditSink) Audit(e AuditEvent) {
+	select {
+	case s.events <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// number of events dropped due to full queue
+func (s *SQLAuditSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// writes queued events and stops, events audited afterwards are dropped
+func (s *SQLAuditSink) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+	return nil
+}
+
+func (s *SQLAuditSink) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]AuditEvent, 0, s.cfg.BatchSize)
+	for {
+		select {
+		case e := <-s.events:
+			batch = append(batch, e)
+			if len(batch) == s.cfg.BatchSize {
+				batch = s.flush(batch)
+			}
+		case <-ticker.C:
+			batch = s.flush(batch)
+		case <-s.stop:
+			for {
+				select {
+				case e := <-s.events:
+					batch = append(batch, e)
+					if len(batch) == s.cfg.BatchSize {
+						batch = s.flush(batch)
+					}
+				default:
+					s.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// writes batch with single insert, returns it emptied
+func (s *SQLAuditSink) flush(batch []AuditEvent) []AuditEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+	query, args := s.insert(batch)
+	if _, err := s.db.Exec(query, args...); err != nil && s.cfg.OnError != nil {
+		s.cfg.OnError(fmt.Errorf("%d audit events lost: %w", len(batch), err))
+	}
+	return batch[:0]
+}
+
+func (s *SQLAuditSink) insert(batch []AuditEvent) (string, []any) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (at, room, username, action, detail) VALUES ", s.cfg.Table)
+	args := make([]any, 0, 5*len(batch))
+	for i, e := range batch {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j := range 5 {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			if s.cfg.Dialect == Postgres {
+				fmt.Fprintf(&b, "$%d", 5*i+j+1)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+		b.WriteByte(')')
+		args = append(args, e.Time, e.Room, e.User, e.Action, e.Detail)
+	}
+	return b.String(), args
+}
@@ -0,0 +1,144 @@
+package mobster
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// database/sql driver recording executed statements
+type fakeDriver struct {
+	mu    sync.Mutex
+	execs []fakeExec
+	fail  bool
+}
+
+type fakeExec struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return fakeDriverConn{d}, nil }
+
+func (d *fakeDriver) executed() []fakeExec {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]fakeExec(nil), d.execs...)
+}
+
+type fakeDriverConn struct{ d *fakeDriver }
+
+func (c fakeDriverConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{c.d, query}, nil
+}
+func (c fakeDriverConn) Close() error              { return nil }
+func (c fakeDriverConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if s.d.fail {
+		return nil, errors.New("db down")
+	}
+	s.d.execs = append(s.d.execs, fakeExec{s.query, args})
+	return driver.RowsAffected(1), nil
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDriver) {
+	d := &fakeDriver{}
+	db := sql.OpenDB(fakeConnector{d})
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+type fakeConnector struct{ d *fakeDriver }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c fakeConnector) Driver() driver.Driver                        { return c.d }
+
+func TestSQLAuditSink_batches(t *testing.T) {
+	db, d := openFakeDB(t)
+	sink, err := NewSQLAuditSink(db, SQLAuditConfig{Dialect: Postgres, BatchSize: 2, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, user := range []string{"foo", "bar", "baz"} {
+		sink.Audit(AuditEvent{Time: now, Room: "room", User: user, Action: "join", Detail: "room: " + user + " joins"})
+	}
+	sink.Close()
+
+	execs := d.executed()
+	if len(execs) != 2 {
+		t.Fatalf("expected full batch and rest on close, got %d inserts", len(execs))
+	}
+	if !strings.HasPrefix(execs[0].query, "INSERT INTO audit ") || !strings.Contains(execs[0].query, "($6, $7, $8, $9, $10)") {
+		t.Errorf("unexpected query %s", execs[0].query)
+	}
+	if len(execs[0].args) != 10 || execs[0].args[2] != "foo" || execs[1].args[2] != "baz" {
+		t.Errorf("unexpected args %v, %v", execs[0].args, execs[1].args)
+	}
+}
+
+func TestSQLAuditSink_flushInterval(t *testing.T) {
+	db, d := openFakeDB(t)
+	sink, _ := NewSQLAuditSink(db, SQLAuditConfig{Table: "events", FlushInterval: time.Millisecond})
+	defer sink.Close()
+	sink.Audit(AuditEvent{Action: "mute"})
+	time.Sleep(20 * time.Millisecond)
+
+	execs := d.executed()
+	if len(execs) != 1 || execs[0].query != "INSERT INTO events (at, room, username, action, detail) VALUES (?, ?, ?, ?, ?)" {
+		t.Errorf("unexpected inserts %v", execs)
+	}
+}
+
+func TestSQLAuditSink_neverBlocks(t *testing.T) {
+	db, d := openFakeDB(t)
+	d.fail = true
+	var errs []error
+	sink, _ := NewSQLAuditSink(db, SQLAuditConfig{QueueSize: 1, FlushInterval: time.Hour, OnError: func(err error) {
+		errs = append(errs, err)
+	}})
+	for range 1000 {
+		sink.Audit(AuditEvent{Action: "message"})
+	}
+	sink.Close()
+	if sink.Dropped() == 0 {
+		t.Error("events over queue size should be dropped")
+	}
+	if len(errs) != 1 {
+		t.Errorf("failed insert should be reported, got %v", errs)
+	}
+}
+
+func TestSQLAuditSink_createTable(t *testing.T) {
+	db, d := openFakeDB(t)
+	if _, err := NewSQLAuditSink(db, SQLAuditConfig{Table: "audit; DROP TABLE users"}); err == nil {
+		t.Error("invalid table name should fail")
+	}
+	sink, _ := NewSQLAuditSink(db, SQLAuditConfig{Dialect: Postgres})
+	defer sink.Close()
+	if err := sink.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	execs := d.executed()
+	if len(execs) != 3 || !strings.Contains(execs[0].query, "BIGSERIAL") {
+		t.Errorf("unexpected statements %v", execs)
+	}
+}
@@ -0,0 +1,69 @@
+package mobster
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// default of JWTAuthConfig.CacheTTL and HTTPAuthConfig.CacheTTL
+const DefaultAuthCacheTTL = time.Minute
+
+// results of auth adapters by auth packet, safe for connection goroutines;
+// packets are kept hashed, as they carry secrets
+type authCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[[sha256.Size]byte]authCacheEntry
+}
+
+type authCacheEntry struct {
+	user, room string
+	expires    time.Time
+}
+
+// nil and so disabled when size is not positive
+func newAuthCache(size int) *authCache {
+	if size <= 0 {
+		return nil
+	}
+	return &authCache{size: size, entries: make(map[[sha256.Size]byte]authCacheEntry)}
+}
+
+func (c *authCache) get(packet string, now time.Time) (user, room string, ok bool) {
+	if c == nil {
+		return "", "", false
+	}
+	key := sha256.Sum256([]byte(packet))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !now.Before(e.expires) {
+		delete(c.entries, key)
+		return "", "", false
+	}
+	return e.user, e.room, true
+}
+
+// when full expired entries are dropped first, then arbitrary ones
+func (c *authCache) put(packet, user, room string, now, expires time.Time) {
+	if c == nil || !now.Before(expires) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		for key, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < c.size {
+			break
+		}
+		delete(c.entries, key)
+	}
+	c.entries[sha256.Sum256([]byte(packet))] = authCacheEntry{user: user, room: room, expires: expires}
+}
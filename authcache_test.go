@@ -0,0 +1,34 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthCache(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newAuthCache(2)
+	c.put("a", "u1", "r1", now, now.Add(time.Second))
+	c.put("b", "u2", "r2", now, now.Add(time.Minute))
+	if user, room, ok := c.get("a", now); !ok || user != "u1" || room != "r1" {
+		t.Errorf("unexpected entry %q %q %v", user, room, ok)
+	}
+	later := now.Add(2 * time.Second)
+	if _, _, ok := c.get("a", later); ok {
+		t.Error("entry should expire")
+	}
+	c.put("c", "u3", "r3", later, later.Add(time.Minute))
+	c.put("d", "u4", "r4", later, later.Add(time.Minute))
+	if len(c.entries) != 2 {
+		t.Errorf("cache should stay within size, got %d entries", len(c.entries))
+	}
+	if _, _, ok := c.get("d", later); !ok {
+		t.Error("newest entry should be kept")
+	}
+
+	disabled := newAuthCache(0)
+	disabled.put("a", "u1", "r1", now, now.Add(time.Second))
+	if _, _, ok := disabled.get("a", now); ok {
+		t.Error("disabled cache should keep nothing")
+	}
+}
@@ -0,0 +1,90 @@
+package mobster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// default of HTTPAuthConfig.Timeout, same as DefaultHandshakeTimeout
+const DefaultHTTPAuthTimeout = time.Second
+
+// ErrAuthDenied is returned by HTTPAuth when endpoint answers 401 or 403
+var ErrAuthDenied = errors.New("auth denied")
+
+type HTTPAuthConfig struct {
+	// endpoint getting POST with {"packet": "<auth packet>"}, answering 200 with
+	// {"user": "<username>", "room": "<room>"}, or 401 or 403 to refuse client
+	URL string
+	// used for requests, client with Timeout by default
+	Client *http.Client
+	// timeout of default client, DefaultHTTPAuthTimeout when zero
+	Timeout time.Duration
+	// accepted packets are cached for that long, DefaultAuthCacheTTL when zero
+	CacheTTL time.Duration
+	// max number of cached packets, no caching when zero
+	CacheSize int
+}
+
+// OnAuth implementation asking http endpoint about every auth packet, e.g. s.OnAuth = auth.Auth;
+// refusals are not cached, so endpoint should rate limit them itself
+type HTTPAuth struct {
+	cfg   HTTPAuthConfig
+	cache *authCache
+	now   func() time.Time
+}
+
+func NewHTTPAuth(cfg HTTPAuthConfig) (*HTTPAuth, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("http auth needs url")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultHTTPAuthTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: cfg.Timeout}
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultAuthCacheTTL
+	}
+	return &HTTPAuth{cfg: cfg, cache: newAuthCache(cfg.CacheSize), now: time.Now}, nil
+}
+
+func (a *HTTPAuth) Auth(message string) (username, room string, err error) {
+	if user, room, ok := a.cache.get(message, a.now()); ok {
+		return user, room, nil
+	}
+	body, err := json.Marshal(map[string]string{"packet": message})
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := a.cfg.Client.Post(a.cfg.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", "", fmt.Errorf("auth endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", "", ErrAuthDenied
+	default:
+		return "", "", fmt.Errorf("auth endpoint: unexpected status %s", resp.Status)
+	}
+	var result struct {
+		User string `json:"user"`
+		Room string `json:"room"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&result); err != nil {
+		return "", "", fmt.Errorf("auth endpoint: bad response: %w", err)
+	}
+	if !validAuthName(result.User) || !validAuthName(result.Room) {
+		return "", "", fmt.Errorf("auth endpoint: bad user %q or room %q", result.User, result.Room)
+	}
+	now := a.now()
+	a.cache.put(message, result.User, result.Room, now, now.Add(a.cfg.CacheTTL))
+	return result.User, result.Room, nil
+}
@@ -0,0 +1,61 @@
+package mobster
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPAuth(t *testing.T) {
+	var calls atomic.Int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req struct{ Packet string }
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Packet {
+		case "good":
+			w.Write([]byte(`{"user": "foo", "room": "123"}`))
+		case "bad room":
+			w.Write([]byte(`{"user": "foo", "room": "1 2"}`))
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer endpoint.Close()
+
+	auth, err := NewHTTPAuth(HTTPAuthConfig{URL: endpoint.URL, CacheSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if user, room, err := auth.Auth("good"); err != nil || user != "foo" || room != "123" {
+			t.Errorf("unexpected auth %q %q %v", user, room, err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("accepted packet should be cached, endpoint called %d times", calls.Load())
+	}
+	if _, _, err := auth.Auth("wrong"); !errors.Is(err, ErrAuthDenied) {
+		t.Errorf("expected denial, got %v", err)
+	}
+	if _, _, err := auth.Auth("broken"); err == nil || errors.Is(err, ErrAuthDenied) {
+		t.Errorf("expected endpoint error, got %v", err)
+	}
+	if _, _, err := auth.Auth("bad room"); err == nil {
+		t.Error("invalid room should be refused")
+	}
+}
+
+func TestHTTPAuth_unreachable(t *testing.T) {
+	endpoint := httptest.NewServer(http.NotFoundHandler())
+	endpoint.Close()
+	auth, _ := NewHTTPAuth(HTTPAuthConfig{URL: endpoint.URL})
+	if _, _, err := auth.Auth("good"); err == nil {
+		t.Error("expected error")
+	}
+}
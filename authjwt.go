@@ -0,0 +1,213 @@
+package mobster
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned by JWTAuth for tokens failing verification, wrapped with reason
+var ErrInvalidToken = errors.New("invalid token")
+
+type JWTAuthConfig struct {
+	// key of HS256, HS384 and HS512 tokens
+	HMACKey []byte
+	// key of RS256, RS384 and RS512 tokens
+	RSAKey *rsa.PublicKey
+	// claims holding username and room, "sub" and "room" by default; room claim is
+	// optional, room from auth packet is used without it
+	UserClaim string
+	RoomClaim string
+	// checked when set, aud claim may hold list of audiences
+	Issuer   string
+	Audience string
+	// allowed clock skew when checking exp and nbf
+	Leeway time.Duration
+	// verified tokens are cached for that long, or until they expire if sooner,
+	// DefaultAuthCacheTTL when zero
+	CacheTTL time.Duration
+	// max number of cached tokens, no caching when zero
+	CacheSize int
+}
+
+// OnAuth implementation verifying json web tokens sent as "<token> [<room>]" auth packets,
+// e.g. s.OnAuth = auth.Auth; tokens with alg none or of key not configured are refused
+type JWTAuth struct {
+	cfg   JWTAuthConfig
+	cache *authCache
+	now   func() time.Time
+}
+
+func NewJWTAuth(cfg JWTAuthConfig) (*JWTAuth, error) {
+	if len(cfg.HMACKey) == 0 && cfg.RSAKey == nil {
+		return nil, errors.New("jwt auth needs hmac or rsa key")
+	}
+	if cfg.UserClaim == "" {
+		cfg.UserClaim = "sub"
+	}
+	if cfg.RoomClaim == "" {
+		cfg.RoomClaim = "room"
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultAuthCacheTTL
+	}
+	return &JWTAuth{cfg: cfg, cache: newAuthCache(cfg.CacheSize), now: time.Now}, nil
+}
+
+func (a *JWTAuth) Auth(message string) (username, room string, err error) {
+	now := a.now()
+	if user, room, ok := a.cache.get(message, now); ok {
+		return user, room, nil
+	}
+	token, packetRoom, _ := strings.Cut(message, " ")
+	claims, err := a.verify(token)
+	if err != nil {
+		return "", "", err
+	}
+	expires, err := a.checkClaims(claims, now)
+	if err != nil {
+		return "", "", err
+	}
+	username, _ = claims[a.cfg.UserClaim].(string)
+	if !validAuthName(username) {
+		return "", "", fmt.Errorf("%w: bad %s claim", ErrInvalidToken, a.cfg.UserClaim)
+	}
+	room = packetRoom
+	if claimed, ok := claims[a.cfg.RoomClaim]; ok {
+		room, _ = claimed.(string)
+	}
+	if !validAuthName(room) {
+		return "", "", fmt.Errorf("%w: no valid room", ErrInvalidToken)
+	}
+	a.cache.put(message, username, room, now, minTime(expires, now.Add(a.cfg.CacheTTL)))
+	return username, room, nil
+}
+
+// checks signature, returns claims of token
+func (a *JWTAuth) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a jwt", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	signed := token[:len(parts[0])+1+len(parts[1])]
+	if err := a.verifySignature(header.Alg, signed, signature); err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (a *JWTAuth) verifySignature(alg, signed string, signature []byte) error {
+	var newHash func() hash.Hash
+	var cryptoHash crypto.Hash
+	switch alg[min(len(alg), 2):] {
+	case "256":
+		newHash, cryptoHash = sha256.New, crypto.SHA256
+	case "384":
+		newHash, cryptoHash = sha512.New384, crypto.SHA384
+	case "512":
+		newHash, cryptoHash = sha512.New, crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, alg)
+	}
+	switch {
+	case strings.HasPrefix(alg, "HS") && len(a.cfg.HMACKey) > 0:
+		mac := hmac.New(newHash, a.cfg.HMACKey)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	case strings.HasPrefix(alg, "RS") && a.cfg.RSAKey != nil:
+		h := newHash()
+		h.Write([]byte(signed))
+		if rsa.VerifyPKCS1v15(a.cfg.RSAKey, cryptoHash, h.Sum(nil), signature) != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, alg)
+	}
+}
+
+// checks registered claims, returns until when token may be cached
+func (a *JWTAuth) checkClaims(claims map[string]any, now time.Time) (time.Time, error) {
+	expires := now.Add(a.cfg.CacheTTL)
+	if exp, ok := claims["exp"]; ok {
+		seconds, ok := exp.(float64)
+		if !ok {
+			return expires, fmt.Errorf("%w: bad exp claim", ErrInvalidToken)
+		}
+		expires = time.Unix(int64(seconds), 0).Add(a.cfg.Leeway)
+		if !now.Before(expires) {
+			return expires, fmt.Errorf("%w: expired", ErrInvalidToken)
+		}
+	}
+	if nbf, ok := claims["nbf"]; ok {
+		seconds, ok := nbf.(float64)
+		if !ok || now.Add(a.cfg.Leeway).Before(time.Unix(int64(seconds), 0)) {
+			return expires, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+		}
+	}
+	if a.cfg.Issuer != "" && claims["iss"] != a.cfg.Issuer {
+		return expires, fmt.Errorf("%w: bad issuer", ErrInvalidToken)
+	}
+	if a.cfg.Audience != "" && !hasAudience(claims["aud"], a.cfg.Audience) {
+		return expires, fmt.Errorf("%w: bad audience", ErrInvalidToken)
+	}
+	return expires, nil
+}
+
+func hasAudience(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: bad encoding", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: bad json", ErrInvalidToken)
+	}
+	return nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
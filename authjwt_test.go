@@ -0,0 +1,128 @@
+package mobster
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, alg string, claims map[string]any, sign func(signed []byte) []byte) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(key []byte) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func TestJWTAuth_hmac(t *testing.T) {
+	now := time.Unix(1000, 0)
+	key := []byte("secret")
+	auth, err := NewJWTAuth(JWTAuthConfig{HMACKey: key, Issuer: "me", Audience: "game"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.now = func() time.Time { return now }
+
+	token := signJWT(t, "HS256", map[string]any{"sub": "foo", "exp": 2000, "iss": "me", "aud": []string{"web", "game"}}, hs256(key))
+	if user, room, err := auth.Auth(token + " lobby"); err != nil || user != "foo" || room != "lobby" {
+		t.Errorf("unexpected auth %q %q %v", user, room, err)
+	}
+	token = signJWT(t, "HS256", map[string]any{"sub": "foo", "room": "vip", "iss": "me", "aud": "game"}, hs256(key))
+	if _, room, err := auth.Auth(token + " lobby"); err != nil || room != "vip" {
+		t.Errorf("room claim should win, got %q %v", room, err)
+	}
+
+	tests := map[string]string{
+		"expired":      signJWT(t, "HS256", map[string]any{"sub": "foo", "exp": 999, "iss": "me", "aud": "game"}, hs256(key)),
+		"not yet":      signJWT(t, "HS256", map[string]any{"sub": "foo", "nbf": 1001, "iss": "me", "aud": "game"}, hs256(key)),
+		"issuer":       signJWT(t, "HS256", map[string]any{"sub": "foo", "iss": "you", "aud": "game"}, hs256(key)),
+		"audience":     signJWT(t, "HS256", map[string]any{"sub": "foo", "iss": "me", "aud": "chat"}, hs256(key)),
+		"no user":      signJWT(t, "HS256", map[string]any{"iss": "me", "aud": "game"}, hs256(key)),
+		"spaced user":  signJWT(t, "HS256", map[string]any{"sub": "f o", "iss": "me", "aud": "game"}, hs256(key)),
+		"wrong key":    signJWT(t, "HS256", map[string]any{"sub": "foo", "iss": "me", "aud": "game"}, hs256([]byte("other"))),
+		"alg none":     signJWT(t, "none", map[string]any{"sub": "foo", "iss": "me", "aud": "game"}, func([]byte) []byte { return nil }),
+		"rsa, no key":  signJWT(t, "RS256", map[string]any{"sub": "foo", "iss": "me", "aud": "game"}, hs256(key)),
+		"not a jwt":    "abc",
+		"bad encoding": "a.b.c",
+	}
+	for name, token := range tests {
+		if _, _, err := auth.Auth(token + " lobby"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected invalid token, got %v", name, err)
+		}
+	}
+	token = signJWT(t, "HS256", map[string]any{"sub": "foo", "iss": "me", "aud": "game"}, hs256(key))
+	if _, _, err := auth.Auth(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token without room should be refused, got %v", err)
+	}
+}
+
+func TestJWTAuth_rsa(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewJWTAuth(JWTAuthConfig{RSAKey: &key.PublicKey, UserClaim: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := signJWT(t, "RS256", map[string]any{"name": "foo", "room": "123"}, func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	})
+	if user, room, err := auth.Auth(token); err != nil || user != "foo" || room != "123" {
+		t.Errorf("unexpected auth %q %q %v", user, room, err)
+	}
+	// hmac token signed with public key must not pass as rsa one
+	forged := signJWT(t, "HS256", map[string]any{"name": "foo", "room": "123"}, hs256(key.PublicKey.N.Bytes()))
+	if _, _, err := auth.Auth(forged); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected invalid token, got %v", err)
+	}
+}
+
+func TestJWTAuth_cache(t *testing.T) {
+	now := time.Unix(1000, 0)
+	key := []byte("secret")
+	auth, _ := NewJWTAuth(JWTAuthConfig{HMACKey: key, CacheSize: 10})
+	auth.now = func() time.Time { return now }
+	token := signJWT(t, "HS256", map[string]any{"sub": "foo", "room": "123", "exp": 1030}, hs256(key))
+	if _, _, err := auth.Auth(token); err != nil {
+		t.Fatal(err)
+	}
+	// cached tokens are not verified again
+	auth.cfg.HMACKey = []byte("rotated")
+	if _, _, err := auth.Auth(token); err != nil {
+		t.Errorf("token should be cached, got %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	if _, _, err := auth.Auth(token); err == nil {
+		t.Error("cache should not outlive token")
+	}
+}
+
+func TestNewJWTAuth_noKey(t *testing.T) {
+	if _, err := NewJWTAuth(JWTAuthConfig{}); err == nil {
+		t.Error("expected error without key")
+	}
+}
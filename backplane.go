@@ -0,0 +1,152 @@
+package mobster
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+)
+
+// pub/sub system connecting server instances, so that room messages and messages
+// to users connected elsewhere reach them; it maps directly onto nats, where Publish
+// is nats.Conn.Publish and Subscribe wraps nats.Conn.Subscribe with Unsubscribe of
+// returned subscription, redis pub/sub fits as well
+type Backplane interface {
+	Publish(subject string, data []byte) error
+	// handler may be called from any goroutine
+	Subscribe(subject string, handler func(data []byte)) (unsubscribe func(), err error)
+}
+
+// default prefix of backplane subjects, see BackplanePrefix
+const DefaultBackplanePrefix = "mobster"
+
+// capacity of queue of messages received from backplane
+const backplaneQueueSize = 1024
+
+type backplaneMessage struct {
+	room    bool   // room message, user message otherwise
+	name    string // room or user name
+	message string
+}
+
+// subjects are "<prefix>.room.<room>" and "<prefix>.user.<user>", with name encoded
+// as single base64url token, so that names with dots or wildcards like nats "*" and ">"
+// cannot subscribe to subjects of others
+func (s *Server) backplaneSubject(kind, name string) string {
+	prefix := s.BackplanePrefix
+	if prefix == "" {
+		prefix = DefaultBackplanePrefix
+	}
+	token := base64.RawURLEncoding.EncodeToString([]byte(name))
+	if token == "" {
+		// empty token is not valid subject in nats, no encoded name is that short
+		token = "_"
+	}
+	return prefix + "." + kind + "." + token
+}
+
+// subscribes to subject, must be called from processingLoop only
+func (s *Server) backplaneSubscribe(kind, name string) {
+	subject := s.backplaneSubject(kind, name)
+	if s.Backplane == nil || s.backplaneSubs[subject] != nil {
+		return
+	}
+	unsubscribe, err := s.Backplane.Subscribe(subject, func(data []byte) {
+		// messages are prefixed with id of instance which published them
+		id, message, ok := strings.Cut(string(data), " ")
+		if !ok || id == s.instanceID {
+			return
+		}
+		select {
+		case s.backplaneIncoming <- backplaneMessage{room: kind == "room", name: name, message: message}:
+		case <-s.stopping:
+		}
+	})
+	if err != nil {
+		s.OnError("", "backplane", err)
+		return
+	}
+	s.backplaneSubs[subject] = unsubscribe
+}
+
+// must be called from processingLoop only
+func (s *Server) backplaneUnsubscribe(kind, name string) {
+	subject := s.backplaneSubject(kind, name)
+	if unsubscribe := s.backplaneSubs[subject]; unsubscribe != nil {
+		unsubscribe()
+		delete(s.backplaneSubs, subject)
+	}
+}
+
+// must be called from processingLoop only
+func (s *Server) backplanePublish(kind, name string, messages ...string) {
+	if s.Backplane == nil {
+		return
+	}
+	subject := s.backplaneSubject(kind, name)
+	for _, message := range messages {
+		if err := s.Backplane.Publish(subject, []byte(s.instanceID+" "+message)); err != nil {
+			s.OnError("", "backplane", err)
+		}
+	}
+}
+
+// delivers message published by other instance, must be called from processingLoop only
+func (s *Server) handleBackplaneMessage(m backplaneMessage) {
+	if m.room {
+		s.writeToRoomLocal(m.name, m.message)
+		return
+	}
+	s.writeToUser(m.name, m.message)
+}
+
+// must be called from processingLoop only, when it exits
+func (s *Server) closeBackplane() {
+	for subject, unsubscribe := range s.backplaneSubs {
+		unsubscribe()
+		delete(s.backplaneSubs, subject)
+	}
+}
+
+// backplane connecting servers running in single process, e.g. for tests;
+// handlers are called synchronously from Publish
+type MemoryBackplane struct {
+	mu   sync.Mutex
+	next int
+	subs map[string]map[int]func(data []byte)
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{subs: make(map[string]map[int]func(data []byte))}
+}
+
+func (b *MemoryBackplane) Publish(subject string, data []byte) error {
+	b.mu.Lock()
+	var handlers []func(data []byte)
+	for _, h := range b.subs[subject] {
+		handlers = append(handlers, h)
+	}
+	b.mu.Unlock()
+	for _, h := range handlers {
+		h(data)
+	}
+	return nil
+}
+
+func (b *MemoryBackplane) Subscribe(subject string, handler func(data []byte)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[subject] == nil {
+		b.subs[subject] = make(map[int]func(data []byte))
+	}
+	b.next++
+	id := b.next
+	b.subs[subject][id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[subject], id)
+		if len(b.subs[subject]) == 0 {
+			delete(b.subs, subject)
+		}
+	}, nil
+}
@@ -0,0 +1,156 @@
+package mobster
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackplane_twoInstances(t *testing.T) {
+	backplane := NewMemoryBackplane()
+	newInstance := func() *Server {
+		s := NewServer()
+		s.Backplane = backplane
+		s.OnMessage = func(ops *Ops, name, room, message string) {
+			if message == "dm" {
+				ops.SendTo("bar", "hi bar")
+				return
+			}
+			ops.SendToRoom(room, message)
+		}
+		return s
+	}
+
+	first := newInstance()
+	first.StartServer(4009)
+	second := newInstance()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.ServeListener(l)
+
+	foo := connectAndSend(t, "a foo 123")
+	bar, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, bar, "a bar 123")
+	sleep()
+
+	send(t, foo, "hello")
+	if msg := readFromServer(t, bar); msg != "hello" {
+		t.Errorf("room message not passed to other instance, got %q", msg)
+	}
+	if msg := readFromServer(t, foo); msg != "hello" {
+		t.Errorf("room message not delivered locally, got %q", msg)
+	}
+
+	send(t, foo, "dm")
+	if msg := readFromServer(t, bar); msg != "hi bar" {
+		t.Errorf("user message not passed to other instance, got %q", msg)
+	}
+
+	bar.Close()
+	sleep()
+	second.StopServer()
+	first.StopServer()
+
+	if len(backplane.subs) != 0 {
+		t.Errorf("subscriptions left: %v", backplane.subs)
+	}
+}
+
+// backplane matching subjects with nats wildcards, "*" for one token and ">" for the rest
+type wildcardBackplane struct {
+	mu   sync.Mutex
+	subs map[*func(data []byte)]string
+}
+
+func natsMatch(pattern, subject string) bool {
+	p, s := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, token := range p {
+		if token == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) || (token != "*" && token != s[i]) {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
+
+func (b *wildcardBackplane) Publish(subject string, data []byte) error {
+	b.mu.Lock()
+	var handlers []func(data []byte)
+	for h, pattern := range b.subs {
+		if natsMatch(pattern, subject) {
+			handlers = append(handlers, *h)
+		}
+	}
+	b.mu.Unlock()
+	for _, h := range handlers {
+		h(data)
+	}
+	return nil
+}
+
+func (b *wildcardBackplane) Subscribe(subject string, handler func(data []byte)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h := &handler
+	b.subs[h] = subject
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, h)
+	}, nil
+}
+
+func TestBackplane_wildcardNames(t *testing.T) {
+	backplane := &wildcardBackplane{subs: make(map[*func(data []byte)]string)}
+	first := NewServer()
+	first.DisableAudit = true
+	first.Backplane = backplane
+	first.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendToRoom(room, message)
+		ops.SendTo("bar", "secret")
+	}
+	first.StartServer(4009)
+	second := NewServer()
+	second.DisableAudit = true
+	second.Backplane = backplane
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.ServeListener(l)
+
+	foo := connectAndSend(t, "a foo 123")
+	defer foo.Close()
+	var snoopers []net.Conn
+	for _, auth := range []string{"a > >", "a * *"} {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		send(t, c, auth)
+		snoopers = append(snoopers, c)
+	}
+	sleep()
+
+	send(t, foo, "hello")
+	for _, c := range snoopers {
+		c.SetDeadline(time.Now().Add(50 * time.Millisecond))
+		var buf [512]byte
+		if n, _ := c.Read(buf[:]); n > 0 {
+			t.Errorf("wildcard name received message of others: %q", buf[:n])
+		}
+	}
+
+	second.StopServer()
+	first.StopServer()
+}
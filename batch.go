@@ -0,0 +1,46 @@
+package mobster
+
+import (
+	"strings"
+	"time"
+)
+
+// default FormatBatch, batched messages are newline separated
+func formatBatch(messages []string) string {
+	return strings.Join(messages, "\n")
+}
+
+// batch window of rooms of type, nil for untyped rooms
+func (s *Server) batchWindow(t *RoomType) time.Duration {
+	if t != nil && t.BatchWindow > 0 {
+		return t.BatchWindow
+	}
+	return s.RoomBatchWindow
+}
+
+// holds room messages until batch window of room ends, must be called from processingLoop only
+func (s *Server) batchRoomMessages(room string, st *roomState, messages []string) {
+	if st.flush == nil {
+		st.flush = s.armRoomTimer(room, st, st.batchWindow, roomFlush)
+	}
+	st.batch = append(st.batch, messages...)
+}
+
+// writes messages batched in room followed by given ones right away, as single message
+// formatted with FormatBatch, must be called from processingLoop only
+func (s *Server) flushRoom(room string, messages ...string) {
+	if st := s.rooms[room]; st != nil && len(st.batch) > 0 {
+		st.flush.Stop()
+		messages = append(st.batch, messages...)
+		st.batch, st.flush = nil, nil
+	}
+	switch len(messages) {
+	case 0:
+		return
+	case 1:
+	default:
+		messages = []string{s.FormatBatch(messages)}
+	}
+	s.backplanePublish("room", room, messages...)
+	s.writeToRoomLocal(room, messages...)
+}
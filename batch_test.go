@@ -0,0 +1,86 @@
+package mobster
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlow_roomBatchWindow(t *testing.T) {
+	s := NewServer()
+	s.RoomBatchWindow = 20 * time.Millisecond
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.SendToRoom(room, message+" 1")
+		ops.SendToRoom(room, message+" 2")
+	}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo 123", "tick")
+
+	if msg := readFromServer(t, c); msg != "tick 1\ntick 2" {
+		t.Errorf("messages within window should be sent together, got %q", msg)
+	}
+	send(t, c, "tock")
+	time.Sleep(30 * time.Millisecond)
+	if msg := readFromServer(t, c); msg != "tock 1\ntock 2" {
+		t.Errorf("next window should be sent separately, got %q", msg)
+	}
+	s.StopServer()
+}
+
+func TestFlow_roomBatchWindowPerType(t *testing.T) {
+	s := NewServer()
+	s.RegisterRoomType("match-*", RoomType{BatchWindow: 10 * time.Millisecond})
+	s.FormatBatch = func(messages []string) string {
+		return "batch"
+	}
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.SendToRoom(room, "a")
+		ops.SendToRoom(room, "b")
+	}
+	s.StartServer(4009)
+	match := connectAndSend(t, "a foo match-1", "go")
+	lobby := connectAndSend(t, "a bar lobby", "go")
+
+	if msg := readFromServer(t, match); msg != "batch" {
+		t.Errorf("typed room should batch, got %q", msg)
+	}
+	if msg := readFromServer(t, lobby); !strings.HasPrefix(msg, "a") {
+		t.Errorf("untyped room should not batch, got %q", msg)
+	}
+	s.StopServer()
+}
+
+func TestFlow_roomBatchFlushedByUrgent(t *testing.T) {
+	s := NewServer()
+	s.RoomBatchWindow = time.Second
+	s.OnConnect = func(ops *Ops, user, room string) {
+		ops.SendToRoom(room, "hello")
+	}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo 123")
+	s.SendToRoomWithPriority("123", "urgent", PriorityHigh)
+
+	if msg := readFromServer(t, c); msg != "hello\nurgent" {
+		t.Errorf("urgent message should go right away after batched ones, got %q", msg)
+	}
+	s.StopServer()
+}
+
+func TestFlow_roomBatchFlushedOnClose(t *testing.T) {
+	s := NewServer()
+	s.RoomBatchWindow = time.Second
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.SendToRoom(room, "last words")
+		ops.CloseRoom(room, "")
+	}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo 123", "bye")
+
+	if msg := readFromServer(t, c); msg != "last words" {
+		t.Errorf("batched messages should be sent before room is closed, got %q", msg)
+	}
+	s.StopServer()
+}
@@ -0,0 +1,97 @@
+package mobster
+
+import (
+	"net"
+	"testing"
+)
+
+func BenchmarkConnectAuth(b *testing.B) {
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		ops.SendTo(name, "ok")
+	}
+	s.OnDisconnect = func(ops *Ops, name, room string) {}
+	s.StartServer(4009)
+	defer s.StopServer()
+
+	var buf [512]byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c, err := net.Dial("tcp", "127.0.0.1:4009")
+		if err != nil {
+			b.Fatal(err)
+		}
+		c.Write([]byte("a foo 123"))
+		if _, err := c.Read(buf[0:]); err != nil {
+			b.Fatal(err)
+		}
+		c.Close()
+	}
+}
+
+func BenchmarkMessageRoundTrip(b *testing.B) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.OnConnect = func(ops *Ops, name, room string) {}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendTo(name, message)
+	}
+	s.StartServer(4009)
+	defer s.StopServer()
+
+	c := benchConnect(b, "a foo 123")
+	defer c.Close()
+
+	var buf [512]byte
+	message := []byte("move e2 e4")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Write(message)
+		if _, err := c.Read(buf[0:]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRoomBroadcast(b *testing.B) {
+	const members = 50
+	s := NewServer()
+	s.DisableAudit = true
+	s.OnConnect = func(ops *Ops, name, room string) {}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+	defer s.StopServer()
+
+	var conns []net.Conn
+	for i := 0; i < members; i++ {
+		c := benchConnect(b, "a user"+string(rune('A'+i))+" 123")
+		defer c.Close()
+		conns = append(conns, c)
+	}
+
+	var buf [512]byte
+	message := []byte("tick")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conns[0].Write(message)
+		for _, c := range conns {
+			if _, err := c.Read(buf[0:]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchConnect(b *testing.B, auth string) net.Conn {
+	c, err := net.Dial("tcp", "127.0.0.1:4009")
+	if err != nil {
+		b.Fatal(err)
+	}
+	c.Write([]byte(auth))
+	sleep()
+	return c
+}
@@ -0,0 +1,79 @@
+package mobster
+
+import (
+	"net"
+)
+
+// receives messages sent to bot, called from processing loop, so it may use ops freely;
+// note that bot gets its own room messages too, except ones it sends from handler itself
+type BotHandler func(ops *Ops, message string)
+
+// add in-process client occupying room slot like any other user, async version
+func (s *Server) AddBot(user, room string, handler BotHandler) {
+	go func() { s.incomingClients <- newBot(user, room, handler) }()
+}
+
+// add in-process client occupying room slot like any other user, OnConnect is called
+// as for regular clients, bot is removed with Disconnect
+func (o *Ops) AddBot(user, room string, handler BotHandler) {
+	o.server.join(newBot(user, room, handler))
+}
+
+func newBot(user, room string, handler BotHandler) *Client {
+	c := NewClient(user, room, botConn{user})
+	c.bot = handler
+	return c
+}
+
+// message waiting for bot handler
+type botDelivery struct {
+	bot     *Client
+	message string
+}
+
+// queues message for bot, handler runs on next loop iteration, so that bot replying
+// into its own room does not recurse; must be called from processingLoop only
+func (s *Server) writeToBot(c *Client, message string) error {
+	if c == s.activeBot {
+		return nil
+	}
+	s.botDeliveries = append(s.botDeliveries, botDelivery{bot: c, message: message})
+	select {
+	case s.botsReady <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// runs bot handlers for messages queued so far, ones queued meanwhile wait for next
+// iteration; must be called from processingLoop only
+func (s *Server) deliverToBots(ops *Ops) {
+	deliveries := s.botDeliveries
+	s.botDeliveries = nil
+	for _, d := range deliveries {
+		// may be removed meanwhile
+		if !s.clientHolder.Has(d.bot) {
+			continue
+		}
+		if !s.DisableAudit {
+			s.auditf(d.bot.room, d.bot.user, "receive", "%s: %s <- %s", d.bot.room, d.bot.user, d.message)
+		}
+		s.activeBot = d.bot
+		d.bot.bot(ops, d.message)
+		s.activeBot = nil
+	}
+}
+
+// placeholder connection of bot, never read from nor written to
+type botConn struct {
+	user string
+}
+
+func (c botConn) Write(b []byte) (int, error) { return 0, net.ErrClosed }
+func (c botConn) Close() error                { return nil }
+func (c botConn) RemoteAddr() net.Addr        { return botAddr(c.user) }
+
+type botAddr string
+
+func (a botAddr) Network() string { return "bot" }
+func (a botAddr) String() string  { return string(a) }
@@ -0,0 +1,77 @@
+package mobster
+
+import "testing"
+
+func TestFlow_bot(t *testing.T) {
+	var received []string
+	var count int
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		count = ops.GetRoomCount(room)
+		if name == "foo" {
+			ops.AddBot("ai", room, func(ops *Ops, message string) {
+				received = append(received, message)
+				if message == "your move" {
+					ops.SendTo("foo", "e4")
+				}
+			})
+		}
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	send(t, c, "your move")
+
+	if count != 2 {
+		t.Errorf("bot should occupy room slot, got %d users", count)
+	}
+	r := readFromServer(t, c)
+	if len(r) < len("your movee4") {
+		r += readFromServer(t, c)
+	}
+	if r != "your movee4" {
+		t.Errorf("expected room message and bot reply, got %q", r)
+	}
+	if len(received) != 1 || received[0] != "your move" {
+		t.Errorf("bot should receive room messages, got %v", received)
+	}
+
+	s.StopServer()
+}
+
+func TestFlow_botEchoesIntoOwnRoom(t *testing.T) {
+	var received []string
+	s := NewServer()
+	s.DisableAudit = true
+	s.OnConnect = func(ops *Ops, name, room string) {
+		if name == "foo" {
+			ops.AddBot("echo", room, func(ops *Ops, message string) {
+				received = append(received, message)
+				ops.SendToRoom(room, "echo "+message)
+			})
+		}
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	send(t, c, "hi")
+
+	r := readFromServer(t, c)
+	if len(r) < len("hiecho hi") {
+		r += readFromServer(t, c)
+	}
+	if r != "hiecho hi" {
+		t.Errorf("expected room message and single echo, got %q", r)
+	}
+	if len(received) != 1 || received[0] != "hi" {
+		t.Errorf("bot should not receive its own echo, got %v", received)
+	}
+
+	s.StopServer()
+}
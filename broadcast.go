@@ -0,0 +1,77 @@
+package mobster
+
+import "reflect"
+
+// max number of queued room messages written to clients together
+const maxCoalescedMessages = 64
+
+// room messages taken from queue at once
+type roomBatch struct {
+	room     string
+	messages []string
+}
+
+// takes room messages already waiting in queue along with first one, grouped by room
+// in order of arrival; messages are coalesced only with length prefixed framing,
+// as text framing would lose their boundaries, must be called from processingLoop only
+func (s *Server) coalesceRoomMessages(first Response) []roomBatch {
+	batches := []roomBatch{{room: first.name, messages: []string{first.message}}}
+	if s.Framing != FramingLengthPrefixed {
+		return batches
+	}
+	for n := 1; n < maxCoalescedMessages; n++ {
+		select {
+		case r := <-s.responsesToRoom:
+			batches = addToBatch(batches, r)
+		default:
+			return batches
+		}
+	}
+	return batches
+}
+
+func addToBatch(batches []roomBatch, r Response) []roomBatch {
+	for i := range batches {
+		if batches[i].room == r.name {
+			batches[i].messages = append(batches[i].messages, r.message)
+			return batches
+		}
+	}
+	return append(batches, roomBatch{room: r.name, messages: []string{r.message}})
+}
+
+// must be called from processingLoop only
+func (s *Server) writeToRooms(batches []roomBatch) {
+	for _, b := range batches {
+		s.writeToRoom(b.room, b.messages...)
+	}
+}
+
+// room broadcast encoded by single codec, shared by all recipients using that codec
+type codecFrames struct {
+	codec Codec
+	data  []byte
+}
+
+// returns messages encoded and framed for codec, encoding them once per codec instance;
+// codecs which cannot be compared are not shared
+func (s *Server) encodeShared(cache []codecFrames, codec Codec, messages []string) ([]codecFrames, []byte, bool) {
+	if !reflect.TypeOf(codec).Comparable() {
+		return cache, nil, false
+	}
+	for _, f := range cache {
+		if f.codec == codec {
+			return cache, f.data, true
+		}
+	}
+	var data []byte
+	for _, message := range messages {
+		encoded, err := codec.Encode([]byte(message))
+		if err != nil {
+			// left for per client write, which reports the error
+			return cache, nil, false
+		}
+		data = append(data, s.frame(encoded)...)
+	}
+	return append(cache, codecFrames{codec: codec, data: data}), data, true
+}
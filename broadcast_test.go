@@ -0,0 +1,96 @@
+package mobster
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+type writesConn struct {
+	net.Conn
+	writes [][]byte
+}
+
+func (c *writesConn) Write(b []byte) (int, error) {
+	c.writes = append(c.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (c *writesConn) Close() error {
+	return nil
+}
+
+func TestCoalesceRoomMessages(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.Framing = FramingLengthPrefixed
+	s.RoomSequences = true
+
+	foo := &writesConn{}
+	bar := &writesConn{}
+	other := &writesConn{}
+	s.clientHolder.Add(&Client{user: "foo", room: "room", conn: foo})
+	s.clientHolder.Add(&Client{user: "bar", room: "room", conn: bar})
+	s.clientHolder.Add(&Client{user: "baz", room: "other", conn: other})
+
+	s.SendToRoom("room", "one")
+	s.SendToRoom("other", "x")
+	s.SendToRoom("room", "two")
+	s.writeToRooms(s.coalesceRoomMessages(<-s.responsesToRoom))
+
+	expected := append(s.appendFrame(nil, "1 one"), s.appendFrame(nil, "2 two")...)
+	for _, c := range []*writesConn{foo, bar} {
+		if len(c.writes) != 1 || !bytes.Equal(c.writes[0], expected) {
+			t.Errorf("expected single coalesced write, got %q", c.writes)
+		}
+	}
+	if len(other.writes) != 1 || !bytes.Equal(other.writes[0], s.appendFrame(nil, "1 x")) {
+		t.Errorf("unexpected writes to other room %q", other.writes)
+	}
+}
+
+func TestCoalesceRoomMessages_textFraming(t *testing.T) {
+	s := NewServer()
+	s.SendToRoom("room", "one")
+	s.SendToRoom("room", "two")
+
+	batches := s.coalesceRoomMessages(<-s.responsesToRoom)
+	if len(batches) != 1 || len(batches[0].messages) != 1 {
+		t.Error("text framed messages coalesced:", batches)
+	}
+}
+
+type countingCodec struct {
+	encodes int
+}
+
+func (c *countingCodec) Encode(message []byte) ([]byte, error) {
+	c.encodes++
+	return append([]byte("enc:"), message...), nil
+}
+
+func (c *countingCodec) Decode(message []byte) ([]byte, error) {
+	return message, nil
+}
+
+func TestWriteToRoom_sharedCodec(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	shared := &countingCodec{}
+	own := &countingCodec{}
+
+	conns := []*writesConn{{}, {}, {}}
+	s.clientHolder.Add(&Client{user: "foo", room: "room", conn: conns[0], codec: shared})
+	s.clientHolder.Add(&Client{user: "bar", room: "room", conn: conns[1], codec: shared})
+	s.clientHolder.Add(&Client{user: "baz", room: "room", conn: conns[2], codec: own})
+	s.writeToRoom("room", "hello")
+
+	if shared.encodes != 1 || own.encodes != 1 {
+		t.Errorf("expected single encode per codec, got %d and %d", shared.encodes, own.encodes)
+	}
+	for _, c := range conns {
+		if len(c.writes) != 1 || string(c.writes[0]) != "enc:hello" {
+			t.Errorf("unexpected writes %q", c.writes)
+		}
+	}
+}
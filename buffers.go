@@ -0,0 +1,33 @@
+package mobster
+
+import "sync"
+
+// size of single read from connection in text framing
+const readBufferSize = 512
+
+// write buffers that grew bigger are not pooled, so that few huge messages
+// do not keep memory forever
+const maxPooledWriteBuffer = 64 * 1024
+
+var readBuffers = sync.Pool{
+	New: func() any { return new([readBufferSize]byte) },
+}
+
+var writeBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, readBufferSize)
+		return &buf
+	},
+}
+
+func getWriteBuffer() *[]byte {
+	return writeBuffers.Get().(*[]byte)
+}
+
+func putWriteBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledWriteBuffer {
+		return
+	}
+	*buf = (*buf)[:0]
+	writeBuffers.Put(buf)
+}
@@ -0,0 +1,101 @@
+package mobster
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrChallengeFailed is reported to OnError when client response does not solve the challenge
+var ErrChallengeFailed = errors.New("challenge failed")
+
+// pre-auth step, see Server.Challenger
+type Challenger interface {
+	// returns challenge sent to freshly connected client
+	Challenge(remote net.Addr) string
+	// tells if response of the client solves the challenge
+	Verify(challenge, response string) bool
+}
+
+// sends challenge and reads response before auth packet, response is read as one packet
+// in the same framing as auth packet
+func (s *Server) challenge(conn net.Conn, reader *frameReader) error {
+	if s.Challenger == nil {
+		return nil
+	}
+	if s.ChallengeTimeout > 0 && !s.Debug {
+		conn.SetDeadline(time.Now().Add(s.ChallengeTimeout))
+	}
+	challenge := s.Challenger.Challenge(conn.RemoteAddr())
+	if _, err := conn.Write(s.frame([]byte(challenge))); err != nil {
+		return fmt.Errorf("cannot send challenge: %w", err)
+	}
+	response, err := reader.readAuth()
+	if err != nil {
+		return fmt.Errorf("cannot read challenge response: %w", err)
+	}
+	if !s.Challenger.Verify(challenge, response) {
+		return ErrChallengeFailed
+	}
+	return nil
+}
+
+// hashcash like Challenger, client has to find response such that sha256 of
+// challenge nonce followed by response starts with Difficulty zero bits
+type ProofOfWork struct {
+	Difficulty int
+}
+
+// challenge is "pow <difficulty> <nonce>"
+func (p ProofOfWork) Challenge(remote net.Addr) string {
+	return fmt.Sprintf("pow %d %s", p.Difficulty, newDatagramToken())
+}
+
+func (p ProofOfWork) Verify(challenge, response string) bool {
+	difficulty, nonce, ok := parseProofOfWork(challenge)
+	return ok && difficulty == p.Difficulty && zeroBits(nonce, response) >= difficulty
+}
+
+// finds response to ProofOfWork challenge, meant for clients and tests
+func SolveProofOfWork(challenge string) (string, error) {
+	difficulty, nonce, ok := parseProofOfWork(challenge)
+	if !ok {
+		return "", fmt.Errorf("malformed challenge %q", challenge)
+	}
+	for i := 0; ; i++ {
+		response := strconv.Itoa(i)
+		if zeroBits(nonce, response) >= difficulty {
+			return response, nil
+		}
+	}
+}
+
+func parseProofOfWork(challenge string) (difficulty int, nonce string, ok bool) {
+	fields := strings.Fields(challenge)
+	if len(fields) != 3 || fields[0] != "pow" {
+		return 0, "", false
+	}
+	difficulty, err := strconv.Atoi(fields[1])
+	if err != nil || difficulty < 0 || difficulty > 256 {
+		return 0, "", false
+	}
+	return difficulty, fields[2], true
+}
+
+// number of leading zero bits of sha256(nonce + response)
+func zeroBits(nonce, response string) int {
+	sum := sha256.Sum256([]byte(nonce + response))
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
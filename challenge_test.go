@@ -0,0 +1,88 @@
+package mobster
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProofOfWork(t *testing.T) {
+	p := ProofOfWork{Difficulty: 8}
+	challenge := p.Challenge(nil)
+	response, err := SolveProofOfWork(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Verify(challenge, response) {
+		t.Errorf("response %q should solve %q", response, challenge)
+	}
+	if p.Verify(challenge, response+"x") && p.Verify(challenge, response+"y") {
+		t.Error("wrong responses should not be accepted")
+	}
+	if (ProofOfWork{Difficulty: 4}).Verify(challenge, response) {
+		t.Error("challenge of other difficulty should not be accepted")
+	}
+	if _, err := SolveProofOfWork("foo"); err == nil {
+		t.Error("malformed challenge should not be solved")
+	}
+}
+
+func TestFlow_challenge(t *testing.T) {
+	connected := make(chan string, 2)
+	s := NewServer()
+	s.Challenger = ProofOfWork{Difficulty: 8}
+	s.OnConnect = func(ops *Ops, user, room string) {
+		connected <- user
+	}
+	s.StartServer(4009)
+
+	c := connect(t)
+	response, err := SolveProofOfWork(readFromServer(t, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, c, response, "a foo 123")
+
+	bot := connect(t)
+	readFromServer(t, bot)
+	send(t, bot, "a bar 123")
+	sleep()
+	s.StopServer()
+
+	close(connected)
+	var users []string
+	for user := range connected {
+		users = append(users, user)
+	}
+	if len(users) != 1 || users[0] != "foo" {
+		t.Errorf("only client solving challenge should connect, got %v", users)
+	}
+}
+
+func TestFlow_challengeTimeoutZero(t *testing.T) {
+	errs := make(chan error, 1)
+	s := NewServer()
+	s.Challenger = ProofOfWork{Difficulty: 8}
+	s.HandshakeTimeout = 50 * time.Millisecond
+	s.OnError = func(user, op string, err error) {
+		if op == "challenge" {
+			errs <- err
+		}
+	}
+	s.StartServer(4009)
+
+	// challenge is never answered
+	c := connect(t)
+	readFromServer(t, c)
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("expected handshake deadline, got %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("HandshakeTimeout should apply to challenge when ChallengeTimeout is zero")
+	}
+	c.Close()
+	s.StopServer()
+}
@@ -1,50 +1,208 @@
 package mobster
 
-import "net"
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// connection of client as used by processing loop and ClientHolder, net.Conn satisfies it,
+// tests and custom transports may provide their own
+type ClientConn interface {
+	Write(b []byte) (int, error)
+	Close() error
+	RemoteAddr() net.Addr
+}
 
 type Client struct {
 	user string
+	// copy of user read by connection goroutine, see setUser
+	name atomic.Pointer[string]
 	room string
-	conn net.Conn
+	// copy of room read by connection goroutine, see setRoom
+	roomName atomic.Pointer[string]
+	conn     ClientConn
+	// writer of conn, nil when processing loop writes to it, see attachMailbox
+	mailbox     *roomMailbox
+	codec       Codec      // nil when messages are passed as they are
+	secret      string     // room password or invite given on auth
+	spectator   bool       // receives room messages only
+	guest       bool       // authenticated by Server.GuestAuth
+	bot         BotHandler // set for in-process clients, conn is a placeholder then
+	connectedAt time.Time
+	// updated from processing loop only
+	lastActivity time.Time
+	// accepted by OnNegotiate, empty when not used
+	protocolVersion string
+	// nil until first message, see Server.Flood
+	flood *floodState
+
+	// nil until first write with ClientBandwidth or Ops.SetBandwidth
+	shaper *shaper
+	// traffic of the connection, see ClientInfo.IO
+	io ioCounters
+	// cancelled when connection is lost or closed, nil for clients not read by server
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	token        string   // identifies client datagrams
+	datagramAddr net.Addr // where to send datagrams, nil until first one is received
+}
+
+// connection details of client, as exposed to handlers
+type ClientInfo struct {
+	User        string
+	Room        string
+	RemoteAddr  net.Addr
+	ConnectedAt time.Time
+	// time of last message or datagram received from client, ConnectedAt if none yet
+	LastActivity time.Time
+	Transport    string // network of the connection, e.g. "tcp" or "unix"
+	Spectator    bool
+	// authenticated as guest, see Server.GuestAuth
+	Guest bool
+	// version of protocol accepted by OnNegotiate
+	ProtocolVersion string
+	// traffic of the connection since auth
+	IO IOStats
+}
+
+// changes name of client, must be called from processingLoop only
+func (c *Client) setUser(user string) {
+	c.user = user
+	c.name.Store(&user)
+}
+
+// current name of client for connection goroutine, which must not read user
+func (c *Client) currentUser() string {
+	if name := c.name.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+// changes room of client, must be called from processingLoop only
+func (c *Client) setRoom(room string) {
+	c.room = room
+	c.roomName.Store(&room)
+}
+
+// current room of client for connection goroutine, which must not read room
+func (c *Client) currentRoom() string {
+	if room := c.roomName.Load(); room != nil {
+		return *room
+	}
+	return ""
+}
+
+func (c *Client) User() string         { return c.user }
+func (c *Client) Room() string         { return c.room }
+func (c *Client) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+func (c *Client) IsSpectator() bool    { return c.spectator }
+func (c *Client) IsGuest() bool        { return c.guest }
+func (c *Client) IsBot() bool          { return c.bot != nil }
+
+// connection details, same as Ops.GetClientInfo returns
+func (c *Client) Info() ClientInfo {
+	return c.info()
+}
+
+func (c *Client) info() ClientInfo {
+	return ClientInfo{
+		User:            c.user,
+		Room:            c.room,
+		RemoteAddr:      c.conn.RemoteAddr(),
+		ConnectedAt:     c.connectedAt,
+		LastActivity:    c.lastActivity,
+		Transport:       transport(c.conn),
+		Spectator:       c.spectator,
+		Guest:           c.guest,
+		ProtocolVersion: c.protocolVersion,
+		IO:              c.io.stats(),
+	}
+}
+
+// creates client of given connection, e.g. to be used with ClientHolder outside of server
+func NewClient(user, room string, conn ClientConn) *Client {
+	now := time.Now()
+	return &Client{user: user, room: room, conn: conn, connectedAt: now, lastActivity: now}
+}
+
+// network of connection, local address is preferred as remote one of unix sockets is often empty
+func transport(conn ClientConn) string {
+	if c, ok := conn.(interface{ LocalAddr() net.Addr }); ok {
+		return c.LocalAddr().Network()
+	}
+	return conn.RemoteAddr().Network()
 }
 
 type ClientHolder struct {
-	clients       map[*Client]bool
-	clientsByName map[string]*Client
-	clientsByRoom map[string][]*Client
+	clients        map[*Client]bool
+	clientsByName  map[string][]*Client // connections of user, newest last
+	clientsByRoom  map[string][]*Client
+	clientsByToken map[string]*Client
 }
 
 func NewClientHolder() *ClientHolder {
 	h := new(ClientHolder)
 	h.clients = make(map[*Client]bool)
-	h.clientsByName = make(map[string]*Client)
+	h.clientsByName = make(map[string][]*Client)
 	h.clientsByRoom = make(map[string][]*Client)
+	h.clientsByToken = make(map[string]*Client)
 	return h
 }
 
 func (h *ClientHolder) Add(c *Client) {
 	h.clients[c] = true
-	h.clientsByName[c.user] = c
+	h.clientsByName[c.user] = append(h.clientsByName[c.user], c)
 	h.clientsByRoom[c.room] = append(h.clientsByRoom[c.room], c)
+	if c.token != "" {
+		h.clientsByToken[c.token] = c
+	}
 }
 
 func (h *ClientHolder) Remove(c *Client) {
-	room := h.clientsByRoom[c.room]
-	var pos int
-	for idx, client := range room {
+	if !h.clients[c] {
+		return
+	}
+	h.clientsByRoom[c.room] = without(h.clientsByRoom[c.room], c)
+	if len(h.clientsByRoom[c.room]) == 0 {
+		delete(h.clientsByRoom, c.room)
+	}
+	h.clientsByName[c.user] = without(h.clientsByName[c.user], c)
+	if len(h.clientsByName[c.user]) == 0 {
+		delete(h.clientsByName, c.user)
+	}
+	delete(h.clientsByToken, c.token)
+	delete(h.clients, c)
+}
+
+func without(clients []*Client, c *Client) []*Client {
+	for idx, client := range clients {
 		if client == c {
-			pos = idx
-			break
+			return append(clients[:idx], clients[idx+1:]...)
 		}
 	}
-	h.clientsByRoom[c.room] = append(room[:pos], room[pos+1:]...)
+	return clients
+}
 
+// moves client to other room, keeping it in all other indexes
+func (h *ClientHolder) Move(c *Client, room string) {
+	if !h.clients[c] {
+		return
+	}
+	h.clientsByRoom[c.room] = without(h.clientsByRoom[c.room], c)
 	if len(h.clientsByRoom[c.room]) == 0 {
 		delete(h.clientsByRoom, c.room)
 	}
+	c.setRoom(room)
+	h.clientsByRoom[room] = append(h.clientsByRoom[room], c)
+}
 
-	delete(h.clientsByName, c.user)
-	delete(h.clients, c)
+// tells if client is still held, e.g. was not disconnected in the meantime
+func (h *ClientHolder) Has(c *Client) bool {
+	return h.clients[c]
 }
 
 func (h *ClientHolder) GetAll() []*Client {
@@ -55,18 +213,78 @@ func (h *ClientHolder) GetAll() []*Client {
 	return clients
 }
 
+// returns newest connection of user
 func (h *ClientHolder) GetByName(user string) *Client {
-	return h.clientsByName[user]
+	clients := h.clientsByName[user]
+	if len(clients) == 0 {
+		return nil
+	}
+	return clients[len(clients)-1]
 }
 
+// returns a copy of all connections of user, oldest first
+func (h *ClientHolder) GetAllByName(user string) []*Client {
+	var clients []*Client
+	return append(clients, h.clientsByName[user]...)
+}
+
+// returns a copy, so it is safe to remove clients while iterating over it
 func (h *ClientHolder) GetByRoom(room string) []*Client {
-	return h.clientsByRoom[room]
+	var clients []*Client
+	return append(clients, h.clientsByRoom[room]...)
+}
+
+func (h *ClientHolder) GetByToken(token string) *Client {
+	return h.clientsByToken[token]
+}
+
+func (h *ClientHolder) GetRooms() []string {
+	var rooms []string
+	for room := range h.clientsByRoom {
+		rooms = append(rooms, room)
+	}
+	return rooms
 }
 
+// names of users in room, listed once even when connected several times
 func (h *ClientHolder) GetRoomUsers(room string) []string {
 	var users []string
 	for _, c := range h.clientsByRoom[room] {
-		users = append(users, c.user)
+		users = h.appendUser(users, c.user)
+	}
+	return users
+}
+
+// appends user unless already listed, only users with several connections are looked up
+func (h *ClientHolder) appendUser(users []string, user string) []string {
+	if len(h.clientsByName[user]) < 2 {
+		return append(users, user)
+	}
+	for _, u := range users {
+		if u == user {
+			return users
+		}
+	}
+	return append(users, user)
+}
+
+// names of users in room that are not spectators
+func (h *ClientHolder) GetRoomPlayers(room string) []string {
+	var users []string
+	for _, c := range h.clientsByRoom[room] {
+		if !c.spectator {
+			users = h.appendUser(users, c.user)
+		}
+	}
+	return users
+}
+
+func (h *ClientHolder) GetRoomSpectators(room string) []string {
+	var users []string
+	for _, c := range h.clientsByRoom[room] {
+		if c.spectator {
+			users = h.appendUser(users, c.user)
+		}
 	}
 	return users
 }
@@ -0,0 +1,391 @@
+// Package client connects to mobster servers, reconnecting with exponential backoff
+// when connection is lost.
+//
+// After reconnect auth packet is sent again, so server side session or reconnect grace
+// resumes the user, and messages which could not be sent meanwhile are sent in order.
+// Messages written just before connection broke may still be lost, as tcp does not tell.
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaults of Config
+const (
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+	DefaultQueueSize  = 1024
+	DefaultAuthDelay  = 50 * time.Millisecond
+	// as mobster.DefaultWriteTimeout and mobster.DefaultMaxFrameSize
+	DefaultWriteTimeout = 10 * time.Second
+	DefaultMaxFrameSize = 64 * 1024
+)
+
+var (
+	// ErrClosed is returned by Send after Close or once reconnect attempts ran out
+	ErrClosed = errors.New("client closed")
+	// ErrQueueFull is returned by Send while disconnected when QueueSize messages wait already
+	ErrQueueFull = errors.New("outbound queue full")
+	// ErrFrameTooLarge is reported by OnStateChange when server message exceeds MaxFrameSize
+	ErrFrameTooLarge = errors.New("frame too large")
+)
+
+type State int
+
+const (
+	Connecting State = iota
+	Connected
+	// connection lost, waiting for next attempt
+	Reconnecting
+	// closed by Close or after MaxAttempts
+	Closed
+)
+
+func (s State) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	case Closed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+type Config struct {
+	// address of server, used by default Dial
+	Addr string
+	// opens connection, e.g. with tls.Dial, net.Dial of Addr when nil
+	Dial func() (net.Conn, error)
+	// returns auth packet sent on every connect, e.g. "a foo room" or one with fresh token
+	Auth func() string
+	// messages are length prefixed instead of newline terminated, as with
+	// mobster.FramingLengthPrefixed
+	LengthPrefixed bool
+	// delimiter of server messages with text framing, see mobster.Server.Delimiter;
+	// every read is one message when empty, as server writes them by default
+	Delimiter string
+	// pause after auth packet with text framing, so that server does not read queued
+	// messages as part of it, DefaultAuthDelay when zero
+	AuthDelay time.Duration
+	// bounds of exponential backoff between attempts, defaults when zero
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// max failed attempts in a row before client gives up, unlimited when zero
+	MaxAttempts int
+	// messages waiting for connection, DefaultQueueSize when zero
+	QueueSize int
+	// deadline of every write, connection is treated as lost when server does not
+	// read in time, DefaultWriteTimeout when zero
+	WriteTimeout time.Duration
+	// max size of server message with length prefixed or delimited framing,
+	// connection is dropped on larger ones, DefaultMaxFrameSize when zero
+	MaxFrameSize int
+
+	// called with every message from server, from single goroutine
+	OnMessage func(message string)
+	// called on every state change, err tells why connection was lost or attempt failed
+	OnStateChange func(state State, err error)
+}
+
+type Client struct {
+	cfg Config
+
+	mu    sync.Mutex
+	state State
+	conn  net.Conn
+	queue []string
+
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// connects to server, first attempt has to succeed, later ones are retried in background
+func Connect(cfg Config) (*Client, error) {
+	if cfg.Dial == nil {
+		addr := cfg.Addr
+		cfg.Dial = func() (net.Conn, error) { return net.Dial("tcp", addr) }
+	}
+	if cfg.Auth == nil {
+		return nil, errors.New("auth is required")
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.AuthDelay <= 0 {
+		cfg.AuthDelay = DefaultAuthDelay
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = DefaultWriteTimeout
+	}
+	if cfg.MaxFrameSize <= 0 {
+		cfg.MaxFrameSize = DefaultMaxFrameSize
+	}
+	c := &Client{cfg: cfg, closed: make(chan struct{}), done: make(chan struct{})}
+	if cfg.OnStateChange != nil {
+		cfg.OnStateChange(Connecting, nil)
+	}
+	conn, err := c.dial()
+	if err != nil {
+		c.setState(Closed, err)
+		return nil, err
+	}
+	c.connected(conn)
+	go c.run(conn)
+	return c, nil
+}
+
+// current state of connection
+func (c *Client) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// sends message, or queues it while disconnected
+func (c *Client) Send(message string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case Closed:
+		return ErrClosed
+	case Connected:
+		if err := c.write(c.conn, c.frame(message)); err == nil {
+			return nil
+		}
+		// reader notices broken connection and reconnects
+		c.conn.Close()
+	}
+	if len(c.queue) >= c.cfg.QueueSize {
+		return ErrQueueFull
+	}
+	c.queue = append(c.queue, message)
+	return nil
+}
+
+// closes connection and stops reconnecting, queued messages are dropped
+func (c *Client) Close() error {
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	}
+	c.mu.Unlock()
+	<-c.done
+	return nil
+}
+
+func (c *Client) dial() (net.Conn, error) {
+	conn, err := c.cfg.Dial()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write(conn, c.frameAuth(c.cfg.Auth())); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !c.cfg.LengthPrefixed {
+		select {
+		case <-time.After(c.cfg.AuthDelay):
+		case <-c.closed:
+		}
+	}
+	return conn, nil
+}
+
+// reads from connection, reconnecting when it is lost, until Close
+func (c *Client) run(conn net.Conn) {
+	defer close(c.done)
+	for {
+		err := c.read(conn)
+		conn.Close()
+		if c.isClosed() {
+			c.setState(Closed, nil)
+			return
+		}
+		if conn = c.reconnect(err); conn == nil {
+			return
+		}
+		if !c.connected(conn) {
+			conn.Close()
+			return
+		}
+	}
+}
+
+// flushes queue to fresh connection, false if client got closed meanwhile
+func (c *Client) connected(conn net.Conn) bool {
+	c.mu.Lock()
+	if c.isClosed() {
+		c.mu.Unlock()
+		c.setState(Closed, nil)
+		return false
+	}
+	c.conn = conn
+	for len(c.queue) > 0 {
+		if err := c.write(conn, c.frame(c.queue[0])); err != nil {
+			// stays queued for next connection
+			break
+		}
+		c.queue = c.queue[1:]
+	}
+	c.mu.Unlock()
+	c.setState(Connected, nil)
+	return true
+}
+
+// retries with backoff, nil when client was closed or attempts ran out
+func (c *Client) reconnect(cause error) net.Conn {
+	c.setState(Reconnecting, cause)
+	for attempt := 0; c.cfg.MaxAttempts == 0 || attempt < c.cfg.MaxAttempts; attempt++ {
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-c.closed:
+			c.setState(Closed, nil)
+			return nil
+		}
+		conn, err := c.dial()
+		if err == nil {
+			return conn
+		}
+		c.setState(Reconnecting, err)
+	}
+	c.setState(Closed, fmt.Errorf("gave up after %d attempts", c.cfg.MaxAttempts))
+	return nil
+}
+
+// exponential backoff with jitter of up to a fifth
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.MinBackoff << min(attempt, 30)
+	if d <= 0 || d > c.cfg.MaxBackoff {
+		d = c.cfg.MaxBackoff
+	}
+	return d - time.Duration(rand.Int64N(int64(d)/5+1))
+}
+
+func (c *Client) read(conn net.Conn) error {
+	if c.cfg.LengthPrefixed {
+		r := bufio.NewReader(conn)
+		var header [4]byte
+		for {
+			if _, err := io.ReadFull(r, header[:]); err != nil {
+				return err
+			}
+			size := binary.BigEndian.Uint32(header[:])
+			if size > uint32(c.cfg.MaxFrameSize) {
+				return fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size)
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return err
+			}
+			c.deliver(string(data))
+		}
+	}
+	if c.cfg.Delimiter != "" {
+		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(nil, c.cfg.MaxFrameSize)
+		scanner.Split(splitOn(c.cfg.Delimiter))
+		for scanner.Scan() {
+			c.deliver(scanner.Text())
+		}
+		if err := scanner.Err(); errors.Is(err, bufio.ErrTooLong) {
+			return ErrFrameTooLarge
+		} else if err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			c.deliver(string(buf[:n]))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func splitOn(delimiter string) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if idx := strings.Index(string(data), delimiter); idx >= 0 {
+			return idx + len(delimiter), data[:idx], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// writes with deadline, so that Send and Close do not hang on server which stopped reading
+func (c *Client) write(conn net.Conn, data []byte) error {
+	conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout))
+	_, err := conn.Write(data)
+	return err
+}
+
+func (c *Client) deliver(message string) {
+	if c.cfg.OnMessage != nil {
+		c.cfg.OnMessage(message)
+	}
+}
+
+func (c *Client) frame(message string) []byte {
+	if c.cfg.LengthPrefixed {
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(message))), message...)
+	}
+	return []byte(message + "\n")
+}
+
+// auth packet is sent alone, without newline, as server reads it as one packet
+func (c *Client) frameAuth(auth string) []byte {
+	if c.cfg.LengthPrefixed {
+		return c.frame(auth)
+	}
+	return []byte(auth)
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) setState(state State, err error) {
+	c.mu.Lock()
+	changed := c.state != state || err != nil
+	c.state = state
+	c.mu.Unlock()
+	if changed && c.cfg.OnStateChange != nil {
+		c.cfg.OnStateChange(state, err)
+	}
+}
@@ -0,0 +1,337 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prozz/mobster"
+)
+
+// starts server echoing messages back with "echo " prefix
+func startServer(t *testing.T) (*mobster.Server, string) {
+	t.Helper()
+	s := mobster.NewServer()
+	s.Delimiter = "\n"
+	s.OnMessage = func(ops *mobster.Ops, user, room, message string) {
+		if message == "kick" {
+			ops.Disconnect(user)
+			return
+		}
+		ops.SendTo(user, "echo "+message)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ServeListener(l)
+	return s, l.Addr().String()
+}
+
+type recorder struct {
+	mu       sync.Mutex
+	messages []string
+	states   []State
+}
+
+func (r *recorder) message(m string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, m)
+}
+
+func (r *recorder) state(s State, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, s)
+}
+
+func (r *recorder) waitFor(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		if len(r.messages) >= n {
+			defer r.mu.Unlock()
+			return append([]string(nil), r.messages...)
+		}
+		r.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t.Fatalf("expected %d messages, got %q", n, r.messages)
+	return nil
+}
+
+func (r *recorder) sawState(s State) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, state := range r.states {
+		if state == s {
+			return true
+		}
+	}
+	return false
+}
+
+func connect(t *testing.T, addr string, r *recorder) *Client {
+	t.Helper()
+	c, err := Connect(Config{
+		Addr:          addr,
+		Auth:          func() string { return "a foo room" },
+		Delimiter:     "\n",
+		MinBackoff:    10 * time.Millisecond,
+		MaxBackoff:    50 * time.Millisecond,
+		AuthDelay:     20 * time.Millisecond,
+		OnMessage:     r.message,
+		OnStateChange: r.state,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClient_send(t *testing.T) {
+	s, addr := startServer(t)
+	defer s.StopServer()
+	r := &recorder{}
+	c := connect(t, addr, r)
+
+	if c.State() != Connected {
+		t.Errorf("expected connected, got %v", c.State())
+	}
+	c.Send("hello")
+	c.Send("world")
+	if got := r.waitFor(t, 2); got[0] != "echo hello" || got[1] != "echo world" {
+		t.Errorf("unexpected messages %q", got)
+	}
+
+	c.Close()
+	if c.State() != Closed {
+		t.Errorf("expected closed, got %v", c.State())
+	}
+	if err := c.Send("late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestClient_reconnect(t *testing.T) {
+	s, addr := startServer(t)
+	defer s.StopServer()
+	r := &recorder{}
+	c := connect(t, addr, r)
+	defer c.Close()
+
+	c.Send("kick")
+	deadline := time.Now().Add(2 * time.Second)
+	for !r.sawState(Reconnecting) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !r.sawState(Reconnecting) {
+		t.Fatal("client did not notice lost connection")
+	}
+	c.Send("after")
+	if got := r.waitFor(t, 1); got[0] != "echo after" {
+		t.Errorf("unexpected messages %q", got)
+	}
+	if c.State() != Connected {
+		t.Errorf("expected connected, got %v", c.State())
+	}
+}
+
+func TestClient_replaysQueued(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	// first connection is dropped right after auth, nothing listens until server starts
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Read(make([]byte, 64))
+			conn.Close()
+		}
+		l.Close()
+	}()
+	r := &recorder{}
+	c := connect(t, addr, r)
+	defer c.Close()
+	for c.State() == Connected {
+		time.Sleep(time.Millisecond)
+	}
+	for _, m := range []string{"one", "two", "three"} {
+		if err := c.Send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := mobster.NewServer()
+	s.Delimiter = "\n"
+	s.OnMessage = func(ops *mobster.Ops, user, room, message string) {
+		ops.SendTo(user, "echo "+message)
+	}
+	if err := s.StartServerOn("tcp", addr); err != nil {
+		t.Fatal(err)
+	}
+	defer s.StopServer()
+
+	got := r.waitFor(t, 3)
+	if got[0] != "echo one" || got[1] != "echo two" || got[2] != "echo three" {
+		t.Errorf("queued messages not replayed in order, got %q", got)
+	}
+}
+
+func TestClient_queueFull(t *testing.T) {
+	c := &Client{cfg: Config{QueueSize: 1}, state: Reconnecting}
+	if err := c.Send("one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Send("two"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestClient_givesUp(t *testing.T) {
+	s, addr := startServer(t)
+	r := &recorder{}
+	c, err := Connect(Config{
+		Addr:          addr,
+		Auth:          func() string { return "a foo room" },
+		MinBackoff:    time.Millisecond,
+		MaxBackoff:    time.Millisecond,
+		AuthDelay:     time.Millisecond,
+		MaxAttempts:   3,
+		OnStateChange: r.state,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.StopServer()
+
+	select {
+	case <-c.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client kept reconnecting")
+	}
+	if c.State() != Closed {
+		t.Errorf("expected closed, got %v", c.State())
+	}
+	c.Close()
+}
+
+func TestClient_sendToServerNotReading(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// accepts connections but never reads from them
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	c, err := Connect(Config{
+		Addr:           l.Addr().String(),
+		Auth:           func() string { return "a foo room" },
+		LengthPrefixed: true,
+		MinBackoff:     time.Second,
+		WriteTimeout:   20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Send(string(make([]byte, 16<<20)))
+		c.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("send or close blocked on server not reading")
+	}
+}
+
+func TestClient_frameTooLarge(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte{0xff, 0xff, 0xff, 0xff})
+		conn.Read(make([]byte, 64))
+	}()
+	lost := make(chan error, 1)
+	c, err := Connect(Config{
+		Addr:           l.Addr().String(),
+		Auth:           func() string { return "a foo room" },
+		LengthPrefixed: true,
+		MinBackoff:     time.Second,
+		OnStateChange: func(state State, err error) {
+			if state == Reconnecting && err != nil {
+				select {
+				case lost <- err:
+				default:
+				}
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	select {
+	case err := <-lost:
+		if !errors.Is(err, ErrFrameTooLarge) {
+			t.Errorf("expected ErrFrameTooLarge, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("oversized frame did not drop connection")
+	}
+}
+
+func TestConnect_fails(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	if _, err := Connect(Config{Addr: addr, Auth: func() string { return "a foo room" }}); err == nil {
+		t.Error("expected error when nothing listens")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Client{cfg: Config{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}}
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		for range 20 {
+			if d := c.backoff(attempt); d > want || d < want*4/5 {
+				t.Errorf("attempt %d: backoff %v out of range of %v", attempt, d, want)
+			}
+		}
+	}
+	if d := c.backoff(100); d > time.Second {
+		t.Errorf("backoff overflowed max, got %v", d)
+	}
+}
@@ -1,6 +1,9 @@
 package mobster
 
-import "testing"
+import (
+	"net"
+	"testing"
+)
 
 func TestClientHolder_AddAndRemove(t *testing.T) {
 	h := NewClientHolder()
@@ -66,6 +69,30 @@ func TestClientHolder_GetByName(t *testing.T) {
 	}
 }
 
+func TestClientHolder_multipleConnections(t *testing.T) {
+	h := NewClientHolder()
+	phone := &Client{user: "foo", room: "1"}
+	desktop := &Client{user: "foo", room: "1"}
+	other := &Client{user: "foo", room: "2"}
+
+	h.Add(phone)
+	h.Add(desktop)
+	h.Add(other)
+
+	if h.GetByName("foo") != other || len(h.GetAllByName("foo")) != 3 {
+		t.Error("all connections should be kept, newest returned by name")
+	}
+	if users := h.GetRoomUsers("1"); len(users) != 1 || h.GetRoomCount("1") != 2 {
+		t.Errorf("user should be listed once, got %v", users)
+	}
+
+	h.Remove(other)
+	h.Remove(other)
+	if h.GetByName("foo") != desktop || !h.Has(phone) || h.Has(other) {
+		t.Error("only removed connection should be gone")
+	}
+}
+
 func TestClientHolder_GetByRoom(t *testing.T) {
 	h := NewClientHolder()
 	c1 := &Client{user: "foo", room: "1"}
@@ -109,3 +136,110 @@ func TestClientHolder_GetRoomUsers(t *testing.T) {
 		t.Error("room user names are wrong")
 	}
 }
+
+func TestClientHolder_GetRooms(t *testing.T) {
+	h := NewClientHolder()
+	c1 := &Client{user: "foo", room: "1"}
+	c2 := &Client{user: "bar", room: "2"}
+	c3 := &Client{user: "baz", room: "1"}
+
+	h.Add(c1)
+	h.Add(c2)
+	h.Add(c3)
+
+	if len(h.GetRooms()) != 2 {
+		t.Error("expected two rooms")
+	}
+
+	h.Remove(c2)
+	r := h.GetRooms()
+	if len(r) != 1 || r[0] != "1" {
+		t.Error("empty room should be gone")
+	}
+}
+
+func TestClientHolder_GetByToken(t *testing.T) {
+	h := NewClientHolder()
+	c := &Client{user: "foo", token: "abc"}
+
+	h.Add(c)
+	if h.GetByToken("abc") != c {
+		t.Error("wrong client")
+	}
+
+	h.Remove(c)
+	if h.GetByToken("abc") != nil {
+		t.Error("not cleaned up")
+	}
+}
+
+func TestClientHolder_GetRoomPlayersAndSpectators(t *testing.T) {
+	h := NewClientHolder()
+	h.Add(&Client{user: "foo", room: "1"})
+	h.Add(&Client{user: "bar", room: "1", spectator: true})
+	h.Add(&Client{user: "baz", room: "2"})
+
+	players := h.GetRoomPlayers("1")
+	if len(players) != 1 || players[0] != "foo" {
+		t.Errorf("wrong players: %v", players)
+	}
+	spectators := h.GetRoomSpectators("1")
+	if len(spectators) != 1 || spectators[0] != "bar" {
+		t.Errorf("wrong spectators: %v", spectators)
+	}
+	if h.GetRoomCount("1") != 2 {
+		t.Error("room count should include spectators")
+	}
+}
+
+type fakeConn struct {
+	written []string
+	closed  bool
+}
+
+func (c *fakeConn) Write(b []byte) (int, error) {
+	c.written = append(c.written, string(b))
+	return len(b), nil
+}
+func (c *fakeConn) Close() error         { c.closed = true; return nil }
+func (c *fakeConn) RemoteAddr() net.Addr { return &net.UnixAddr{Name: "fake", Net: "fake"} }
+
+func TestClientConn_fake(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	conn := &fakeConn{}
+	c := NewClient("foo", "123", conn)
+	s.clientHolder.Add(c)
+
+	ops := &Ops{s}
+	ops.SendToRoom("123", "hello")
+	info, _ := ops.GetClientInfo("foo")
+	ops.Disconnect("foo")
+
+	if len(conn.written) != 1 || conn.written[0] != "hello" {
+		t.Errorf("unexpected writes %q", conn.written)
+	}
+	if !conn.closed {
+		t.Error("connection not closed")
+	}
+	if info.Transport != "fake" || info.ConnectedAt.IsZero() {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
+
+func TestClient_accessors(t *testing.T) {
+	c := NewClient("foo", "123", &fakeConn{})
+	c.spectator = true
+	if c.User() != "foo" || c.Room() != "123" || c.RemoteAddr().String() != "fake" || !c.IsSpectator() || c.IsBot() {
+		t.Errorf("wrong accessors of %+v", c)
+	}
+	if info := c.Info(); info.User != "foo" || info.Transport != "fake" {
+		t.Errorf("wrong info %+v", info)
+	}
+
+	h := NewClientHolder()
+	h.Add(c)
+	if all := h.GetAll(); len(all) != 1 || all[0].User() != "foo" {
+		t.Error("client not usable from holder results")
+	}
+}
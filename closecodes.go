@@ -0,0 +1,112 @@
+package mobster
+
+import "time"
+
+// reason of disconnect, sent to clients as final frame when SendCloseCodes is set
+type CloseCode int
+
+const (
+	// connection failed or client closed it, nothing is sent then
+	CloseLost CloseCode = iota
+	CloseAuthFailed
+	CloseKicked
+	CloseIdle
+	CloseShutdown
+	CloseRoomClosed
+	CloseJoinDenied
+	CloseBanned
+	CloseRoomFull
+	// user connected again and DuplicateKickOld dropped this connection
+	CloseLoggedInElsewhere
+)
+
+func (c CloseCode) String() string {
+	switch c {
+	case CloseLost:
+		return "lost"
+	case CloseAuthFailed:
+		return "auth_failed"
+	case CloseKicked:
+		return "kicked"
+	case CloseIdle:
+		return "idle"
+	case CloseShutdown:
+		return "shutdown"
+	case CloseRoomClosed:
+		return "room_closed"
+	case CloseJoinDenied:
+		return "join_denied"
+	case CloseBanned:
+		return "banned"
+	case CloseRoomFull:
+		return "room_full"
+	case CloseLoggedInElsewhere:
+		return "logged_in_elsewhere"
+	default:
+		return "unknown"
+	}
+}
+
+// default final frame is "close <code name>", e.g. "close kicked"
+func formatClose(code CloseCode) string {
+	return "close " + code.String()
+}
+
+// best effort write of final frame, failures are not reported as connection is closed anyway
+func (s *Server) sendClose(conn ClientConn, codec Codec, code CloseCode) {
+	s.writeClose(conn, s.closeFrame(codec, code))
+}
+
+// final frame telling close code, nil when none is sent
+func (s *Server) closeFrame(codec Codec, code CloseCode) []byte {
+	if !s.SendCloseCodes || code == CloseLost {
+		return nil
+	}
+	message := []byte(s.FormatClose(code))
+	if codec != nil {
+		encoded, err := codec.Encode(message)
+		if err != nil {
+			return nil
+		}
+		message = encoded
+	}
+	return s.frame(message)
+}
+
+// writes final frame unless it is nil, called from processing loop or mailboxes
+func (s *Server) writeClose(conn ClientConn, frame []byte) {
+	if frame == nil {
+		return
+	}
+	// client not reading must not stall writer
+	if dc, ok := conn.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		timeout := s.WriteTimeout
+		if timeout <= 0 {
+			timeout = closeWriteTimeout
+		}
+		dc.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	conn.Write(frame)
+}
+
+// write deadline of final frame when WriteTimeout is not set, like for rejected connections
+const closeWriteTimeout = 1 * time.Second
+
+// closes client connection sending close code first and forgets client without calling
+// OnDisconnect, must be called from processingLoop only
+func (s *Server) closeClient(c *Client, code CloseCode) {
+	s.auditf(c.room, c.user, "disconnect", "%s: %s disconnects (%s)", c.room, c.user, code)
+	s.closeConn(c, code)
+	s.removeClient(c)
+}
+
+// disconnect user telling it why, e.g. CloseIdle for users away for too long;
+// like Disconnect, OnDisconnect is not called
+func (o *Ops) DisconnectWithCode(user string, code CloseCode) {
+	for _, c := range o.server.clientHolder.GetAllByName(user) {
+		if code == CloseKicked {
+			o.server.publish(EventKick, c.user, c.room, "")
+		}
+		o.server.closeClient(c, code)
+	}
+}
@@ -0,0 +1,70 @@
+package mobster
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCloseCodes(t *testing.T) {
+	codes := make(map[string]CloseCode)
+	s := NewServer()
+	s.SendCloseCodes = true
+	s.OnDisconnectCode = func(ops *Ops, user, room string, code CloseCode) {
+		codes[user] = code
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		if message == "afk" {
+			ops.DisconnectWithCode(user, CloseIdle)
+		}
+	}
+	s.StartServer(4009)
+
+	malformed := connectAndSend(t, "malformed")
+	if msg := readFromServer(t, malformed); msg != "close auth_failed" {
+		t.Errorf("expected auth failure code, got %q", msg)
+	}
+
+	foo := connectAndSend(t, "a foo 123")
+	bar := connectAndSend(t, "a bar 123")
+	baz := connectAndSend(t, "a baz 123")
+	s.Disconnect("foo")
+	if msg := readFromServer(t, foo); msg != "close kicked" {
+		t.Errorf("expected kick code, got %q", msg)
+	}
+	send(t, bar, "afk")
+	if msg := readFromServer(t, bar); msg != "close idle" {
+		t.Errorf("expected idle code, got %q", msg)
+	}
+
+	s.StopServer()
+	if msg := readFromServer(t, baz); msg != "close shutdown" {
+		t.Errorf("expected shutdown code, got %q", msg)
+	}
+
+	if codes["foo"] != CloseKicked || codes["baz"] != CloseShutdown {
+		t.Errorf("unexpected codes passed to OnDisconnectCode: %v", codes)
+	}
+	if _, found := codes["bar"]; found {
+		t.Error("ops disconnect should not call OnDisconnectCode")
+	}
+}
+
+func TestSendClose_notReading(t *testing.T) {
+	s := NewServer()
+	s.SendCloseCodes = true
+	s.WriteTimeout = 20 * time.Millisecond
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	done := make(chan bool)
+	go func() {
+		s.sendClose(local, nil, CloseKicked)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("close frame to client not reading should not block")
+	}
+}
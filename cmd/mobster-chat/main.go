@@ -0,0 +1,164 @@
+// mobster-chat is a small chat server built on mobster, meant as runnable example.
+//
+// Clients connect with plain tcp (or tls) and authenticate with "a <username> [<room>]",
+// users without room land in default one. Besides chatting, clients can use
+// "/who", "/join <room>" and "/me <action>". Started with -connect it acts as
+// a line based client, relaying stdin to server and server messages to stdout.
+//
+//	mobster-chat -port 4000 -room lobby
+//	mobster-chat -connect localhost:4000 -user alice
+//
+// On SIGINT or SIGTERM clients are warned and server stops after -shutdown-grace.
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prozz/mobster"
+)
+
+func main() {
+	port := flag.Int("port", 4000, "port to listen on")
+	room := flag.String("room", "lobby", "room of users authenticating without one")
+	certFile := flag.String("tls-cert", "", "tls certificate file, enables tls together with -tls-key")
+	keyFile := flag.String("tls-key", "", "tls private key file")
+	grace := flag.Duration("shutdown-grace", 10*time.Second, "how long clients are warned before shutdown")
+	connect := flag.String("connect", "", "run as client connecting to given address instead")
+	user := flag.String("user", "", "username of client")
+	useTLS := flag.Bool("tls", false, "connect with tls as client")
+	insecure := flag.Bool("insecure", false, "skip tls certificate verification as client")
+	flag.Parse()
+
+	if *connect != "" {
+		if err := runClient(*connect, *user, *room, *useTLS, *insecure); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	s := newChatServer(*room)
+	listener, err := listen(*port, *certFile, *keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.ServeListener(listener)
+	waitForShutdown(s, *grace)
+}
+
+func newChatServer(defaultRoom string) *mobster.Server {
+	s := mobster.NewServer()
+	s.Delimiter = "\n"
+	s.OnAuth = func(message string) (string, string, error) {
+		if tokens := strings.Fields(message); len(tokens) == 2 && tokens[0] == "a" {
+			message = message + " " + defaultRoom
+		}
+		auth, err := mobster.ParseAuth(message)
+		return auth.Username, auth.Room, err
+	}
+	s.OnConnect = func(ops *mobster.Ops, user, room string) {
+		ops.SendToRoom(room, fmt.Sprintf("* %s joined %s", user, room))
+	}
+	s.OnDisconnect = func(ops *mobster.Ops, user, room string) {
+		ops.SendToRoom(room, fmt.Sprintf("* %s left", user))
+	}
+	s.OnMessage = func(ops *mobster.Ops, user, room, message string) {
+		ops.SendToRoom(room, fmt.Sprintf("<%s> %s", user, message))
+	}
+	s.OnError = func(user, op string, err error) {
+		log.Printf("%s: %s: %s", user, op, err)
+	}
+	s.Handle("/who", func(ops *mobster.Ops, user, room, args string) {
+		ops.SendTo(user, "* in "+room+": "+strings.Join(ops.GetRoomUsers(room), ", "))
+	})
+	s.Handle("/me", func(ops *mobster.Ops, user, room, args string) {
+		ops.SendToRoom(room, fmt.Sprintf("* %s %s", user, args))
+	})
+	s.Handle("/join", func(ops *mobster.Ops, user, room, args string) {
+		target := strings.TrimSpace(args)
+		if target == "" || target == room {
+			ops.SendTo(user, "* usage: /join <room>")
+			return
+		}
+		if err := ops.MoveToRoom(user, target); err != nil {
+			ops.SendTo(user, "* cannot join "+target+": "+err.Error())
+			return
+		}
+		ops.SendToRoom(room, fmt.Sprintf("* %s went to %s", user, target))
+		ops.SendToRoom(target, fmt.Sprintf("* %s joined %s", user, target))
+	})
+	return s
+}
+
+func listen(port int, certFile, keyFile string) (net.Listener, error) {
+	address := fmt.Sprintf(":%d", port)
+	if certFile == "" && keyFile == "" {
+		return net.Listen("tcp", address)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", address, &tls.Config{Certificates: []tls.Certificate{cert}})
+}
+
+// warns clients on first signal and stops server after grace, second signal stops it at once
+func waitForShutdown(s *mobster.Server, grace time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	log.Printf("stopping in %s, signal again to stop now", grace)
+	s.ScheduleShutdown(time.Now().Add(grace), []mobster.NoticeSchedule{{Before: grace}})
+	select {
+	case <-signals:
+	case <-time.After(grace):
+	}
+	s.StopServer()
+}
+
+func runClient(address, user, room string, useTLS, insecure bool) error {
+	if user == "" {
+		return fmt.Errorf("-user is required with -connect")
+	}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: insecure})
+	} else {
+		conn, err = net.Dial("tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintf(conn, "a %s %s", user, room); err != nil {
+		return err
+	}
+	go func() {
+		lines := bufio.NewScanner(os.Stdin)
+		for lines.Scan() {
+			if _, err := fmt.Fprintln(conn, lines.Text()); err != nil {
+				break
+			}
+		}
+		conn.Close()
+	}()
+	_, err = io.Copy(os.Stdout, conn)
+	if errors.Is(err, net.ErrClosed) {
+		// stdin ended
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestAuth_defaultRoom(t *testing.T) {
+	s := newChatServer("lobby")
+	if user, room, err := s.OnAuth("a alice"); err != nil || user != "alice" || room != "lobby" {
+		t.Errorf("unexpected auth %s %s %v", user, room, err)
+	}
+	if _, room, err := s.OnAuth("a alice games"); err != nil || room != "games" {
+		t.Errorf("unexpected room %s %v", room, err)
+	}
+	if _, _, err := s.OnAuth("alice"); err == nil {
+		t.Error("malformed auth should fail")
+	}
+}
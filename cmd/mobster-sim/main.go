@@ -0,0 +1,56 @@
+// mobster-sim runs client scenario scripts against running mobster server, reporting
+// failed steps; see package sim for script format.
+//
+//	mobster-sim -addr localhost:4000 -delimiter '\n' scenarios/*.sim
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prozz/mobster/sim"
+)
+
+func main() {
+	var opts sim.Options
+	var delimiter string
+	flag.StringVar(&opts.Addr, "addr", "localhost:4000", "address of server")
+	flag.StringVar(&delimiter, "delimiter", "", `delimiter of server messages, quoted like "\n"`)
+	flag.BoolVar(&opts.LengthPrefixed, "length-prefixed", false, "use length prefixed framing")
+	flag.DurationVar(&opts.Timeout, "timeout", sim.DefaultTimeout, "initial timeout of steps waiting for server")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: mobster-sim [flags] script...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	d, err := strconv.Unquote(`"` + delimiter + `"`)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bad -delimiter: %v\n", err)
+		os.Exit(2)
+	}
+	opts.Delimiter = d
+	if failed := run(os.Stdout, flag.Args(), opts); failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runs scripts one by one, returns number of failed ones
+func run(w io.Writer, paths []string, opts sim.Options) int {
+	failed := 0
+	for _, path := range paths {
+		start := time.Now()
+		if err := sim.RunFile(path, opts); err != nil {
+			fmt.Fprintf(w, "FAIL %s\n\t%v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "ok   %s %s\n", path, time.Since(start).Round(time.Millisecond))
+	}
+	return failed
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prozz/mobster"
+	"github.com/prozz/mobster/sim"
+)
+
+func TestRun(t *testing.T) {
+	s := mobster.NewServer()
+	s.Delimiter = "\n"
+	s.OnMessage = func(ops *mobster.Ops, user, room, message string) {
+		ops.SendTo(user, "echo "+message)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ServeListener(l)
+	defer s.StopServer()
+
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "ok.sim")
+	bad := filepath.Join(dir, "bad.sim")
+	os.WriteFile(ok, []byte("connect a a a r\nsend a hi\nexpect a echo hi\n"), 0o644)
+	os.WriteFile(bad, []byte("timeout 50ms\nconnect a a a r\nsend a hi\nexpect a hi\n"), 0o644)
+
+	var out strings.Builder
+	failed := run(&out, []string{ok, bad}, sim.Options{Addr: l.Addr().String(), Delimiter: "\n"})
+	if failed != 1 {
+		t.Errorf("expected one failed script, got %d:\n%s", failed, out.String())
+	}
+	if !strings.Contains(out.String(), "ok   "+ok) || !strings.Contains(out.String(), "FAIL "+bad) {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `bad.sim:4: expect a: expected "hi", got "echo hi"`) {
+		t.Errorf("failed step should be reported:\n%s", out.String())
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const markerPrefix = "mb:"
+
+// time given to server to handle auth packet before first message
+const authDelay = 50 * time.Millisecond
+
+// longest marker body, client id and unix nanos
+const maxMarkerSize = 40
+
+// outcome of benchmark run
+type report struct {
+	connected     int
+	connectErrors int
+	writeErrors   int
+	readErrors    int
+	sent          int
+	received      int
+	elapsed       time.Duration
+	// sorted
+	latencies []time.Duration
+}
+
+func (r *report) errors() int {
+	return r.connectErrors + r.writeErrors + r.readErrors
+}
+
+// returns latency below which given fraction of samples falls
+func (r *report) percentile(q float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	idx := int(q*float64(len(r.latencies))+0.5) - 1
+	return r.latencies[min(max(idx, 0), len(r.latencies)-1)]
+}
+
+// results of single client, merged into report at the end
+type clientResult struct {
+	connected   bool
+	writeErrors int
+	readErrors  int
+	sent        int
+	latencies   []time.Duration
+}
+
+func run(cfg config) *report {
+	start := time.Now()
+	stop := time.Now().Add(cfg.duration)
+	results := make([]clientResult, cfg.clients)
+	var wg sync.WaitGroup
+	for i := range cfg.clients {
+		room := i % cfg.rooms
+		// clients of room share its rate
+		inRoom := cfg.clients / cfg.rooms
+		if room < cfg.clients%cfg.rooms {
+			inRoom++
+		}
+		interval := time.Duration(float64(time.Second) * float64(inRoom) / cfg.rate)
+		user := fmt.Sprintf("%s%d", cfg.prefix, i)
+		roomName := fmt.Sprintf("%s-room%d", cfg.prefix, room)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runClient(cfg, i, user, roomName, interval, stop)
+		}()
+	}
+	wg.Wait()
+
+	r := &report{elapsed: time.Since(start)}
+	for _, res := range results {
+		if res.connected {
+			r.connected++
+		} else {
+			r.connectErrors++
+		}
+		r.writeErrors += res.writeErrors
+		r.readErrors += res.readErrors
+		r.sent += res.sent
+		r.received += len(res.latencies)
+		r.latencies = append(r.latencies, res.latencies...)
+	}
+	slices.Sort(r.latencies)
+	return r
+}
+
+func runClient(cfg config, id int, user, room string, interval time.Duration, stop time.Time) clientResult {
+	var res clientResult
+	conn, err := net.DialTimeout("tcp", cfg.addr, 5*time.Second)
+	if err != nil {
+		return res
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintf(conn, cfg.auth, user, room); err != nil {
+		return res
+	}
+	res.connected = true
+
+	latencies := make(chan []time.Duration, 1)
+	go func() {
+		var got []time.Duration
+		defer func() { latencies <- got }()
+		var pending []byte
+		buf := make([]byte, 4096)
+		conn.SetReadDeadline(stop.Add(cfg.drain))
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				var sent []time.Time
+				sent, pending = parseMarkers(append(pending, buf[:n]...))
+				now := time.Now()
+				for _, t := range sent {
+					got = append(got, now.Sub(t))
+				}
+			}
+			if err != nil {
+				if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+					res.readErrors++
+				}
+				return
+			}
+		}
+	}()
+
+	// auth packet has to arrive alone, first messages are spread over interval,
+	// so that clients do not send in bursts
+	time.Sleep(authDelay + time.Duration(id%64)*interval/64)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for time.Now().Before(stop) {
+		if _, err := conn.Write(message(id, time.Now(), cfg.size)); err != nil {
+			res.writeErrors++
+			break
+		}
+		res.sent++
+		<-ticker.C
+	}
+	res.latencies = <-latencies
+	return res
+}
+
+// builds newline terminated message carrying marker "mb:<client>:<unix nanos>;",
+// padded to size
+func message(id int, now time.Time, size int) []byte {
+	msg := fmt.Appendf(nil, "%s%d:%d;", markerPrefix, id, now.UnixNano())
+	for len(msg) < size-1 {
+		msg = append(msg, 'x')
+	}
+	return append(msg, '\n')
+}
+
+// finds complete markers in data, returns their send times and unparsed rest,
+// which may hold beginning of marker split between reads
+func parseMarkers(data []byte) (sent []time.Time, rest []byte) {
+	for {
+		idx := bytes.Index(data, []byte(markerPrefix))
+		if idx < 0 {
+			// keep bytes which may start the prefix
+			keep := min(len(data), len(markerPrefix)-1)
+			return sent, slices.Clone(data[len(data)-keep:])
+		}
+		data = data[idx+len(markerPrefix):]
+		end := bytes.IndexByte(data, ';')
+		if end < 0 {
+			if len(data) > maxMarkerSize {
+				// not a marker, e.g. message text containing prefix
+				continue
+			}
+			return sent, slices.Clone(append([]byte(markerPrefix), data...))
+		}
+		marker := data[:end]
+		data = data[end+1:]
+		colon := bytes.IndexByte(marker, ':')
+		if colon < 0 {
+			continue
+		}
+		nanos, err := strconv.ParseInt(string(marker[colon+1:]), 10, 64)
+		if err != nil {
+			continue
+		}
+		sent = append(sent, time.Unix(0, nanos))
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMarkers(t *testing.T) {
+	now := time.Unix(0, time.Now().UnixNano())
+	msg := message(7, now, 64)
+	if len(msg) != 64 {
+		t.Errorf("message should be padded to size, got %d", len(msg))
+	}
+	data := append([]byte("<bench7> "), msg...)
+	data = append(data, "<bench1> mb:1:12"...)
+
+	sent, rest := parseMarkers(data)
+	if len(sent) != 1 || !sent[0].Equal(now) {
+		t.Errorf("unexpected send times %v", sent)
+	}
+	sent, rest = parseMarkers(append(rest, "34;"...))
+	if len(sent) != 1 || sent[0].UnixNano() != 1234 || len(rest) != 0 {
+		t.Errorf("marker split between reads should be parsed, got %v, rest %q", sent, rest)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	r := &report{}
+	for i := 1; i <= 100; i++ {
+		r.latencies = append(r.latencies, time.Duration(i)*time.Millisecond)
+	}
+	if p := r.percentile(0.5); p != 50*time.Millisecond {
+		t.Errorf("unexpected p50 %s", p)
+	}
+	if p := r.percentile(0.99); p != 99*time.Millisecond {
+		t.Errorf("unexpected p99 %s", p)
+	}
+	if p := r.percentile(1); p != 100*time.Millisecond {
+		t.Errorf("unexpected max %s", p)
+	}
+}
@@ -0,0 +1,66 @@
+// mobsterbench load tests running mobster server with scripted clients.
+//
+// Clients are spread over rooms round robin, authenticate with -auth format and send
+// messages at -rate per room, split evenly between clients of the room. Every message
+// carries marker with send time, so latency is measured whenever any client receives
+// it back, which works with servers broadcasting messages to room in any format that
+// keeps message text intact.
+//
+//	mobsterbench -addr localhost:4000 -clients 200 -rooms 10 -rate 50 -duration 30s
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.addr, "addr", "localhost:4000", "address of server")
+	flag.IntVar(&cfg.clients, "clients", 10, "number of concurrent clients")
+	flag.IntVar(&cfg.rooms, "rooms", 1, "number of rooms clients are spread over")
+	flag.Float64Var(&cfg.rate, "rate", 10, "messages per second sent to each room")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "how long messages are sent")
+	flag.DurationVar(&cfg.drain, "drain", time.Second, "how long to wait for messages in flight afterwards")
+	flag.IntVar(&cfg.size, "size", 32, "message size in bytes, marker included")
+	flag.StringVar(&cfg.auth, "auth", "a %s %s", "auth packet format, gets username and room")
+	flag.StringVar(&cfg.prefix, "prefix", "bench", "prefix of usernames and rooms")
+	flag.Parse()
+
+	if cfg.clients <= 0 || cfg.rooms <= 0 || cfg.rate <= 0 {
+		log.Fatal("-clients, -rooms and -rate have to be positive")
+	}
+	r := run(cfg)
+	r.print(os.Stdout)
+	if r.errors() > 0 {
+		os.Exit(1)
+	}
+}
+
+type config struct {
+	addr     string
+	clients  int
+	rooms    int
+	rate     float64
+	duration time.Duration
+	drain    time.Duration
+	size     int
+	auth     string
+	prefix   string
+}
+
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "clients: %d connected, %d failed\n", r.connected, r.connectErrors)
+	fmt.Fprintf(w, "messages: %d sent, %d received, %.1f/s received\n", r.sent, r.received, float64(r.received)/r.elapsed.Seconds())
+	fmt.Fprintf(w, "errors: %d write, %d read\n", r.writeErrors, r.readErrors)
+	if len(r.latencies) == 0 {
+		fmt.Fprintln(w, "latency: no messages received")
+		return
+	}
+	fmt.Fprintf(w, "latency: p50 %s, p90 %s, p99 %s, max %s\n",
+		r.percentile(0.5), r.percentile(0.9), r.percentile(0.99), r.percentile(1))
+}
@@ -0,0 +1,64 @@
+package mobster
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sync"
+)
+
+// transforms messages of single client on their way to and from the wire;
+// codecs producing binary output need length prefixed framing
+type Codec interface {
+	Encode(message []byte) ([]byte, error)
+	Decode(message []byte) ([]byte, error)
+}
+
+// compresses every message separately with deflate, safe for concurrent use
+type FlateCodec struct {
+	level int
+	// max size of decompressed message, protects against decompression bombs
+	maxSize int
+	writers sync.Pool
+}
+
+// level as in compress/flate, decompressed inbound messages are limited to DefaultMaxFrameSize
+func NewFlateCodec(level int) (*FlateCodec, error) {
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		return nil, err
+	}
+	return &FlateCodec{level: level, maxSize: DefaultMaxFrameSize}, nil
+}
+
+func (c *FlateCodec) Encode(message []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, _ := c.writers.Get().(*flate.Writer)
+	if w == nil {
+		w, _ = flate.NewWriter(&buf, c.level)
+	} else {
+		w.Reset(&buf)
+	}
+	defer c.writers.Put(w)
+
+	if _, err := w.Write(message); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *FlateCodec) Decode(message []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(message))
+	defer r.Close()
+	decoded, err := io.ReadAll(io.LimitReader(r, int64(c.maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > c.maxSize {
+		return nil, errors.New("decompressed message too big")
+	}
+	return decoded, nil
+}
@@ -0,0 +1,79 @@
+package mobster
+
+import (
+	"bytes"
+	"compress/flate"
+	"strings"
+	"testing"
+)
+
+func TestFlateCodec(t *testing.T) {
+	codec, err := NewFlateCodec(flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := []byte(strings.Repeat(`{"x": 1, "y": 2}`, 100))
+	encoded, err := codec.Encode(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded) >= len(message) {
+		t.Error("message not compressed")
+	}
+
+	decoded, err := codec.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, message) {
+		t.Error("message changed after roundtrip")
+	}
+}
+
+func TestFlateCodec_bomb(t *testing.T) {
+	codec, _ := NewFlateCodec(flate.BestCompression)
+	encoded, _ := codec.Encode(make([]byte, DefaultMaxFrameSize+1))
+
+	if _, err := codec.Decode(encoded); err == nil {
+		t.Error("expected error for too big message")
+	}
+}
+
+func TestFlow_compressedEcho(t *testing.T) {
+	codec, _ := NewFlateCodec(flate.DefaultCompression)
+	s := NewServer()
+	s.Framing = FramingLengthPrefixed
+	s.OnAuth = func(message string) (string, string, error) {
+		return "foo", "123", nil
+	}
+	s.OnSelectCodec = func(user, room, authMessage string) Codec {
+		if authMessage == "flate" {
+			return codec
+		}
+		return nil
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendTo(name, strings.ToUpper(message))
+	}
+	s.StartServer(4009)
+
+	c := connect(t)
+	sendFrame(t, c, []byte("flate"))
+	encoded, _ := codec.Encode([]byte("hello"))
+	sendFrame(t, c, encoded)
+
+	response := []byte(readFromServer(t, c))
+	if len(response) < frameHeaderSize {
+		t.Fatal("no response")
+	}
+	decoded, err := codec.Decode(response[frameHeaderSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != "HELLO" {
+		t.Errorf("expected compressed response, got %q", decoded)
+	}
+
+	s.StopServer()
+}
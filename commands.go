@@ -0,0 +1,48 @@
+package mobster
+
+import "strings"
+
+// handles command registered with Handle, args is message without command word
+type CommandHandler func(ops *Ops, user, room, args string)
+
+// route messages starting with given word to handler instead of OnMessage,
+// has to be called before server starts
+func (s *Server) Handle(command string, handler CommandHandler) {
+	if s.commands == nil {
+		s.commands = make(map[string]CommandHandler)
+	}
+	s.commands[command] = handler
+}
+
+// splits message into first word and the rest
+func splitCommand(message string) (command, args string) {
+	message = strings.TrimLeft(message, " \t")
+	idx := strings.IndexAny(message, " \t")
+	if idx < 0 {
+		return message, ""
+	}
+	return message[:idx], strings.TrimLeft(message[idx+1:], " \t")
+}
+
+// dispatches message to json-rpc method, command handler, OnUnknownCommand or OnMessage,
+// in that order; must be called from processingLoop only
+func (s *Server) dispatch(ops *Ops, user, room, message string) {
+	if len(s.rpcMethods) > 0 && isRPC(message) {
+		s.handleRPC(ops, user, room, message)
+		return
+	}
+	if len(s.commands) == 0 {
+		s.onMessage(ops, user, room, message)
+		return
+	}
+	command, args := splitCommand(message)
+	if handler, ok := s.commands[command]; ok {
+		handler(ops, user, room, args)
+		return
+	}
+	if s.OnUnknownCommand != nil {
+		s.OnUnknownCommand(ops, user, room, command, args)
+		return
+	}
+	s.onMessage(ops, user, room, message)
+}
@@ -0,0 +1,42 @@
+package mobster
+
+import "testing"
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct{ in, command, args string }{
+		{"move e2 e4", "move", "e2 e4"},
+		{"  say   hello  world", "say", "hello  world"},
+		{"quit", "quit", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		command, args := splitCommand(test.in)
+		if command != test.command || args != test.args {
+			t.Errorf("%q: expected %q %q, got %q %q", test.in, test.command, test.args, command, args)
+		}
+	}
+}
+
+func TestFlow_commands(t *testing.T) {
+	var calls []string
+	s := NewServer()
+	s.Handle("move", func(ops *Ops, name, room, args string) {
+		calls = append(calls, "move:"+args)
+	})
+	s.OnUnknownCommand = func(ops *Ops, name, room, command, args string) {
+		calls = append(calls, "unknown:"+command)
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		calls = append(calls, "message:"+message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	send(t, c, "move e2 e4", "resign now")
+
+	s.StopServer()
+
+	if len(calls) != 2 || calls[0] != "move:e2 e4" || calls[1] != "unknown:resign" {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+}
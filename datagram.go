@@ -0,0 +1,122 @@
+package mobster
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// datagrams are "<token> <payload>", where token is the one assigned to client on tcp auth
+const datagramTokenSize = 16
+
+// max number of datagrams waiting for processingLoop, next ones are dropped
+const datagramQueueSize = 64
+
+type datagram struct {
+	token   string
+	addr    net.Addr
+	payload []byte
+}
+
+// starts listening for datagrams on given udp port, next to tcp server
+func (s *Server) StartDatagrams(port int) {
+	log.Printf("starting datagrams on port %d", port)
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatal("cannot listen:", err)
+	}
+
+	s.ServeDatagrams(conn)
+}
+
+// starts reading datagrams from packet connection created by caller,
+// connection is closed by StopServer
+func (s *Server) ServeDatagrams(conn net.PacketConn) {
+	log.Printf("serving datagrams on %s", conn.LocalAddr())
+	s.packetConn = conn
+
+	s.shutdownWaitGroup.Add(1)
+	go s.datagramLoop()
+}
+
+func (s *Server) datagramLoop() {
+	defer s.shutdownWaitGroup.Done()
+	var buf [64 * 1024]byte
+	for {
+		n, addr, err := s.packetConn.ReadFrom(buf[0:])
+		if s.shutdownMode || errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			s.OnError("", "datagram", err)
+			continue
+		}
+		d, err := parseDatagram(buf[:n])
+		if err != nil {
+			s.OnError("", "datagram", err)
+			continue
+		}
+		d.addr = addr
+		// it is unreliable anyway, so drop instead of blocking on slow processing
+		select {
+		case s.incomingDatagrams <- d:
+		default:
+		}
+	}
+}
+
+func parseDatagram(data []byte) (datagram, error) {
+	idx := bytes.IndexByte(data, ' ')
+	if idx != 2*datagramTokenSize {
+		return datagram{}, errors.New("malformed datagram")
+	}
+	payload := make([]byte, len(data)-idx-1)
+	copy(payload, data[idx+1:])
+	return datagram{token: string(data[:idx]), payload: payload}, nil
+}
+
+func newDatagramToken() string {
+	var token [datagramTokenSize]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(token[:])
+}
+
+// must be called from processingLoop only
+func (s *Server) handleDatagram(d datagram) {
+	c := s.clientHolder.GetByToken(d.token)
+	if c == nil {
+		return
+	}
+	// remember last address, it may change due to nat rebinding
+	c.datagramAddr = d.addr
+	c.lastActivity = time.Now()
+	s.OnDatagram(&Ops{s}, c.user, c.room, d.payload)
+}
+
+// get token that client has to prefix its datagrams with
+func (o *Ops) GetDatagramToken(user string) string {
+	c := o.server.clientHolder.GetByName(user)
+	if c == nil {
+		return ""
+	}
+	return c.token
+}
+
+// send datagram to given user, dropped silently when user did not send any
+// datagram yet, so that its address is unknown
+func (o *Ops) SendUnreliable(user string, payload []byte) {
+	c := o.server.clientHolder.GetByName(user)
+	if c == nil || c.datagramAddr == nil || o.server.packetConn == nil {
+		return
+	}
+	if _, err := o.server.packetConn.WriteTo(payload, c.datagramAddr); err != nil {
+		o.server.OnError(user, "datagram", err)
+	}
+}
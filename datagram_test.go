@@ -0,0 +1,60 @@
+package mobster
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseDatagram(t *testing.T) {
+	token := newDatagramToken()
+	d, err := parseDatagram([]byte(token + " x y"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.token != token || string(d.payload) != "x y" {
+		t.Error("wrong datagram parsed")
+	}
+
+	if _, err := parseDatagram([]byte("short x")); err == nil {
+		t.Error("expected error for malformed datagram")
+	}
+}
+
+func TestFlow_datagramEcho(t *testing.T) {
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		ops.SendTo(name, ops.GetDatagramToken(name))
+	}
+	s.OnDatagram = func(ops *Ops, name, room string, payload []byte) {
+		ops.SendUnreliable(name, payload)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ServeDatagrams(pc)
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	token := readFromServer(t, c)
+
+	u, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	u.Write([]byte(token + " pos 1 2"))
+
+	u.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	var buf [512]byte
+	n, err := u.Read(buf[0:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "pos 1 2" {
+		t.Errorf("expected datagram echo, got %q", buf[:n])
+	}
+
+	s.StopServer()
+}
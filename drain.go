@@ -0,0 +1,38 @@
+package mobster
+
+import "log"
+
+// Drain makes server reject new connections, sending them DrainingMessage if set,
+// while clients connected already are served as usual; returned channel is closed
+// when the last of them leaves (bots do not count) or server stops, call StopServer then.
+// Server drained before start closes the channel as soon as it starts.
+func (s *Server) Drain() <-chan struct{} {
+	if !s.draining.Swap(true) {
+		log.Printf("draining, no new connections accepted")
+		// loop not running yet checks it on start, stopped one has closed drained already
+		toLoop(s, s.drainStarts, true)
+	}
+	return s.drained
+}
+
+// must be called from processingLoop only
+func (s *Server) checkDrained() {
+	if !s.draining.Load() || s.drainedDone {
+		return
+	}
+	for _, c := range s.clientHolder.GetAll() {
+		if c.bot == nil {
+			return
+		}
+	}
+	log.Printf("drained, all clients gone")
+	s.closeDrained()
+}
+
+// must be called from processingLoop only
+func (s *Server) closeDrained() {
+	if !s.drainedDone {
+		s.drainedDone = true
+		close(s.drained)
+	}
+}
@@ -0,0 +1,60 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	var connected []string
+	s := NewServer()
+	s.DrainingMessage = "draining"
+	s.OnConnect = func(ops *Ops, name, room string) {
+		connected = append(connected, name)
+	}
+	s.StartServer(4009)
+
+	foo := connectAndSend(t, "a foo 123")
+	drained := s.Drain()
+
+	bar := connectAndSend(t, "a bar 123")
+	if msg := readFromServer(t, bar); msg != "draining" {
+		t.Errorf("expected draining message, got %q", msg)
+	}
+
+	select {
+	case <-drained:
+		t.Fatal("drained with client still connected")
+	default:
+	}
+
+	foo.Close()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("not drained after last client left")
+	}
+	s.StopServer()
+
+	if len(connected) != 1 || connected[0] != "foo" {
+		t.Errorf("only client connected before drain expected, got %v", connected)
+	}
+}
+
+func TestDrain_notRunning(t *testing.T) {
+	s := NewServer()
+	drained := s.Drain()
+	s.StartServer(4009)
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("server drained before start should be drained once running without clients")
+	}
+	s.StopServer()
+
+	select {
+	case <-NewServer().Drain():
+		t.Error("server not started should not be drained")
+	default:
+	}
+}
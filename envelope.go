@@ -0,0 +1,64 @@
+package mobster
+
+import "time"
+
+// outbound message with metadata, so that clients can tell message kinds apart;
+// it is serialized with server Encoding, json by default
+type Envelope struct {
+	Type    string            `json:"type"`
+	Time    time.Time         `json:"time"`
+	Sender  string            `json:"sender,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Payload any               `json:"payload,omitempty"`
+}
+
+// encodes envelope, time is set to now when empty
+func (s *Server) encodeEnvelope(e Envelope) (string, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := s.Encoding.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// send envelope to given user
+func (o *Ops) SendEnvelope(user string, e Envelope) error {
+	message, err := o.server.encodeEnvelope(e)
+	if err != nil {
+		return err
+	}
+	return o.SendToWithResult(user, message)
+}
+
+// send envelope to all users in given room
+func (o *Ops) SendEnvelopeToRoom(room string, e Envelope) error {
+	message, err := o.server.encodeEnvelope(e)
+	if err != nil {
+		return err
+	}
+	o.SendToRoom(room, message)
+	return nil
+}
+
+// send payload of given type to user wrapped in envelope, headers are optional
+func (o *Ops) SendEvent(user, eventType string, payload any, headers map[string]string) error {
+	return o.SendEnvelope(user, Envelope{Type: eventType, Headers: headers, Payload: payload})
+}
+
+// send payload of given type to all users in room wrapped in envelope, headers are optional
+func (o *Ops) SendEventToRoom(room, eventType string, payload any, headers map[string]string) error {
+	return o.SendEnvelopeToRoom(room, Envelope{Type: eventType, Headers: headers, Payload: payload})
+}
+
+// like Ops.SendEnvelope, envelope is encoded right away and queued as SendTo does
+func (s *Server) SendEnvelope(user string, e Envelope) error {
+	message, err := s.encodeEnvelope(e)
+	if err != nil {
+		return err
+	}
+	s.SendTo(user, message)
+	return nil
+}
@@ -0,0 +1,41 @@
+package mobster
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSendEvent(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	conn := &fakeConn{}
+	s.clientHolder.Add(NewClient("foo", "123", conn))
+	ops := &Ops{s}
+
+	if err := ops.SendEvent("foo", "chat", map[string]string{"text": "hi"}, map[string]string{"lang": "en"}); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ops.SendEnvelopeToRoom("123", Envelope{Type: "join", Time: at, Sender: "bar"})
+	if err := ops.SendEvent("nobody", "chat", nil, nil); err != ErrNotConnected {
+		t.Error("expected ErrNotConnected, got", err)
+	}
+
+	if len(conn.written) != 2 {
+		t.Fatalf("unexpected writes %q", conn.written)
+	}
+	var e struct {
+		Envelope
+		Payload map[string]string `json:"payload"`
+	}
+	if err := json.Unmarshal([]byte(conn.written[0]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != "chat" || e.Time.IsZero() || e.Headers["lang"] != "en" || e.Payload["text"] != "hi" {
+		t.Errorf("unexpected envelope %s", conn.written[0])
+	}
+	if conn.written[1] != `{"type":"join","time":"2020-01-02T03:04:05Z","sender":"bar"}` {
+		t.Errorf("unexpected envelope %s", conn.written[1])
+	}
+}
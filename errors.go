@@ -0,0 +1,59 @@
+package mobster
+
+import (
+	"errors"
+	"fmt"
+)
+
+// error returned by handlers, reported to client with its code and message
+type HandlerError struct {
+	Code    string
+	Message string
+}
+
+func (e *HandlerError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// creates HandlerError
+func Errorf(code, format string, args ...any) error {
+	return &HandlerError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// like CommandHandler, returned error is sent back to the client
+type CommandHandlerErr func(ops *Ops, user, room, args string) error
+
+// like Handle, but returned error is sent back to the client, see FormatError
+func (s *Server) HandleErr(command string, handler CommandHandlerErr) {
+	s.Handle(command, func(ops *Ops, user, room, args string) {
+		s.handleError(user, handler(ops, user, room, args))
+	})
+}
+
+// default response for handler errors is "err <code> <message>", errors other than
+// HandlerError are not exposed to clients, they get "err internal internal error"
+func formatError(err error) string {
+	var handlerErr *HandlerError
+	switch {
+	case errors.As(err, &handlerErr):
+		return fmt.Sprintf("err %s %s", handlerErr.Code, handlerErr.Message)
+	case errors.Is(err, ErrForbidden):
+		return "err forbidden " + err.Error()
+	default:
+		return "err internal internal error"
+	}
+}
+
+// sends error response to user, must be called from processingLoop only
+func (s *Server) handleError(user string, err error) {
+	if err == nil {
+		return
+	}
+	var handlerErr *HandlerError
+	if !errors.As(err, &handlerErr) {
+		s.OnError(user, "handler", err)
+	}
+	if c := s.clientHolder.GetByName(user); c != nil {
+		s.write(c, s.FormatError(err))
+	}
+}
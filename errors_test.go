@@ -0,0 +1,54 @@
+package mobster
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFormatError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{Errorf("bad_move", "%s is not legal", "e5"), "err bad_move e5 is not legal"},
+		{fmt.Errorf("wrapped: %w", Errorf("turn", "not your turn")), "err turn not your turn"},
+		{fmt.Errorf("%w: foo is not owner", ErrForbidden), "err forbidden forbidden: foo is not owner"},
+		{errors.New("db down"), "err internal internal error"},
+	}
+	for _, test := range tests {
+		if r := formatError(test.err); r != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, r)
+		}
+	}
+}
+
+func TestFlow_handlerErrors(t *testing.T) {
+	var internal []error
+	s := NewServer()
+	s.OnError = func(user, op string, err error) {
+		internal = append(internal, err)
+	}
+	s.HandleErr("move", func(ops *Ops, name, room, args string) error {
+		return Errorf("bad_move", "illegal move %s", args)
+	})
+	s.OnMessageErr = func(ops *Ops, name, room, message string) error {
+		return errors.New("db down")
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	send(t, c, "move e5")
+	if r := readFromServer(t, c); r != "err bad_move illegal move e5" {
+		t.Errorf("unexpected error response: %q", r)
+	}
+	send(t, c, "hello")
+	if r := readFromServer(t, c); r != "err internal internal error" {
+		t.Errorf("unexpected error response: %q", r)
+	}
+	if len(internal) != 1 {
+		t.Errorf("only internal errors should be reported, got %v", internal)
+	}
+
+	s.StopServer()
+}
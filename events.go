@@ -0,0 +1,124 @@
+package mobster
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EventType int
+
+const (
+	EventConnect EventType = iota
+	EventDisconnect
+	EventMessage
+	// user disconnected by server operation, followed by EventDisconnect
+	EventKick
+	// first client joined the room
+	EventRoomCreated
+	// last client left the room
+	EventRoomEmpty
+	// user moved to room, Message is the room it left
+	EventMove
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnect:
+		return "connect"
+	case EventDisconnect:
+		return "disconnect"
+	case EventMessage:
+		return "message"
+	case EventKick:
+		return "kick"
+	case EventRoomCreated:
+		return "room created"
+	case EventRoomEmpty:
+		return "room empty"
+	case EventMove:
+		return "move"
+	default:
+		return "unknown"
+	}
+}
+
+// activity observed by processing loop, see Subscribe
+type Event struct {
+	Type    EventType
+	Time    time.Time
+	User    string // empty for room events
+	Room    string
+	Message string // set for EventMessage only
+}
+
+type subscribers struct {
+	mu   sync.Mutex
+	list atomic.Pointer[[]chan Event]
+}
+
+// subscribes to server events, may be called any time, also before server starts;
+// events are delivered without blocking the server, so they are dropped when subscriber
+// falls behind by more than size events; channel is closed when server stops,
+// returned func cancels subscription without closing it
+func (s *Server) Subscribe(size int) (<-chan Event, func()) {
+	events := make(chan Event, size)
+	s.subscribers.update(func(list []chan Event) []chan Event {
+		return append(list, events)
+	})
+	cancel := func() {
+		s.subscribers.update(func(list []chan Event) []chan Event {
+			for i, ch := range list {
+				if ch == events {
+					return append(list[:i:i], list[i+1:]...)
+				}
+			}
+			return list
+		})
+	}
+	return events, cancel
+}
+
+// replaces subscriber list with copy changed by f, so that publish needs no locking
+func (s *subscribers) update(f func([]chan Event) []chan Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []chan Event
+	if current := s.list.Load(); current != nil {
+		list = append(list, *current...)
+	}
+	list = f(list)
+	s.list.Store(&list)
+}
+
+func (s *subscribers) get() []chan Event {
+	if list := s.list.Load(); list != nil {
+		return *list
+	}
+	return nil
+}
+
+// must be called from processingLoop only
+func (s *Server) publish(t EventType, user, room, message string) {
+	list := s.subscribers.get()
+	if len(list) == 0 {
+		return
+	}
+	e := Event{Type: t, Time: time.Now(), User: user, Room: room, Message: message}
+	for _, ch := range list {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// must be called from processingLoop only, when it exits
+func (s *Server) closeSubscribers() {
+	s.subscribers.update(func(list []chan Event) []chan Event {
+		for _, ch := range list {
+			close(ch)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package mobster
+
+import (
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	s := NewServer()
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		if message == "kick" {
+			ops.Disconnect(name)
+		}
+	}
+	events, _ := s.Subscribe(100)
+	s.StartServer(4009)
+
+	connectAndSend(t, "a foo 123")
+	bar := connectAndSend(t, "a bar 123")
+	send(t, bar, "hello")
+	send(t, bar, "kick")
+	sleep()
+	s.StopServer()
+
+	var got []string
+	for e := range events {
+		got = append(got, e.Type.String()+" "+e.User+" "+e.Room+" "+e.Message)
+		if e.Time.IsZero() {
+			t.Error("event time not set")
+		}
+	}
+	expected := []string{
+		"room created  123 ",
+		"connect foo 123 ",
+		"connect bar 123 ",
+		"message bar 123 hello",
+		"message bar 123 kick",
+		"kick bar 123 ",
+		"disconnect bar 123 ",
+		"disconnect foo 123 ",
+		"room empty  123 ",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("unexpected events %q", got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("event %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestSubscribe_cancelAndOverflow(t *testing.T) {
+	s := NewServer()
+	full, _ := s.Subscribe(1)
+	cancelled, cancel := s.Subscribe(10)
+	cancel()
+
+	s.publish(EventConnect, "foo", "123", "")
+	s.publish(EventConnect, "bar", "123", "")
+
+	if len(full) != 1 || (<-full).User != "foo" {
+		t.Error("events above subscriber buffer should be dropped")
+	}
+	if len(cancelled) != 0 {
+		t.Error("cancelled subscription got events")
+	}
+}
@@ -0,0 +1,23 @@
+package mobster
+
+// applies FilterInbound to message of client, false means message is dropped,
+// must be called from processingLoop only
+func (s *Server) filterInbound(c *Client, message string) (string, bool) {
+	if s.FilterInbound == nil {
+		return message, true
+	}
+	filtered, ok := s.FilterInbound(c.user, c.room, message)
+	if !ok && !s.DisableAudit {
+		s.auditf(c.room, c.user, "filtered", "%s: %s -> %s dropped by filter", c.room, c.user, message)
+	}
+	return filtered, ok
+}
+
+// applies FilterOutbound to message written to client, false means message is dropped,
+// must be called from processingLoop only
+func (s *Server) filterOutbound(c *Client, message string) (string, bool) {
+	if s.FilterOutbound == nil {
+		return message, true
+	}
+	return s.FilterOutbound(c.user, c.room, message)
+}
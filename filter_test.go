@@ -0,0 +1,44 @@
+package mobster
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlow_filters(t *testing.T) {
+	var messages []string
+	s := NewServer()
+	s.FilterInbound = func(user, room, message string) (string, bool) {
+		if strings.Contains(message, "spam") {
+			return "", false
+		}
+		return strings.ReplaceAll(message, "darn", "****"), true
+	}
+	s.FilterOutbound = func(user, room, message string) (string, bool) {
+		if user == "bar" && strings.HasPrefix(message, "secret") {
+			return "", false
+		}
+		return strings.ReplaceAll(message, "555-1234", "<phone>"), true
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		messages = append(messages, message)
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+
+	foo := connectAndSend(t, "a foo 123")
+	bar := connectAndSend(t, "a bar 123")
+	send(t, foo, "buy spam", "darn, call 555-1234")
+	if msg := readFromServer(t, bar); msg != "****, call <phone>" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	send(t, foo, "secret plan")
+	if msg := readFromServer(t, foo); msg != "****, call <phone>secret plan" {
+		t.Errorf("unexpected messages %q", msg)
+	}
+	s.StopServer()
+
+	if len(messages) != 2 || messages[0] != "****, call 555-1234" {
+		t.Errorf("unexpected messages seen by handler %v", messages)
+	}
+}
@@ -0,0 +1,169 @@
+package mobster
+
+import (
+	"net"
+	"time"
+)
+
+// thresholds of flood detection, see Server.Flood
+type FloodPolicy struct {
+	// more than MaxMessages within Window is a flood, disabled when zero
+	MaxMessages int
+	Window      time.Duration
+	// more than MaxRepeats identical messages in a row is a flood, disabled when zero
+	MaxRepeats int
+	// how long flooding user and its ip are banned, they are only kicked when zero
+	BanDuration time.Duration
+}
+
+// reasons passed to OnFlood
+const (
+	FloodRate   = "rate"
+	FloodRepeat = "repeat"
+)
+
+// per client state of flood detection
+type floodState struct {
+	policy  *FloodPolicy
+	times   []time.Time // ring of last message times
+	next    int
+	last    string
+	repeats int
+}
+
+// tells if message makes client flood, must be called from processingLoop only
+func (s *Server) detectFlood(c *Client, message string, now time.Time) (reason string, flood bool) {
+	p := s.floodPolicy(c.room)
+	if c.flood == nil || c.flood.policy != p {
+		// e.g. after move to room of other type
+		c.flood = &floodState{policy: p}
+	}
+	f := c.flood
+	if p.MaxRepeats > 0 {
+		if message == f.last {
+			f.repeats++
+		} else {
+			f.last, f.repeats = message, 0
+		}
+		if f.repeats >= p.MaxRepeats {
+			return FloodRepeat, true
+		}
+	}
+	if p.MaxMessages > 0 && p.Window > 0 {
+		if len(f.times) < p.MaxMessages {
+			f.times = append(f.times, now)
+			return "", false
+		}
+		// ring holds last MaxMessages times, oldest one is where next one goes
+		oldest := f.times[f.next]
+		f.times[f.next] = now
+		f.next = (f.next + 1) % len(f.times)
+		if now.Sub(oldest) < p.Window {
+			return FloodRate, true
+		}
+	}
+	return "", false
+}
+
+// applies flood policy to message, tells if client was kicked,
+// must be called from processingLoop only
+func (s *Server) checkFlood(ops *Ops, c *Client, message string) bool {
+	p := s.floodPolicy(c.room)
+	if p == nil || c.bot != nil {
+		return false
+	}
+	reason, flood := s.detectFlood(c, message, time.Now())
+	if !flood {
+		return false
+	}
+	if s.OnFlood != nil && !s.OnFlood(ops, c.user, c.room, reason) {
+		return false
+	}
+	s.auditf(c.room, c.user, "flood", "%s: %s flooding (%s)", c.room, c.user, reason)
+	if p.BanDuration > 0 {
+		ops.Ban(c.user, p.BanDuration)
+		if ip, ok := remoteIP(c.conn.RemoteAddr()); ok {
+			ops.BanIP(ip, p.BanDuration)
+		}
+	}
+	s.publish(EventKick, c.user, c.room, "")
+	s.disconnect(c, CloseBanned)
+	return true
+}
+
+// ip of tcp or udp address; other transports, e.g. unix sockets, http sessions or streams,
+// have no address of their own, so their clients must not be banned by it
+func remoteIP(addr net.Addr) (string, bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String(), true
+	case *net.UDPAddr:
+		return a.IP.String(), true
+	}
+	return "", false
+}
+
+// bans user from joining for given duration, forever when zero; connected user stays
+func (o *Ops) Ban(user string, duration time.Duration) {
+	o.server.ban("user:"+user, duration)
+}
+
+// bans clients connecting from given ip for given duration, forever when zero
+func (o *Ops) BanIP(ip string, duration time.Duration) {
+	o.server.ban("ip:"+ip, duration)
+}
+
+func (o *Ops) Unban(user string) {
+	delete(o.server.bans, "user:"+user)
+}
+
+func (o *Ops) UnbanIP(ip string) {
+	delete(o.server.bans, "ip:"+ip)
+}
+
+func (o *Ops) IsBanned(user string) bool {
+	return o.server.isBanned("user:" + user)
+}
+
+func (o *Ops) IsBannedIP(ip string) bool {
+	return o.server.isBanned("ip:" + ip)
+}
+
+func (s *Server) ban(key string, duration time.Duration) {
+	now := time.Now()
+	for k, until := range s.bans {
+		if !until.IsZero() && now.After(until) {
+			delete(s.bans, k)
+		}
+	}
+	var until time.Time
+	if duration > 0 {
+		until = now.Add(duration)
+	}
+	s.bans[key] = until
+	s.auditf("", key, "ban", "%s banned for %s", key, duration)
+}
+
+func (s *Server) isBanned(key string) bool {
+	until, ok := s.bans[key]
+	if !ok {
+		return false
+	}
+	if !until.IsZero() && time.Now().After(until) {
+		delete(s.bans, key)
+		return false
+	}
+	return true
+}
+
+// tells if client or its ip is banned, must be called from processingLoop only
+func (s *Server) banned(c *Client) bool {
+	if len(s.bans) == 0 || c.bot != nil {
+		return false
+	}
+	if s.isBanned("user:" + c.user) {
+		return true
+	}
+	ip, ok := remoteIP(c.conn.RemoteAddr())
+	return ok && s.isBanned("ip:"+ip)
+}
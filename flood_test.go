@@ -0,0 +1,135 @@
+package mobster
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDetectFlood_rate(t *testing.T) {
+	s := NewServer()
+	s.Flood = &FloodPolicy{MaxMessages: 3, Window: time.Second}
+	c := NewClient("foo", "123", &fakeConn{})
+	now := time.Now()
+
+	for i, msg := range []string{"a", "b", "c"} {
+		if _, flood := s.detectFlood(c, msg, now.Add(time.Duration(i)*time.Millisecond)); flood {
+			t.Fatalf("message %d should not be a flood", i)
+		}
+	}
+	if reason, flood := s.detectFlood(c, "d", now.Add(10*time.Millisecond)); !flood || reason != FloodRate {
+		t.Errorf("expected rate flood, got %q %v", reason, flood)
+	}
+	if _, flood := s.detectFlood(c, "e", now.Add(2*time.Second)); flood {
+		t.Error("window should slide")
+	}
+}
+
+func TestDetectFlood_repeat(t *testing.T) {
+	s := NewServer()
+	s.Flood = &FloodPolicy{MaxRepeats: 2}
+	c := NewClient("foo", "123", &fakeConn{})
+	now := time.Now()
+
+	for _, msg := range []string{"spam", "spam", "other", "spam", "spam"} {
+		if _, flood := s.detectFlood(c, msg, now); flood {
+			t.Fatalf("%q should not be a flood yet", msg)
+		}
+	}
+	if reason, flood := s.detectFlood(c, "spam", now); !flood || reason != FloodRepeat {
+		t.Errorf("expected repeat flood, got %q %v", reason, flood)
+	}
+}
+
+func TestBans(t *testing.T) {
+	s := NewServer()
+	ops := &Ops{s}
+	ops.Ban("foo", time.Minute)
+	ops.BanIP("10.0.0.1", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if !ops.IsBanned("foo") {
+		t.Error("foo should be banned")
+	}
+	if ops.IsBannedIP("10.0.0.1") {
+		t.Error("ip ban should expire")
+	}
+	ops.Unban("foo")
+	if ops.IsBanned("foo") {
+		t.Error("foo should be unbanned")
+	}
+}
+
+func TestFlow_flood(t *testing.T) {
+	var messages, floods []string
+	s := NewServer()
+	s.SendCloseCodes = true
+	s.Flood = &FloodPolicy{MaxRepeats: 1, BanDuration: time.Minute}
+	s.OnFlood = func(ops *Ops, user, room, reason string) bool {
+		floods = append(floods, user+" "+reason)
+		return user != "vip"
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		messages = append(messages, user+" "+message)
+	}
+	s.StartServer(4009)
+
+	vip := connectAndSend(t, "a vip 123")
+	send(t, vip, "hi")
+	send(t, vip, "hi")
+	c := connectAndSend(t, "a foo 123")
+	send(t, c, "hi")
+	send(t, c, "hi")
+	if msg := readFromServer(t, c); msg != "close banned" {
+		t.Errorf("expected close code, got %q", msg)
+	}
+	again := connectAndSend(t, "a bar 123")
+	if msg := readFromServer(t, again); msg != "close banned" {
+		t.Errorf("expected ip ban, got %q", msg)
+	}
+	time.Sleep(50 * time.Millisecond)
+	s.StopServer()
+
+	if len(floods) != 2 || floods[0] != "vip repeat" || floods[1] != "foo repeat" {
+		t.Errorf("unexpected floods %v", floods)
+	}
+	if len(messages) != 3 {
+		t.Errorf("flooding message should not reach OnMessage, got %v", messages)
+	}
+}
+
+func TestFlow_floodWithoutIP(t *testing.T) {
+	var connected []string
+	s := NewServer()
+	s.DisableAudit = true
+	s.Flood = &FloodPolicy{MaxRepeats: 1, BanDuration: time.Minute}
+	s.OnConnect = func(ops *Ops, user, room string) {
+		connected = append(connected, user)
+	}
+	s.StartServer(4009)
+
+	// pipe clients share the same address, like unix socket or stream ones
+	local, flooder := net.Pipe()
+	go io.Copy(io.Discard, flooder)
+	s.ServeConn(local)
+	send(t, flooder, "a foo 123", "hi", "hi")
+	time.Sleep(10 * time.Millisecond)
+
+	local, other := net.Pipe()
+	go io.Copy(io.Discard, other)
+	s.ServeConn(local)
+	send(t, other, "a bar 123")
+	time.Sleep(10 * time.Millisecond)
+	s.StopServer()
+
+	if len(connected) != 2 || connected[1] != "bar" {
+		t.Errorf("client on the same transport should not be banned, connected %v", connected)
+	}
+	if s.isBanned("ip:pipe") || s.isBanned("ip:") {
+		t.Error("flooder without ip should be banned by name only")
+	}
+	if !s.isBanned("user:foo") {
+		t.Error("flooder should be banned")
+	}
+}
@@ -0,0 +1,212 @@
+package mobster
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+// how messages are delimited on the wire
+type Framing int
+
+const (
+	// messages are newline separated text, surrounding whitespace is trimmed
+	FramingText Framing = iota
+	// every message is preceded by its length as 4 byte big endian unsigned integer,
+	// payload is passed untouched
+	FramingLengthPrefixed
+)
+
+// default limit of single length prefixed frame
+const DefaultMaxFrameSize = 64 * 1024
+
+const frameHeaderSize = 4
+
+// reads messages from connection according to server framing
+type frameReader struct {
+	framing Framing
+	maxSize int
+	conn    *countingReader
+	buf     *bufio.Reader
+	// set for text framing with SplitFunc
+	scanner *bufio.Scanner
+	// if set, gets each packet before it is split into messages, true means consumed
+	raw func(data []byte) bool
+}
+
+func (s *Server) newFrameReader(conn net.Conn) *frameReader {
+	counting := &countingReader{conn: conn, server: &s.io, client: &ioCounters{}}
+	r := &frameReader{framing: s.Framing, maxSize: s.MaxFrameSize, conn: counting}
+	if r.framing == FramingLengthPrefixed {
+		r.buf = bufio.NewReader(counting)
+	}
+	if r.maxSize <= 0 {
+		r.maxSize = DefaultMaxFrameSize
+	}
+	if r.framing == FramingText && s.SplitFunc != nil {
+		r.scanner = bufio.NewScanner(counting)
+		r.scanner.Buffer(make([]byte, 0, readBufferSize), r.maxSize)
+		r.scanner.Split(s.SplitFunc)
+	}
+	return r
+}
+
+// reads auth packet
+func (r *frameReader) readAuth() (string, error) {
+	if r.framing == FramingLengthPrefixed {
+		data, err := r.readFrame()
+		return string(data), err
+	}
+	if r.scanner != nil {
+		token, err := r.scan()
+		return string(token), err
+	}
+	var req string
+	err := read(&req, r.conn)
+	if err == nil {
+		r.conn.countFrames(1)
+	}
+	return req, err
+}
+
+// counts traffic of authenticated client from now on, along with server one
+func (r *frameReader) countFor(c *Client) {
+	r.conn.client = &c.io
+}
+
+// reads next batch of messages, data is set only for length prefixed framing
+func (r *frameReader) readMessages() (messages []string, data [][]byte, err error) {
+	for {
+		if r.framing == FramingLengthPrefixed {
+			frame, err := r.readFrame()
+			if err != nil {
+				return nil, nil, err
+			}
+			if r.raw != nil && r.raw(frame) {
+				continue
+			}
+			return []string{string(frame)}, [][]byte{frame}, nil
+		}
+		if r.scanner != nil {
+			token, err := r.scan()
+			if err != nil {
+				return nil, nil, err
+			}
+			if r.raw != nil && r.raw(token) {
+				continue
+			}
+			return []string{string(token)}, nil, nil
+		}
+		req, consumed, err := r.readText()
+		if err != nil {
+			return nil, nil, err
+		}
+		if consumed {
+			r.conn.countFrames(1)
+			continue
+		}
+		messages := splitText(req)
+		r.conn.countFrames(len(messages))
+		return messages, nil, nil
+	}
+}
+
+// reads next token of SplitFunc, valid until next call
+func (r *frameReader) scan() ([]byte, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				r.conn.countFramingError()
+			}
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	r.conn.countFrames(1)
+	return r.scanner.Bytes(), nil
+}
+
+// reads single text packet, passing it to raw hook first
+func (r *frameReader) readText() (req string, consumed bool, err error) {
+	if r.raw == nil {
+		err = read(&req, r.conn)
+		return req, false, err
+	}
+	buf := readBuffers.Get().(*[readBufferSize]byte)
+	defer readBuffers.Put(buf)
+	n, err := r.conn.Read(buf[0:])
+	if err != nil {
+		return "", false, err
+	}
+	if r.raw(buf[:n]) {
+		return "", true, nil
+	}
+	return strings.TrimSpace(string(buf[:n])), false, nil
+}
+
+// reads single length prefixed frame, counting ones which needed more than one read
+func (r *frameReader) readFrame() ([]byte, error) {
+	reads, buffered := r.conn.reads, r.buf.Buffered()
+	frame, err := readFrame(r.buf, r.maxSize)
+	if err != nil {
+		if errors.Is(err, errBadFrame) {
+			r.conn.countFramingError()
+		}
+		return nil, err
+	}
+	// frame starting in empty buffer may take one read
+	if needed := r.conn.reads - reads; needed > 1 || (needed == 1 && buffered > 0) {
+		r.conn.countShortRead()
+	}
+	r.conn.countFrames(1)
+	return frame, nil
+}
+
+// reads single length prefixed frame
+func readFrame(r io.Reader, maxSize int) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size, err := parseFrameHeader(header[:], maxSize)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// prepares message for writing according to server framing
+func (s *Server) frame(message []byte) []byte {
+	if s.FormatOutbound != nil {
+		message = s.FormatOutbound(message)
+	}
+	if s.Framing != FramingLengthPrefixed {
+		if s.Delimiter == "" || s.FormatOutbound != nil {
+			return message
+		}
+		return append(message[:len(message):len(message)], s.Delimiter...)
+	}
+	data := make([]byte, frameHeaderSize+len(message))
+	binary.BigEndian.PutUint32(data, uint32(len(message)))
+	copy(data[frameHeaderSize:], message)
+	return data
+}
+
+// appends message framed according to server framing to dst
+func (s *Server) appendFrame(dst []byte, message string) []byte {
+	if s.FormatOutbound != nil {
+		return append(dst, s.frame([]byte(message))...)
+	}
+	if s.Framing == FramingLengthPrefixed {
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(message)))
+		return append(dst, message...)
+	}
+	return append(append(dst, message...), s.Delimiter...)
+}
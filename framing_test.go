@@ -0,0 +1,149 @@
+package mobster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestReadFrame(t *testing.T) {
+	s := &Server{Framing: FramingLengthPrefixed}
+	data := s.frame([]byte("foo\n bar "))
+
+	r, err := readFrame(bytes.NewReader(data), DefaultMaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r) != "foo\n bar " {
+		t.Errorf("frame payload should be untouched, got %q", r)
+	}
+}
+
+func TestReadFrame_tooBig(t *testing.T) {
+	s := &Server{Framing: FramingLengthPrefixed}
+	data := s.frame([]byte("foobar"))
+
+	_, err := readFrame(bytes.NewReader(data), 3)
+	if err == nil {
+		t.Error("expected error for too big frame")
+	}
+}
+
+func TestFlow_binaryEcho(t *testing.T) {
+	s := NewServer()
+	s.Framing = FramingLengthPrefixed
+	s.OnBinaryMessage = func(ops *Ops, name, room string, message []byte) {
+		ops.SendTo(name, string(message))
+	}
+	s.StartServer(4009)
+
+	c := connect(t)
+	sendFrame(t, c, []byte("a foo 123"))
+	payload := []byte{0, 1, '\n', ' ', 255}
+	sendFrame(t, c, payload)
+
+	response := readFromServer(t, c)
+	if response != string(s.frame(payload)) {
+		t.Errorf("binary payload should be echoed untouched, got %q", response)
+	}
+
+	s.StopServer()
+}
+
+func sendFrame(t *testing.T, conn net.Conn, payload []byte) {
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	send(t, conn, string(append(header[:], payload...)))
+}
+
+func TestAppendFrame(t *testing.T) {
+	for _, framing := range []Framing{FramingText, FramingLengthPrefixed} {
+		s := &Server{Framing: framing}
+		if !bytes.Equal(s.appendFrame([]byte("x"), "foo"), append([]byte("x"), s.frame([]byte("foo"))...)) {
+			t.Errorf("framing %d: appended frame differs", framing)
+		}
+	}
+}
+
+func TestFlow_rawPacket(t *testing.T) {
+	var raw, messages []string
+	s := NewServer()
+	s.OnRawPacket = func(user string, data []byte) bool {
+		if data[0] != 1 {
+			return false
+		}
+		raw = append(raw, user+" "+string(data[1:]))
+		return true
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		messages = append(messages, message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123", "\x01voice \n", " hello\n")
+	c.Close()
+	sleep()
+	s.StopServer()
+
+	if len(raw) != 1 || raw[0] != "foo voice \n" {
+		t.Errorf("raw packet should be passed untouched, got %q", raw)
+	}
+	if len(messages) != 1 || messages[0] != "hello" {
+		t.Errorf("unexpected messages %q", messages)
+	}
+}
+
+func TestFlow_splitFunc(t *testing.T) {
+	var messages []string
+	s := NewServer()
+	s.SplitFunc = bufio.ScanLines
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		messages = append(messages, user+": "+message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123\r\nhel", "lo\r\n world\r\n")
+	c.Close()
+	sleep()
+	s.StopServer()
+
+	if len(messages) != 2 || messages[0] != "foo: hello" || messages[1] != "foo:  world" {
+		t.Errorf("messages should follow split func, got %q", messages)
+	}
+}
+
+func TestFrame_delimiter(t *testing.T) {
+	s := &Server{Delimiter: "\n"}
+	if got := string(s.appendFrame([]byte("x"), "foo")); got != "xfoo\n" {
+		t.Errorf("unexpected frame %q", got)
+	}
+	message := []byte("bar")
+	if got := string(s.frame(message)); got != "bar\n" || string(message) != "bar" {
+		t.Errorf("unexpected frame %q", got)
+	}
+
+	s.Framing = FramingLengthPrefixed
+	if got := s.frame([]byte("foo")); !bytes.Equal(got, []byte{0, 0, 0, 3, 'f', 'o', 'o'}) {
+		t.Errorf("delimiter should not apply to length prefixed frames, got %q", got)
+	}
+}
+
+func TestFlow_formatOutbound(t *testing.T) {
+	s := NewServer()
+	s.FormatOutbound = func(message []byte) []byte {
+		return append(append([]byte("<"), message...), '>')
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.SendTo(user, message)
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123", "hi")
+	if msg := readFromServer(t, c); msg != "<hi><hi>" {
+		t.Errorf("unexpected messages %q", msg)
+	}
+	s.StopServer()
+}
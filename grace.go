@@ -0,0 +1,106 @@
+package mobster
+
+import (
+	"net"
+	"time"
+)
+
+// stands in for lost connection of client within ReconnectGrace, keeps what is written
+// to it for the next connection of the user
+type graceConn struct {
+	remote net.Addr
+	limit  int
+	writes [][]byte
+}
+
+func (g *graceConn) Write(data []byte) (int, error) {
+	// oldest writes are dropped first
+	if len(g.writes) >= g.limit {
+		g.writes = g.writes[1:]
+	}
+	g.writes = append(g.writes, append([]byte(nil), data...))
+	return len(data), nil
+}
+
+func (g *graceConn) Close() error {
+	return nil
+}
+
+func (g *graceConn) RemoteAddr() net.Addr {
+	return g.remote
+}
+
+// keeps client which connection was lost in its room for ReconnectGrace, false if
+// it has to be disconnected right away, must be called from processingLoop only
+func (s *Server) suspend(ops *Ops, c *Client) bool {
+	if s.ReconnectGrace <= 0 || c.bot != nil || s.draining.Load() {
+		return false
+	}
+	if _, ok := c.conn.(*graceConn); ok {
+		return true
+	}
+	limit := s.ResendQueueSize
+	if limit <= 0 {
+		limit = DefaultResendQueueSize
+	}
+	// buffer of suspended client is written by processing loop itself
+	s.closeConn(c, CloseLost)
+	c.mailbox = nil
+	c.conn = &graceConn{remote: c.conn.RemoteAddr(), limit: limit}
+	s.auditf(c.room, c.user, "connection_lost", "%s: %s connection lost, awaiting reconnect", c.room, c.user)
+	time.AfterFunc(s.ReconnectGrace, func() {
+		select {
+		case s.graceExpirations <- c:
+		case <-s.stopping:
+		}
+	})
+	if s.OnConnectionLost != nil {
+		s.OnConnectionLost(ops, c.user, c.room)
+	}
+	return true
+}
+
+// disconnects client which did not come back in time, must be called from processingLoop only
+func (s *Server) expireGrace(c *Client) {
+	if _, ok := c.conn.(*graceConn); !ok || !s.clientHolder.Has(c) {
+		return
+	}
+	s.keepPending(c)
+	s.disconnect(c, CloseLost)
+}
+
+// puts reconnected client in place of its suspended one, returns false when there is
+// nothing to resume, must be called from processingLoop only
+func (s *Server) resume(c *Client) bool {
+	var old *Client
+	var lost *graceConn
+	for _, other := range s.clientHolder.GetAllByName(c.user) {
+		if g, ok := other.conn.(*graceConn); ok && (old == nil || other.room == c.room) {
+			old, lost = other, g
+		}
+	}
+	if old == nil {
+		return false
+	}
+	if old.room != c.room {
+		// came back elsewhere, so the old room sees regular disconnect
+		s.keepPending(old)
+		s.disconnect(old, CloseLost)
+		return false
+	}
+	c.connectedAt = old.connectedAt
+	c.flood = old.flood
+	s.clientHolder.Remove(old)
+	s.clientHolder.Add(c)
+	s.attachMailbox(c)
+	s.auditf(c.room, c.user, "reconnect", "%s: %s reconnected", c.room, c.user)
+	for _, data := range lost.writes {
+		if s.writeData(c, data) != nil {
+			return true
+		}
+	}
+	if s.OnConnectionResumed != nil {
+		s.OnConnectionResumed(&Ops{s}, c.user, c.room)
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlow_reconnectGrace(t *testing.T) {
+	var events []string
+	s := NewServer()
+	s.ReconnectGrace = time.Second
+	s.OnConnect = func(ops *Ops, user, room string) {
+		events = append(events, "connect "+user)
+	}
+	s.OnDisconnect = func(ops *Ops, user, room string) {
+		events = append(events, "disconnect "+user)
+	}
+	s.OnConnectionLost = func(ops *Ops, user, room string) {
+		events = append(events, "lost "+user)
+		if ops.GetRoomCount(room) != 2 {
+			t.Error("lost user should stay in room")
+		}
+	}
+	s.OnConnectionResumed = func(ops *Ops, user, room string) {
+		events = append(events, "resumed "+user)
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+
+	foo := connectAndSend(t, "a foo 123")
+	bar := connectAndSend(t, "a bar 123")
+	foo.Close()
+	sleep()
+	send(t, bar, "your turn")
+	foo = connectAndSend(t, "a foo 123")
+	if msg := readFromServer(t, foo); msg != "your turn" {
+		t.Errorf("buffered message should be delivered, got %q", msg)
+	}
+	send(t, foo, "e4")
+	if msg := readFromServer(t, bar); msg != "your turne4" {
+		t.Errorf("resumed user should be able to play, got %q", msg)
+	}
+	s.StopServer()
+
+	expected := []string{"connect foo", "connect bar", "lost foo", "resumed foo"}
+	if len(events) < len(expected) {
+		t.Fatalf("unexpected events %v", events)
+	}
+	for i, e := range expected {
+		if events[i] != e {
+			t.Errorf("unexpected events %v", events)
+			break
+		}
+	}
+}
+
+func TestFlow_reconnectGraceExpired(t *testing.T) {
+	var events []string
+	s := NewServer()
+	s.ReconnectGrace = 10 * time.Millisecond
+	s.OnDisconnect = func(ops *Ops, user, room string) {
+		events = append(events, "disconnect "+user)
+	}
+	s.OnConnectionLost = func(ops *Ops, user, room string) {
+		events = append(events, "lost "+user)
+	}
+	s.StartServer(4009)
+
+	foo := connectAndSend(t, "a foo 123")
+	foo.Close()
+	time.Sleep(30 * time.Millisecond)
+	s.StopServer()
+
+	if len(events) != 2 || events[0] != "lost foo" || events[1] != "disconnect foo" {
+		t.Errorf("unexpected events %v", events)
+	}
+}
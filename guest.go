@@ -0,0 +1,64 @@
+package mobster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ErrNoGuestRoom is returned by guest auth when guest sent no room and OnGuestRoom gave none
+var ErrNoGuestRoom = errors.New("no room for guest")
+
+// generates usernames of guests, see Server.GuestAuth; called from connection
+// goroutines so has to be thread safe
+type IDGenerator interface {
+	NewID() string
+}
+
+// lets plain function be used as IDGenerator
+type IDGeneratorFunc func() string
+
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// generates ids made of prefix and random hex, like "guest-3fa9c1d2"
+type RandomIDs struct {
+	Prefix string
+	// random bytes, 4 when zero
+	Size int
+}
+
+func (g RandomIDs) NewID() string {
+	size := g.Size
+	if size <= 0 {
+		size = 4
+	}
+	id := make([]byte, size)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return g.Prefix + hex.EncodeToString(id)
+}
+
+// tells if auth packet is "g" or "g <room>" one
+func isGuestPacket(packet string) bool {
+	return packet == "g" || strings.HasPrefix(packet, "g ")
+}
+
+// authenticates guest, who gets username from IDGenerator and room from packet or OnGuestRoom
+func (s *Server) guestAuth(packet string) (username, room string, err error) {
+	room = strings.TrimPrefix(strings.TrimPrefix(packet, "g"), " ")
+	if room != "" && !validAuthName(room) {
+		return "", "", malformedAuth(packet)
+	}
+	username = s.IDGenerator.NewID()
+	if room == "" && s.OnGuestRoom != nil {
+		room = s.OnGuestRoom(username)
+	}
+	if room == "" {
+		return "", "", ErrNoGuestRoom
+	}
+	return username, room, nil
+}
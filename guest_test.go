@@ -0,0 +1,91 @@
+package mobster
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRandomIDs(t *testing.T) {
+	g := RandomIDs{Prefix: "guest-"}
+	a, b := g.NewID(), g.NewID()
+	if !strings.HasPrefix(a, "guest-") || len(a) != len("guest-")+8 {
+		t.Errorf("unexpected id %q", a)
+	}
+	if a == b {
+		t.Error("ids should differ")
+	}
+	if id := (RandomIDs{Size: 2}).NewID(); len(id) != 4 {
+		t.Errorf("unexpected id %q", id)
+	}
+}
+
+func TestGuestAuth(t *testing.T) {
+	s := NewServer()
+	s.IDGenerator = IDGeneratorFunc(func() string { return "g1" })
+
+	if user, room, err := s.guestAuth("g lobby"); err != nil || user != "g1" || room != "lobby" {
+		t.Errorf("unexpected guest auth %q %q %v", user, room, err)
+	}
+	if _, _, err := s.guestAuth("g"); !errors.Is(err, ErrNoGuestRoom) {
+		t.Errorf("guest without room should be refused, got %v", err)
+	}
+	s.OnGuestRoom = func(user string) string { return "room-of-" + user }
+	if _, room, err := s.guestAuth("g"); err != nil || room != "room-of-g1" {
+		t.Errorf("room should be assigned, got %q %v", room, err)
+	}
+	for _, packet := range []string{"g a b", "g a\x01", "g  "} {
+		if _, _, err := s.guestAuth(packet); !errors.Is(err, ErrMalformedAuth) {
+			t.Errorf("%q: expected malformed auth, got %v", packet, err)
+		}
+	}
+}
+
+func TestFlow_guest(t *testing.T) {
+	var infos []ClientInfo
+	var authCalled bool
+	s := NewServer()
+	s.GuestAuth = true
+	s.IDGenerator = IDGeneratorFunc(func() string { return "guest1" })
+	s.OnGuestRoom = func(user string) string { return "casual" }
+	s.OnAuth = func(message string) (string, string, error) {
+		authCalled = true
+		return "foo", "123", nil
+	}
+	s.OnConnect = func(ops *Ops, user, room string) {
+		info, _ := ops.GetClientInfo(user)
+		infos = append(infos, info)
+	}
+	s.StartServer(4009)
+	connectAndSend(t, "g")
+	sleep()
+	connectAndSend(t, "a foo 123")
+	sleep()
+	s.StopServer()
+
+	if len(infos) != 2 {
+		t.Fatalf("expected two clients, got %v", infos)
+	}
+	if infos[0].User != "guest1" || infos[0].Room != "casual" || !infos[0].Guest {
+		t.Errorf("unexpected guest %+v", infos[0])
+	}
+	if infos[1].User != "foo" || infos[1].Guest || !authCalled {
+		t.Errorf("regular client should go through OnAuth, got %+v", infos[1])
+	}
+}
+
+func TestFlow_guestDisabled(t *testing.T) {
+	connected := false
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {
+		connected = true
+	}
+	s.StartServer(4009)
+	connectAndSend(t, "g lobby")
+	sleep()
+	s.StopServer()
+
+	if connected {
+		t.Error("guests should not get in unless GuestAuth is set")
+	}
+}
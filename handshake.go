@@ -0,0 +1,79 @@
+package mobster
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// default time given to connection for proxy header, challenge and auth packet
+const DefaultHandshakeTimeout = 1 * time.Second
+
+// tells how connection was let into handshake
+type handshakeAdmission int
+
+const (
+	handshakeRejected handshakeAdmission = iota
+	handshakeStarted
+	handshakeQueued
+)
+
+// counters of pending handshakes, connections not authenticated yet
+type handshakeStats struct {
+	pending  atomic.Int32
+	queued   atomic.Int32
+	rejected atomic.Uint64
+}
+
+func (s *Server) handshakeTimeout() time.Duration {
+	if s.HandshakeTimeout > 0 {
+		return s.HandshakeTimeout
+	}
+	return DefaultHandshakeTimeout
+}
+
+// takes handshake slot for new connection, queues it when there is none free
+// and HandshakeQueueSize allows; never blocks as it is called by accepting loop
+func (s *Server) admitHandshake() handshakeAdmission {
+	if s.MaxPendingHandshakes <= 0 {
+		s.handshakes.pending.Add(1)
+		return handshakeStarted
+	}
+	select {
+	case s.handshakeSlots <- struct{}{}:
+		s.handshakes.pending.Add(1)
+		return handshakeStarted
+	default:
+	}
+	if int(s.handshakes.queued.Add(1)) <= s.HandshakeQueueSize {
+		return handshakeQueued
+	}
+	s.handshakes.queued.Add(-1)
+	s.handshakes.rejected.Add(1)
+	return handshakeRejected
+}
+
+// waits for handshake slot of queued connection, false when its handshake timeout
+// passed or server stops first
+func (s *Server) awaitHandshake() bool {
+	defer s.handshakes.queued.Add(-1)
+	timer := time.NewTimer(s.handshakeTimeout())
+	defer timer.Stop()
+	select {
+	case s.handshakeSlots <- struct{}{}:
+		s.handshakes.pending.Add(1)
+		return true
+	case <-timer.C:
+		s.handshakes.rejected.Add(1)
+		return false
+	case <-s.stopping:
+		return false
+	}
+}
+
+// frees handshake slot once connection authenticated or failed to
+func (s *Server) endHandshake() {
+	s.handshakes.pending.Add(-1)
+	if s.MaxPendingHandshakes > 0 {
+		<-s.handshakeSlots
+	}
+}
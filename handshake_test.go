@@ -0,0 +1,47 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlow_pendingHandshakes(t *testing.T) {
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.MaxPendingHandshakes = 1
+	s.HandshakeQueueSize = 1
+	s.HandshakeTimeout = 200 * time.Millisecond
+	s.StartServer(4009)
+
+	first := connect(t)
+	sleep()
+	queued := connect(t)
+	sleep()
+	rejected := connect(t)
+	rejected.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	var buf [16]byte
+	if _, err := rejected.Read(buf[:]); err == nil || isTimeout(err) {
+		t.Errorf("connection over queue should be closed, got %v", err)
+	}
+	stats := s.Stats()
+	if stats.PendingHandshakes != 1 || stats.QueuedHandshakes != 1 || stats.RejectedHandshakes != 1 {
+		t.Errorf("unexpected handshake stats %d %d %d", stats.PendingHandshakes, stats.QueuedHandshakes, stats.RejectedHandshakes)
+	}
+
+	send(t, first, "a foo room")
+	sleep()
+	send(t, queued, "a bar room")
+	sleep()
+	stats = s.Stats()
+	if stats.Clients != 2 || stats.PendingHandshakes != 0 || stats.QueuedHandshakes != 0 {
+		t.Errorf("queued connection should authenticate once slot is free, got %+v", stats)
+	}
+	s.StopServer()
+}
+
+func isTimeout(err error) bool {
+	if ne, ok := err.(interface{ Timeout() bool }); ok {
+		return ne.Timeout()
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package mobster
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// bounds used for room sizes and broadcast fan-out
+var sizeBounds = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// bounds used for messages per room per minute
+var rateBounds = []float64{1, 5, 10, 50, 100, 500, 1000, 5000}
+
+// distribution of observed values over fixed buckets
+type Histogram struct {
+	// upper bound of each bucket, values above the last one are counted in extra bucket
+	Bounds []float64 `json:"bounds"`
+	// number of values per bucket, one more than bounds
+	Counts []uint64 `json:"counts"`
+	Count  uint64   `json:"count"`
+	Sum    float64  `json:"sum"`
+	Max    float64  `json:"max"`
+}
+
+func newHistogram(bounds []float64) Histogram {
+	return Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.Counts[sort.SearchFloat64s(h.Bounds, v)]++
+	h.Count++
+	h.Sum += v
+	h.Max = math.Max(h.Max, v)
+}
+
+// upper bound of bucket holding given quantile, Max for the extra bucket, 0 when empty
+func (h Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.Count)))
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen >= rank && n > 0 {
+			if i < len(h.Bounds) {
+				return math.Min(h.Bounds[i], h.Max)
+			}
+			break
+		}
+	}
+	return h.Max
+}
+
+func (h Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// closes minute of per room message counting once it is over,
+// must be called from processingLoop only
+func (s *Server) rollMinute(now time.Time) {
+	if now.Sub(s.minuteStart) < time.Minute {
+		return
+	}
+	if !s.minuteStart.IsZero() {
+		// quiet minutes since then count as zero, up to an hour of them
+		idle := min(int(now.Sub(s.minuteStart)/time.Minute)-1, 60)
+		for _, room := range s.clientHolder.GetRooms() {
+			s.roomRates.Observe(float64(s.minuteMessages[room]))
+			for i := 0; i < idle; i++ {
+				s.roomRates.Observe(0)
+			}
+		}
+		clear(s.minuteMessages)
+	}
+	s.minuteStart = now
+}
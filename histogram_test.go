@@ -0,0 +1,72 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{1, 10, 100})
+	if h.Quantile(0.5) != 0 || h.Mean() != 0 {
+		t.Error("empty histogram should report zeros")
+	}
+	for _, v := range []float64{1, 2, 3, 5, 7, 20, 1000} {
+		h.Observe(v)
+	}
+
+	if h.Count != 7 || h.Counts[0] != 1 || h.Counts[1] != 4 || h.Counts[2] != 1 || h.Counts[3] != 1 {
+		t.Errorf("unexpected buckets %v", h.Counts)
+	}
+	if q := h.Quantile(0.5); q != 10 {
+		t.Errorf("expected median bucket 10, got %g", q)
+	}
+	if q := h.Quantile(0.99); q != 1000 {
+		t.Errorf("values over last bound should report max, got %g", q)
+	}
+
+	c := h.clone()
+	c.Observe(1)
+	if h.Counts[0] != 1 {
+		t.Error("clone should not share buckets")
+	}
+}
+
+func TestRollMinute(t *testing.T) {
+	s := NewServer()
+	s.clientHolder.Add(NewClient("foo", "1", &fakeConn{}))
+	s.clientHolder.Add(NewClient("bar", "2", &fakeConn{}))
+	now := time.Now()
+
+	s.rollMinute(now)
+	s.minuteMessages["1"] = 30
+	s.rollMinute(now.Add(30 * time.Second))
+	if s.roomRates.Count != 0 {
+		t.Error("minute should not be closed early")
+	}
+	s.rollMinute(now.Add(3 * time.Minute))
+	// both rooms observed for closed minute and two quiet ones
+	if s.roomRates.Count != 6 || s.roomRates.Sum != 30 || len(s.minuteMessages) != 0 {
+		t.Errorf("unexpected rates %+v", s.roomRates)
+	}
+}
+
+func TestStats_histograms(t *testing.T) {
+	s := NewServer()
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+	connectAndSend(t, "a foo 1")
+	connectAndSend(t, "a bar 1", "hi")
+	connectAndSend(t, "a baz 2")
+
+	stats := s.Stats()
+	s.StopServer()
+
+	if stats.RoomSizes.Count != 2 || stats.RoomSizes.Max != 2 {
+		t.Errorf("unexpected room sizes %+v", stats.RoomSizes)
+	}
+	if stats.Fanout.Count != 1 || stats.Fanout.Sum != 2 {
+		t.Errorf("unexpected fanout %+v", stats.Fanout)
+	}
+}
@@ -0,0 +1,252 @@
+package mobster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default time after which http session without requests is closed
+const DefaultHTTPSessionTimeout = 30 * time.Second
+
+// how long poll request waits for messages
+const httpPollWait = 25 * time.Second
+
+// capacity of queues of http session, messages over it disconnect the client
+const httpQueueSize = 256
+
+// HTTPHandler returns fallback transport for clients which cannot open raw tcp connection:
+//
+//	POST /connect        auth packet as body, responds with session id
+//	POST /send?session=  message as body
+//	GET /events?session= server sent events, one per message
+//	GET /poll?session=   waits for messages, responds with json array of them
+//
+// Sessions are served like any other client, the same handlers are called.
+// Messages are text and limited to 512 bytes, regardless of server framing;
+// mount with http.StripPrefix if needed. Server has to be running.
+func (s *Server) HTTPHandler() http.Handler {
+	h := &httpTransport{server: s, sessions: make(map[string]*httpSession)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connect", method(http.MethodPost, h.connect))
+	mux.HandleFunc("/send", method(http.MethodPost, h.send))
+	mux.HandleFunc("/events", method(http.MethodGet, h.events))
+	mux.HandleFunc("/poll", method(http.MethodGet, h.poll))
+	return mux
+}
+
+// method patterns of http.ServeMux depend on module go version, so methods are checked here
+func method(m string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+type httpTransport struct {
+	server   *Server
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+}
+
+// message stream of single http client, see ServeStream
+type httpSession struct {
+	in        chan []byte
+	out       chan []byte
+	done      chan struct{} // closed when client is gone
+	closeOnce sync.Once
+	// closes session after HTTPSessionTimeout without requests, stopped while any is open,
+	// e.g. /events stream of quiet room
+	idle   *time.Timer
+	mu     sync.Mutex
+	active int
+}
+
+func (s *httpSession) Send(message []byte) error {
+	select {
+	case s.out <- append([]byte(nil), message...):
+		return nil
+	default:
+		return fmt.Errorf("http client not receiving, %d messages queued", len(s.out))
+	}
+}
+
+func (s *httpSession) Recv() ([]byte, error) {
+	select {
+	case message := <-s.in:
+		return message, nil
+	case <-s.done:
+		return nil, io.EOF
+	}
+}
+
+func (s *httpSession) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// marks request of session as open, idle timer waits for the last one to end
+func (s *httpSession) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active++
+	s.idle.Stop()
+}
+
+func (s *httpSession) end(timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	if s.active == 0 {
+		s.idle.Reset(timeout)
+	}
+}
+
+func (h *httpTransport) connect(w http.ResponseWriter, r *http.Request) {
+	auth, err := io.ReadAll(io.LimitReader(r.Body, readBufferSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	session := &httpSession{
+		in:   make(chan []byte, httpQueueSize),
+		out:  make(chan []byte, httpQueueSize),
+		done: make(chan struct{}),
+	}
+	session.idle = time.AfterFunc(h.server.httpTimeout(), session.close)
+	session.in <- auth
+
+	id := newDatagramToken()
+	h.mu.Lock()
+	h.sessions[id] = session
+	h.mu.Unlock()
+
+	var remote net.Addr = streamAddr{"http", r.RemoteAddr}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		remote = addr
+	}
+	go func() {
+		h.server.serveStream(session, remote, "http")
+		session.close()
+		session.idle.Stop()
+		h.mu.Lock()
+		delete(h.sessions, id)
+		h.mu.Unlock()
+	}()
+
+	fmt.Fprint(w, id)
+}
+
+// finds session of request and marks it active until release, responds with error
+// if there is none
+func (h *httpTransport) session(w http.ResponseWriter, r *http.Request) *httpSession {
+	h.mu.Lock()
+	session := h.sessions[r.URL.Query().Get("session")]
+	h.mu.Unlock()
+	if session == nil {
+		http.Error(w, "no such session", http.StatusGone)
+		return nil
+	}
+	session.begin()
+	return session
+}
+
+func (h *httpTransport) release(session *httpSession) {
+	session.end(h.server.httpTimeout())
+}
+
+func (s *Server) httpTimeout() time.Duration {
+	if s.HTTPSessionTimeout > 0 {
+		return s.HTTPSessionTimeout
+	}
+	return DefaultHTTPSessionTimeout
+}
+
+func (h *httpTransport) send(w http.ResponseWriter, r *http.Request) {
+	session := h.session(w, r)
+	if session == nil {
+		return
+	}
+	defer h.release(session)
+	message, err := io.ReadAll(io.LimitReader(r.Body, readBufferSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case session.in <- message:
+		w.WriteHeader(http.StatusNoContent)
+	case <-session.done:
+		http.Error(w, "no such session", http.StatusGone)
+	default:
+		http.Error(w, "too many messages", http.StatusTooManyRequests)
+	}
+}
+
+func (h *httpTransport) events(w http.ResponseWriter, r *http.Request) {
+	session := h.session(w, r)
+	if session == nil {
+		return
+	}
+	defer h.release(session)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		select {
+		case message := <-session.out:
+			// newlines would end event early, every line gets its own data field
+			for _, line := range strings.Split(string(message), "\n") {
+				fmt.Fprintf(w, "data: %s\n", line)
+			}
+			fmt.Fprint(w, "\n")
+			flusher.Flush()
+		case <-session.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *httpTransport) poll(w http.ResponseWriter, r *http.Request) {
+	session := h.session(w, r)
+	if session == nil {
+		return
+	}
+	defer h.release(session)
+	messages := []string{}
+	select {
+	case message := <-session.out:
+		messages = append(messages, string(message))
+	case <-session.done:
+		http.Error(w, "no such session", http.StatusGone)
+		return
+	case <-r.Context().Done():
+		return
+	case <-time.After(httpPollWait):
+	}
+	// take whatever else is waiting, concurrent request may take it first
+	for more := true; more; {
+		select {
+		case message := <-session.out:
+			messages = append(messages, string(message))
+		default:
+			more = false
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
@@ -0,0 +1,158 @@
+package mobster
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	s := NewServer()
+	s.Framing = FramingLengthPrefixed
+	var transport string
+	s.OnConnect = func(ops *Ops, name, room string) {
+		info, _ := ops.GetClientInfo(name)
+		transport = info.Transport
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendToRoom(room, "echo "+message)
+		ops.SendToRoom(room, "line\nbreak")
+	}
+	s.StartServer(4009)
+	web := httptest.NewServer(s.HTTPHandler())
+
+	post := func(path, body string) string {
+		resp, err := http.Post(web.URL+path, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data)
+	}
+
+	// long polling
+	session := post("/connect", "a foo 123")
+	sleep()
+	post("/send?session="+session, "hello")
+	resp, err := http.Get(web.URL + "/poll?session=" + session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	json.NewDecoder(resp.Body).Decode(&messages)
+	resp.Body.Close()
+	if len(messages) < 1 || messages[0] != "echo hello" {
+		t.Errorf("unexpected polled messages %q", messages)
+	}
+	if transport != "http" {
+		t.Errorf("wrong transport %q", transport)
+	}
+
+	// server sent events
+	session = post("/connect", "a bar 123")
+	sleep()
+	resp, err = http.Get(web.URL + "/events?session=" + session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post("/send?session="+session, "hi")
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			events <- scanner.Text()
+		}
+		close(events)
+	}()
+	expected := []string{"data: echo hi", "", "data: line", "data: break", ""}
+	for _, line := range expected {
+		select {
+		case got := <-events:
+			if got != line {
+				t.Errorf("expected event line %q, got %q", line, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no event received")
+		}
+	}
+	resp.Body.Close()
+
+	if resp, _ := http.Get(web.URL + "/poll?session=unknown"); resp.StatusCode != http.StatusGone {
+		t.Errorf("unexpected status of unknown session %d", resp.StatusCode)
+	}
+
+	s.StopServer()
+	web.Close()
+	http.DefaultClient.CloseIdleConnections()
+	for range events {
+	}
+}
+
+func TestHTTPHandler_quietEvents(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.HTTPSessionTimeout = 50 * time.Millisecond
+	var disconnected atomic.Bool
+	s.OnDisconnect = func(ops *Ops, name, room string) {
+		disconnected.Store(true)
+	}
+	s.StartServer(4009)
+	web := httptest.NewServer(s.HTTPHandler())
+
+	resp, err := http.Post(web.URL+"/connect", "text/plain", strings.NewReader("a foo 123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	session := string(data)
+	sleep()
+
+	resp, err = http.Get(web.URL + "/events?session=" + session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no traffic for longer than session timeout while stream is open
+	time.Sleep(150 * time.Millisecond)
+	s.Do(func(ops *Ops) { ops.SendTo("foo", "still here") })
+
+	lines := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	select {
+	case line := <-lines:
+		if line != "data: still here" {
+			t.Errorf("unexpected event line %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session of open event stream closed as idle")
+	}
+	if disconnected.Load() {
+		t.Error("client with open event stream disconnected")
+	}
+
+	// timer is armed again once stream is closed
+	resp.Body.Close()
+	time.Sleep(150 * time.Millisecond)
+	if !disconnected.Load() {
+		t.Error("session without requests not closed after timeout")
+	}
+
+	s.StopServer()
+	web.Close()
+	http.DefaultClient.CloseIdleConnections()
+	for range lines {
+	}
+}
@@ -0,0 +1,73 @@
+package mobster
+
+// forgets state kept for room regardless of its clients: lobby listing, password,
+// invites and mutes, must be called from processingLoop only
+func (s *Server) forgetRoom(room string) {
+	delete(s.publicRooms, room)
+	delete(s.roomPasswords, room)
+	delete(s.mutes, room)
+	for invite, r := range s.invites {
+		if r == room {
+			delete(s.invites, invite)
+		}
+	}
+	s.cancelEmptyTTL(room)
+}
+
+// tells if anything is kept for room without clients, must be called from processingLoop only
+func (s *Server) hasRoomState(room string) bool {
+	if _, ok := s.publicRooms[room]; ok {
+		return true
+	}
+	if _, ok := s.roomPasswords[room]; ok {
+		return true
+	}
+	if len(s.mutes[room]) > 0 {
+		return true
+	}
+	for _, r := range s.invites {
+		if r == room {
+			return true
+		}
+	}
+	return false
+}
+
+// arms EmptyRoomTTL of room which was just emptied, must be called from processingLoop only
+func (s *Server) startEmptyTTL(room string) {
+	if s.EmptyRoomTTL <= 0 || s.emptyRooms[room] != nil || !s.hasRoomState(room) {
+		return
+	}
+	st := &roomState{}
+	st.idle = s.armRoomTimer(room, st, s.EmptyRoomTTL, roomEmpty)
+	s.emptyRooms[room] = st
+}
+
+// must be called from processingLoop only
+func (s *Server) cancelEmptyTTL(room string) {
+	if st := s.emptyRooms[room]; st != nil {
+		st.idle.Stop()
+		delete(s.emptyRooms, room)
+	}
+}
+
+// must be called from processingLoop only
+func (s *Server) expireEmptyRoom(ops *Ops, t roomTimer) {
+	// room may be joined meanwhile
+	if s.emptyRooms[t.room] != t.state {
+		return
+	}
+	delete(s.emptyRooms, t.room)
+	if s.clientHolder.GetRoomCount(t.room) > 0 || !s.hasRoomState(t.room) {
+		return
+	}
+	s.auditf(t.room, "", "empty_room", "%s: empty for %s, forgetting room", t.room, s.EmptyRoomTTL)
+	s.forgetRoom(t.room)
+	s.roomExpired(ops, t.room)
+}
+
+func (s *Server) roomExpired(ops *Ops, room string) {
+	if s.OnRoomExpired != nil {
+		s.OnRoomExpired(ops, room)
+	}
+}
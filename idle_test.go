@@ -0,0 +1,80 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEmptyRoomTTL(t *testing.T) {
+	var expired []string
+	s := NewServer()
+	s.EmptyRoomTTL = time.Hour
+	s.OnRoomExpired = func(ops *Ops, room string) { expired = append(expired, room) }
+	ops := &Ops{s}
+	c := NewClient("foo", "room", &fakeConn{})
+	s.join(c)
+	ops.SetRoomPassword("room", "secret")
+	ops.SetRoomPublic("room", "chat")
+	s.removeClient(c)
+
+	st := s.emptyRooms["room"]
+	if st == nil {
+		t.Fatal("room with state should await ttl")
+	}
+	s.fireRoomTimer(ops, roomTimer{"room", st, roomEmpty})
+	if len(ops.GetPublicRooms()) != 0 || s.hasRoomState("room") {
+		t.Error("room state should be forgotten")
+	}
+	if len(expired) != 1 || expired[0] != "room" {
+		t.Errorf("unexpected expired rooms %v", expired)
+	}
+}
+
+func TestEmptyRoomTTL_rejoined(t *testing.T) {
+	s := NewServer()
+	s.EmptyRoomTTL = time.Hour
+	ops := &Ops{s}
+	c := NewClient("foo", "room", &fakeConn{})
+	s.join(c)
+	ops.SetRoomPassword("room", "secret")
+	s.removeClient(c)
+	st := s.emptyRooms["room"]
+
+	c = NewClient("foo", "room", &fakeConn{})
+	c.secret = "secret"
+	s.join(c)
+	s.fireRoomTimer(ops, roomTimer{"room", st, roomEmpty})
+	if !s.hasRoomState("room") {
+		t.Error("state of rejoined room should be kept")
+	}
+	s.join(NewClient("bar", "empty", &fakeConn{}))
+	if len(s.emptyRooms) != 0 {
+		t.Error("rooms without state should not await ttl")
+	}
+}
+
+func TestFlow_roomIdleTTL(t *testing.T) {
+	var expired []string
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) {}
+	s.RoomIdleTTL = 40 * time.Millisecond
+	s.OnRoomExpired = func(ops *Ops, room string) { expired = append(expired, room) }
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo room")
+	time.Sleep(25 * time.Millisecond)
+	send(t, c, "still here")
+	time.Sleep(25 * time.Millisecond)
+	if s.Stats().Clients != 1 {
+		t.Error("active room should be kept")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if s.Stats().Clients != 0 {
+		t.Error("idle room should be closed")
+	}
+	s.StopServer()
+
+	if len(expired) != 1 || expired[0] != "room" {
+		t.Errorf("unexpected expired rooms %v", expired)
+	}
+}
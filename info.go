@@ -0,0 +1,30 @@
+package mobster
+
+import "time"
+
+// static details of running server
+type ServerInfo struct {
+	Version   string    `json:"version"`
+	StartTime time.Time `json:"start_time"`
+	// addresses server listens on, datagram one included when enabled
+	Addrs []string `json:"addrs"`
+}
+
+// time since server started, zero when it is not running
+func (s *Server) Uptime() time.Duration {
+	if s.startTime.IsZero() {
+		return 0
+	}
+	return time.Since(s.startTime)
+}
+
+func (s *Server) Info() ServerInfo {
+	info := ServerInfo{Version: s.Version, StartTime: s.startTime, Addrs: []string{}}
+	if s.listener != nil {
+		info.Addrs = append(info.Addrs, s.listener.Addr().Network()+"://"+s.listener.Addr().String())
+	}
+	if s.packetConn != nil {
+		info.Addrs = append(info.Addrs, s.packetConn.LocalAddr().Network()+"://"+s.packetConn.LocalAddr().String())
+	}
+	return info
+}
@@ -0,0 +1,36 @@
+package mobster
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	s := NewServer()
+	s.Version = "1.2.3"
+	if s.Uptime() != 0 {
+		t.Error("uptime of stopped server should be zero")
+	}
+	s.StartServer(4009)
+	sleep()
+
+	info := s.Info()
+	if info.Version != "1.2.3" || info.StartTime.IsZero() {
+		t.Errorf("wrong info: %+v", info)
+	}
+	if len(info.Addrs) != 1 || !strings.HasPrefix(info.Addrs[0], "tcp://") || !strings.HasSuffix(info.Addrs[0], ":4009") {
+		t.Errorf("wrong addresses: %v", info.Addrs)
+	}
+	if s.Uptime() <= 0 {
+		t.Error("uptime not reported")
+	}
+
+	var buf bytes.Buffer
+	s.WriteStats(&buf, StatsText)
+	if !strings.HasPrefix(buf.String(), "version: 1.2.3, uptime: ") {
+		t.Errorf("no version in stats: %s", buf.String())
+	}
+
+	s.StopServer()
+}
@@ -0,0 +1,84 @@
+package mobster
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// errBadFrame is wrapped by errors of frame headers announcing frames over MaxFrameSize
+var errBadFrame = errors.New("bad frame")
+
+// low level traffic counters of server or single client, telling protocol problems
+// from application ones
+type IOStats struct {
+	// messages read, length prefixed frames or text messages after splitting
+	FramesIn  uint64 `json:"frames_in"`
+	FramesOut uint64 `json:"frames_out"`
+	BytesIn   uint64 `json:"bytes_in"`
+	BytesOut  uint64 `json:"bytes_out"`
+	// length prefixed frames which did not arrive in single read
+	ShortReads uint64 `json:"short_reads"`
+	// frames over MaxFrameSize or not fitting SplitFunc buffer
+	FramingErrors uint64 `json:"framing_errors"`
+}
+
+// updated from connection goroutines and processing loop, read by stats
+type ioCounters struct {
+	framesIn      atomic.Uint64
+	framesOut     atomic.Uint64
+	bytesIn       atomic.Uint64
+	bytesOut      atomic.Uint64
+	shortReads    atomic.Uint64
+	framingErrors atomic.Uint64
+}
+
+func (c *ioCounters) stats() IOStats {
+	return IOStats{
+		FramesIn:      c.framesIn.Load(),
+		FramesOut:     c.framesOut.Load(),
+		BytesIn:       c.bytesIn.Load(),
+		BytesOut:      c.bytesOut.Load(),
+		ShortReads:    c.shortReads.Load(),
+		FramingErrors: c.framingErrors.Load(),
+	}
+}
+
+// counts bytes and reads of connection, used by frame reader
+type countingReader struct {
+	conn  io.Reader
+	reads uint64
+	// counters of server and client, client ones are placeholder until auth
+	server, client *ioCounters
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.conn.Read(p)
+	c.reads++
+	c.server.bytesIn.Add(uint64(n))
+	c.client.bytesIn.Add(uint64(n))
+	return n, err
+}
+
+func (c *countingReader) countFrames(n int) {
+	c.server.framesIn.Add(uint64(n))
+	c.client.framesIn.Add(uint64(n))
+}
+
+func (c *countingReader) countShortRead() {
+	c.server.shortReads.Add(1)
+	c.client.shortReads.Add(1)
+}
+
+func (c *countingReader) countFramingError() {
+	c.server.framingErrors.Add(1)
+	c.client.framingErrors.Add(1)
+}
+
+// counts frames written to client, also from its connection goroutine and mailbox
+func (s *Server) countWrite(c *Client, frames, bytes int) {
+	s.io.framesOut.Add(uint64(frames))
+	s.io.bytesOut.Add(uint64(bytes))
+	c.io.framesOut.Add(uint64(frames))
+	c.io.bytesOut.Add(uint64(bytes))
+}
@@ -0,0 +1,66 @@
+package mobster
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestFlow_ioStats(t *testing.T) {
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.SendTo(user, "ok")
+	}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo 123", "one\ntwo")
+	readFromServer(t, c)
+
+	stats := s.Stats().IO
+	info, _, _ := s.Ops().GetClientInfo("foo")
+	s.StopServer()
+
+	if stats.FramesIn != 3 || stats.BytesIn != uint64(len("a foo 123")+len("one\ntwo")) {
+		t.Errorf("unexpected read counters %+v", stats)
+	}
+	if stats.FramesOut != 2 || stats.BytesOut != 4 {
+		t.Errorf("unexpected write counters %+v", stats)
+	}
+	if info.IO.FramesIn != 2 || info.IO.BytesIn != uint64(len("one\ntwo")) || info.IO.FramesOut != 2 {
+		t.Errorf("client counters should start after auth, got %+v", info.IO)
+	}
+}
+
+func TestFlow_ioStatsLengthPrefixed(t *testing.T) {
+	s := NewServer()
+	s.Framing = FramingLengthPrefixed
+	s.MaxFrameSize = 16
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) {}
+	s.OnError = func(user, op string, err error) {}
+	s.StartServer(4009)
+
+	c := connect(t)
+	sendFrame(t, c, []byte("a foo 123"))
+	sendFrame(t, c, []byte("whole"))
+	// frame split over two writes
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], 5)
+	send(t, c, string(header[:])+"sp")
+	send(t, c, "lit")
+	stats := s.Stats().IO
+
+	c2 := connect(t)
+	sendFrame(t, c2, []byte("a bar 123"))
+	binary.BigEndian.PutUint32(header[:], 1000)
+	send(t, c2, string(header[:]))
+	sleep()
+	broken := s.Stats().IO
+	s.StopServer()
+
+	if stats.FramesIn != 3 || stats.ShortReads != 1 || stats.FramingErrors != 0 {
+		t.Errorf("unexpected counters %+v", stats)
+	}
+	if broken.FramingErrors != 1 {
+		t.Errorf("oversized frame should be counted, got %+v", broken)
+	}
+}
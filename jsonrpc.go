@@ -0,0 +1,193 @@
+package mobster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// handles json-rpc 2.0 method registered with HandleRPC, returned result or error
+// is sent back to the client correlated by request id
+type RPCHandler func(ops *Ops, user, room string, params json.RawMessage) (result any, err error)
+
+// json-rpc 2.0 error codes
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	// code of HandlerError and ErrForbidden, their code is passed as error data
+	RPCHandlerError = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// route json-rpc 2.0 requests calling given method to handler, once any method is
+// registered messages starting with "{" or "[" are treated as json-rpc requests;
+// has to be called before server starts
+func (s *Server) HandleRPC(method string, handler RPCHandler) {
+	if s.rpcMethods == nil {
+		s.rpcMethods = make(map[string]RPCHandler)
+	}
+	s.rpcMethods[method] = handler
+}
+
+// registers json-rpc method with params decoded to P, symmetric to RegisterMessage
+func RegisterRPC[P, R any](s *Server, method string, handler func(ops *Ops, user, room string, params P) (R, error)) {
+	s.HandleRPC(method, func(ops *Ops, user, room string, raw json.RawMessage) (any, error) {
+		var params P
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, &rpcError{Code: RPCInvalidParams, Message: err.Error()}
+			}
+		}
+		return handler(ops, user, room, params)
+	})
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func isRPC(message string) bool {
+	trimmed := bytes.TrimLeft([]byte(message), " \t\r\n")
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// handles single or batch json-rpc request, must be called from processingLoop only
+func (s *Server) handleRPC(ops *Ops, user, room, message string) {
+	var responses []rpcResponse
+	data := bytes.TrimLeft([]byte(message), " \t\r\n")
+	if data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil || len(batch) == 0 {
+			s.writeRPC(user, rpcFailure(nil, RPCInvalidRequest, "invalid request"))
+			return
+		}
+		for _, raw := range batch {
+			if r, ok := s.callRPC(ops, user, room, raw); ok {
+				responses = append(responses, r)
+			}
+		}
+		// responses to batch of notifications only are not sent at all
+		if len(responses) > 0 {
+			s.writeRPC(user, responses)
+		}
+		return
+	}
+	if r, ok := s.callRPC(ops, user, room, data); ok {
+		s.writeRPC(user, r)
+	}
+}
+
+// calls method of request, tells if response should be sent, it is not for notifications
+func (s *Server) callRPC(ops *Ops, user, room string, raw json.RawMessage) (rpcResponse, bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return rpcFailure(nil, RPCParseError, "parse error"), true
+		}
+		return rpcFailure(nil, RPCInvalidRequest, "invalid request"), true
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(req.ID, RPCInvalidRequest, "invalid request"), true
+	}
+	notification := len(req.ID) == 0
+	handler, ok := s.rpcMethods[req.Method]
+	if !ok {
+		return rpcFailure(req.ID, RPCMethodNotFound, "method not found"), !notification
+	}
+	result, err := handler(ops, user, room, req.Params)
+	if notification {
+		return rpcResponse{}, false
+	}
+	if err != nil {
+		return rpcResponse{JSONRPC: "2.0", Error: s.rpcErrorOf(user, err), ID: req.ID}, true
+	}
+	if result == nil {
+		// result member is required on success
+		result = json.RawMessage("null")
+	}
+	return rpcResponse{JSONRPC: "2.0", Result: result, ID: req.ID}, true
+}
+
+// maps handler error to json-rpc error, internal errors are not exposed to clients
+func (s *Server) rpcErrorOf(user string, err error) *rpcError {
+	var rpcErr *rpcError
+	var handlerErr *HandlerError
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.As(err, &handlerErr):
+		return &rpcError{Code: RPCHandlerError, Message: handlerErr.Message, Data: handlerErr.Code}
+	case errors.Is(err, ErrForbidden):
+		return &rpcError{Code: RPCHandlerError, Message: err.Error(), Data: "forbidden"}
+	default:
+		s.OnError(user, "handler", err)
+		return &rpcError{Code: RPCInternalError, Message: "internal error"}
+	}
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) rpcResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: code, Message: message}, ID: id}
+}
+
+// must be called from processingLoop only
+func (s *Server) writeRPC(user string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.OnError(user, "handler", err)
+		return
+	}
+	if c := s.clientHolder.GetByName(user); c != nil {
+		s.write(c, string(data))
+	}
+}
+
+// send json-rpc notification to given user
+func (o *Ops) Notify(user, method string, params any) error {
+	data, err := json.Marshal(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	return o.SendToWithResult(user, string(data))
+}
+
+// send json-rpc notification to all users in given room
+func (o *Ops) NotifyRoom(room, method string, params any) error {
+	data, err := json.Marshal(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	o.SendToRoom(room, string(data))
+	return nil
+}
@@ -0,0 +1,69 @@
+package mobster
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHandleRPC(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.OnError = func(user, op string, err error) {}
+	conn := &fakeConn{}
+	s.clientHolder.Add(NewClient("foo", "123", conn))
+	ops := &Ops{s}
+
+	type sum struct{ A, B int }
+	RegisterRPC(s, "add", func(ops *Ops, user, room string, p sum) (int, error) {
+		return p.A + p.B, nil
+	})
+	RegisterRPC(s, "fail", func(ops *Ops, user, room string, p sum) (any, error) {
+		if p.A == 1 {
+			return nil, Errorf("bad_move", "not your turn")
+		}
+		return nil, errors.New("database down")
+	})
+	var notified bool
+	RegisterRPC(s, "ping", func(ops *Ops, user, room string, p any) (any, error) {
+		notified = true
+		return nil, nil
+	})
+	var plain string
+	s.OnMessage = func(ops *Ops, user, room, message string) { plain = message }
+
+	tests := []struct {
+		request, response string
+	}{
+		{`{"jsonrpc":"2.0","method":"add","params":{"A":1,"B":2},"id":1}`, `{"jsonrpc":"2.0","result":3,"id":1}`},
+		{`{"jsonrpc":"2.0","method":"fail","params":{"A":1},"id":"x"}`, `{"jsonrpc":"2.0","error":{"code":-32000,"message":"not your turn","data":"bad_move"},"id":"x"}`},
+		{`{"jsonrpc":"2.0","method":"fail","params":{"A":2},"id":2}`, `{"jsonrpc":"2.0","error":{"code":-32603,"message":"internal error"},"id":2}`},
+		{`{"jsonrpc":"2.0","method":"add","params":"bad","id":3}`, `{"jsonrpc":"2.0","error":{"code":-32602,"message":"json: cannot unmarshal string into Go value of type mobster.sum"},"id":3}`},
+		{`{"jsonrpc":"2.0","method":"nope","id":4}`, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found"},"id":4}`},
+		{`{"jsonrpc":"2.0","method"`, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error"},"id":null}`},
+		{`[{"jsonrpc":"2.0","method":"add","params":{"A":2,"B":2},"id":5},{"jsonrpc":"2.0","method":"ping"}]`, `[{"jsonrpc":"2.0","result":4,"id":5}]`},
+	}
+	for _, test := range tests {
+		conn.written = nil
+		s.dispatch(ops, "foo", "123", test.request)
+		if len(conn.written) != 1 || conn.written[0] != test.response {
+			t.Errorf("%s: expected %s, got %q", test.request, test.response, conn.written)
+		}
+	}
+
+	conn.written = nil
+	s.dispatch(ops, "foo", "123", `{"jsonrpc":"2.0","method":"ping"}`)
+	if !notified || len(conn.written) != 0 {
+		t.Error("notification should be handled without response")
+	}
+
+	s.dispatch(ops, "foo", "123", "plain message")
+	if plain != "plain message" {
+		t.Error("non json-rpc message should reach OnMessage")
+	}
+
+	conn.written = nil
+	ops.NotifyRoom("123", "tick", map[string]int{"n": 1})
+	if len(conn.written) != 1 || conn.written[0] != `{"jsonrpc":"2.0","method":"tick","params":{"n":1}}` {
+		t.Errorf("unexpected notification %q", conn.written)
+	}
+}
@@ -0,0 +1,42 @@
+package mobster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// public room as seen in lobby
+type RoomListing struct {
+	Room        string
+	Description string
+	Users       int
+}
+
+// list room in lobby, rooms stay listed, even when empty, until SetRoomPrivate
+func (o *Ops) SetRoomPublic(room, description string) {
+	o.server.publicRooms[room] = description
+}
+
+// remove room from lobby
+func (o *Ops) SetRoomPrivate(room string) {
+	delete(o.server.publicRooms, room)
+}
+
+// get public rooms sorted by name
+func (o *Ops) GetPublicRooms() []RoomListing {
+	rooms := []RoomListing{}
+	for room, description := range o.server.publicRooms {
+		rooms = append(rooms, RoomListing{room, description, o.GetRoomCount(room)})
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Room < rooms[j].Room })
+	return rooms
+}
+
+func formatRoomList(rooms []RoomListing) string {
+	lines := make([]string, len(rooms))
+	for idx, r := range rooms {
+		lines[idx] = fmt.Sprintf("%s %d %s", r.Room, r.Users, r.Description)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,32 @@
+package mobster
+
+import "testing"
+
+func TestFlow_lobby(t *testing.T) {
+	called := false
+	s := NewServer()
+	s.LobbyCommand = "/rooms"
+	s.OnConnect = func(ops *Ops, name, room string) {
+		ops.SetRoomPublic("chess", "blitz only")
+		ops.SetRoomPublic("go", "9x9")
+		ops.SetRoomPublic("secret", "")
+		ops.SetRoomPrivate("secret")
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		called = true
+	}
+	s.StartServer(4009)
+
+	connectAndSend(t, "a foo chess")
+	c := connectAndSend(t, "a bar chess")
+	send(t, c, "/rooms")
+
+	if r := readFromServer(t, c); r != "chess 2 blitz only\ngo 0 9x9" {
+		t.Errorf("unexpected room list: %q", r)
+	}
+	if called {
+		t.Error("lobby command should not reach OnMessage")
+	}
+
+	s.StopServer()
+}
@@ -0,0 +1,245 @@
+package mobster
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// writer goroutine of room: processing loop still runs handlers and owns server state,
+// so handlers never race with each other, but frames prepared there are written to
+// connections by mailbox of recipient's room, so that slow clients hold up only writes
+// to their own room and not the loop with all other rooms; started when room gets its
+// first client and stopped when it empties, writes queued until then are still done
+type roomMailbox struct {
+	mu sync.Mutex
+	// urgent writes go before regular ones, see PriorityHigh
+	urgent  []mailboxItem
+	items   []mailboxItem
+	stopped bool
+	// signalled when item is queued or mailbox is stopped
+	ready chan struct{}
+	// closed when goroutine is over, connections are not written to by it anymore
+	done chan struct{}
+}
+
+// write of framed data carrying given messages, final frame of connection when closing;
+// item without client is barrier, result is sent when writes queued before it are done
+type mailboxItem struct {
+	client   *Client
+	conn     ClientConn
+	data     []byte
+	messages []string
+	closing  bool
+	// receives result of write when caller waits for it, nil otherwise
+	result chan error
+}
+
+// write done by mailbox which failed, handled by processing loop
+type writeFailure struct {
+	client   *Client
+	conn     ClientConn
+	messages []string
+	err      error
+}
+
+func newRoomMailbox() *roomMailbox {
+	return &roomMailbox{ready: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+// queues item, false when mailbox is stopped already
+func (m *roomMailbox) push(item mailboxItem, urgent bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return false
+	}
+	if urgent {
+		m.urgent = append(m.urgent, item)
+	} else {
+		m.items = append(m.items, item)
+	}
+	m.signal()
+	return true
+}
+
+// next item to write, false when mailbox is stopped and nothing is left
+func (m *roomMailbox) next() (mailboxItem, bool) {
+	for {
+		m.mu.Lock()
+		for _, queue := range []*[]mailboxItem{&m.urgent, &m.items} {
+			if len(*queue) > 0 {
+				item := (*queue)[0]
+				*queue = (*queue)[1:]
+				m.mu.Unlock()
+				return item, true
+			}
+		}
+		stopped := m.stopped
+		m.mu.Unlock()
+		if stopped {
+			return mailboxItem{}, false
+		}
+		<-m.ready
+	}
+}
+
+// rejects further items, goroutine ends once queued ones are written
+func (m *roomMailbox) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped = true
+	m.signal()
+}
+
+// waits until items queued so far are written
+func (m *roomMailbox) flush() {
+	result := make(chan error, 1)
+	if !m.push(mailboxItem{result: result}, false) {
+		<-m.done
+		return
+	}
+	<-result
+}
+
+func (m *roomMailbox) signal() {
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+}
+
+// writes items of mailbox until it is stopped
+func (s *Server) runMailbox(m *roomMailbox) {
+	defer s.shutdownWaitGroup.Done()
+	defer close(m.done)
+	// connections which failed or were closed, later writes to them fail right away
+	broken := make(map[ClientConn]error)
+	for {
+		item, ok := m.next()
+		if !ok {
+			return
+		}
+		if item.client == nil {
+			item.result <- nil
+			continue
+		}
+		err := broken[item.conn]
+		if item.closing {
+			if err == nil {
+				s.writeClose(item.conn, item.data)
+				item.conn.Close()
+				broken[item.conn] = net.ErrClosed
+			}
+			continue
+		}
+		if err == nil {
+			var n int
+			n, err = s.writeConn(item.conn, item.data)
+			s.countWrite(item.client, max(len(item.messages), 1), n)
+			if err != nil {
+				broken[item.conn] = err
+			}
+		}
+		if item.result != nil {
+			item.result <- err
+		} else if err != nil {
+			s.reportWriteFailure(writeFailure{client: item.client, conn: item.conn, messages: item.messages, err: err})
+		}
+	}
+}
+
+// hands failed write over to processing loop without waiting for it, as loop may be
+// waiting for this mailbox itself
+func (s *Server) reportWriteFailure(f writeFailure) {
+	s.failuresMu.Lock()
+	defer s.failuresMu.Unlock()
+	s.writeFailures = append(s.writeFailures, f)
+	select {
+	case s.writesFailed <- struct{}{}:
+	default:
+	}
+}
+
+// disconnects clients which writes failed in mailboxes, must be called from processingLoop only
+func (s *Server) handleWriteFailures() {
+	s.failuresMu.Lock()
+	failures := s.writeFailures
+	s.writeFailures = nil
+	s.failuresMu.Unlock()
+	for _, f := range failures {
+		if s.clientHolder.Has(f.client) && f.client.conn == f.conn {
+			s.writeFailed(f.client, f.messages, f.err)
+			continue
+		}
+		// queued before failure of earlier write was noticed
+		for _, message := range f.messages {
+			s.queuePending(f.client.user, message)
+		}
+	}
+}
+
+// starts mailbox of room which got its first client, must be called from processingLoop only
+func (s *Server) startMailbox(room string) {
+	select {
+	case <-s.loopStarted:
+	default:
+		// clients are written to synchronously when there is no processing loop, e.g. in tests
+		return
+	}
+	m := newRoomMailbox()
+	s.mailboxes[room] = m
+	s.shutdownWaitGroup.Add(1)
+	go s.runMailbox(m)
+}
+
+// stops mailbox of room which got empty, must be called from processingLoop only
+func (s *Server) stopMailbox(room string) {
+	if m := s.mailboxes[room]; m != nil {
+		delete(s.mailboxes, room)
+		m.stop()
+	}
+}
+
+// hands connection of client over to mailbox of its room, writes queued in previous one
+// are waited for, so that they are not reordered; bots and suspended clients are written
+// to by processing loop itself, must be called from processingLoop only
+func (s *Server) attachMailbox(c *Client) {
+	m := s.mailboxes[c.room]
+	if _, suspended := c.conn.(*graceConn); c.bot != nil || suspended || m == c.mailbox {
+		return
+	}
+	if c.mailbox != nil {
+		c.mailbox.flush()
+	}
+	c.mailbox = m
+}
+
+// sends close code and closes connection of client after writes queued for it,
+// must be called from processingLoop only
+func (s *Server) closeConn(c *Client, code CloseCode) {
+	frame := s.closeFrame(c.codec, code)
+	if m := c.mailbox; m != nil {
+		if m.push(mailboxItem{client: c, conn: c.conn, data: frame, closing: true}, false) {
+			return
+		}
+		// stopped meanwhile, connection is free once earlier writes are done
+		<-m.done
+		c.mailbox = nil
+	}
+	s.writeClose(c.conn, frame)
+	c.conn.Close()
+}
+
+// writes data with WriteTimeout, called from processing loop or mailboxes
+func (s *Server) writeConn(conn ClientConn, data []byte) (int, error) {
+	if dc, ok := conn.(interface{ SetWriteDeadline(time.Time) error }); ok && s.WriteTimeout > 0 {
+		dc.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+	n, err := conn.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
@@ -0,0 +1,145 @@
+package mobster
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlow_slowRoomDoesNotBlockOthers(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.WriteTimeout = 2 * time.Second
+	big := strings.Repeat("x", 1<<20)
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		if message == "flood" {
+			for range 16 {
+				ops.SendToRoom("slow", big)
+			}
+			return
+		}
+		ops.SendTo(user, "echo "+message)
+	}
+	s.StartServer(4009)
+	defer s.StopServer()
+
+	// never reads, so writes to its room block until deadline
+	slow := connectAndSend(t, "a foo slow")
+	defer slow.Close()
+	fast := connectAndSend(t, "a bar fast", "flood")
+	defer fast.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	send(t, fast, "hello")
+	if got := readFromServer(t, fast); got != "echo hello" {
+		t.Errorf("unexpected reply %q", got)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("other room waited for slow one")
+	}
+}
+
+func TestFlow_mailboxPerRoom(t *testing.T) {
+	s := NewServer()
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.MoveToRoom(user, message)
+	}
+	s.StartServer(4009)
+	defer s.StopServer()
+	mailboxes := func() (rooms []string) {
+		s.Do(func(ops *Ops) {
+			for room := range s.mailboxes {
+				rooms = append(rooms, room)
+			}
+		})
+		return rooms
+	}
+
+	c := connectAndSend(t, "a foo 123")
+	defer c.Close()
+	if rooms := mailboxes(); len(rooms) != 1 || rooms[0] != "123" {
+		t.Errorf("expected mailbox of joined room, got %v", rooms)
+	}
+	var stopped *roomMailbox
+	s.Do(func(ops *Ops) { stopped = s.mailboxes["123"] })
+
+	send(t, c, "456")
+	if rooms := mailboxes(); len(rooms) != 1 || rooms[0] != "456" {
+		t.Errorf("expected mailbox of emptied room to be replaced, got %v", rooms)
+	}
+	select {
+	case <-stopped.done:
+	case <-time.After(time.Second):
+		t.Error("mailbox of emptied room not stopped")
+	}
+}
+
+func TestFlow_moveKeepsWriteOrder(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.SendTo(user, "one")
+		ops.MoveToRoom(user, "456")
+		ops.SendTo(user, "two")
+	}
+	s.StartServer(4009)
+	defer s.StopServer()
+
+	c := connectAndSend(t, "a foo 123", "go")
+	defer c.Close()
+	var got string
+	for len(got) < len("onetwo") {
+		message := readFromServer(t, c)
+		if message == "" {
+			break
+		}
+		got += message
+	}
+	if got != "onetwo" {
+		t.Errorf("writes reordered on move, got %q", got)
+	}
+}
+
+func TestFlow_mailboxWriteFailure(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.WriteTimeout = 20 * time.Millisecond
+	s.ResendWindow = time.Minute
+	big := strings.Repeat("x", 1<<20)
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		for range 16 {
+			ops.SendTo(user, big)
+		}
+	}
+	errs := make(chan string, 16)
+	s.OnError = func(user, op string, err error) { errs <- op }
+	disconnected := make(chan string, 1)
+	s.OnDisconnect = func(ops *Ops, user, room string) { disconnected <- user }
+	s.StartServer(4009)
+	defer s.StopServer()
+
+	// never reads after sending, so writes fail with deadline
+	c := connectAndSend(t, "a foo 123", "flood")
+	defer c.Close()
+	select {
+	case user := <-disconnected:
+		if user != "foo" {
+			t.Errorf("unexpected user %s", user)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("client not disconnected after failed write")
+	}
+	if op := <-errs; op != "write" {
+		t.Errorf("expected write error, got %s", op)
+	}
+	var pending int
+	s.Do(func(ops *Ops) {
+		if p := s.pending["foo"]; p != nil {
+			pending = len(p.messages)
+		}
+	})
+	if pending == 0 {
+		t.Error("messages of failed writes not kept for resend")
+	}
+}
@@ -0,0 +1,109 @@
+package mobster
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// default time before scheduled shutdown when new connections are rejected
+const DefaultMaintenanceCutoff = 1 * time.Minute
+
+// announcement sent to all clients ahead of scheduled shutdown
+type NoticeSchedule struct {
+	// how long before shutdown notice is sent
+	Before time.Duration
+	// sent as is, formatted by FormatShutdownNotice when empty
+	Message string
+}
+
+func formatShutdownNotice(remaining time.Duration) string {
+	return fmt.Sprintf("server shutdown in %s", remaining.Round(time.Second))
+}
+
+// ScheduleShutdown announces shutdown to all clients according to notices, rejects new
+// connections MaintenanceCutoff before it and stops server at given time; returned
+// function cancels it, unless server already stopped
+func (s *Server) ScheduleShutdown(at time.Time, notices []NoticeSchedule) (cancel func()) {
+	cutoff := s.MaintenanceCutoff
+	if cutoff <= 0 {
+		cutoff = DefaultMaintenanceCutoff
+	}
+	notices = append([]NoticeSchedule(nil), notices...)
+	sort.Slice(notices, func(i, j int) bool { return notices[i].Before > notices[j].Before })
+
+	canceled := make(chan struct{})
+	go func() {
+		wait := func(until time.Time) bool {
+			timer := time.NewTimer(time.Until(until))
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				return true
+			case <-canceled:
+			case <-s.stopping:
+			}
+			return false
+		}
+		lockedOut := false
+		lockOut := func() {
+			if !lockedOut {
+				lockedOut = true
+				s.maintenance.Store(true)
+				log.Printf("maintenance, no new connections accepted")
+			}
+		}
+		defer func() {
+			if lockedOut {
+				s.maintenance.Store(false)
+			}
+		}()
+		for _, n := range notices {
+			if n.Before < cutoff && !lockedOut {
+				if !wait(at.Add(-cutoff)) {
+					return
+				}
+				lockOut()
+			}
+			if !wait(at.Add(-n.Before)) {
+				return
+			}
+			message := n.Message
+			if message == "" {
+				message = s.FormatShutdownNotice(time.Until(at))
+			}
+			select {
+			case s.shutdownNotices <- message:
+			case <-canceled:
+				return
+			case <-s.stopping:
+				return
+			}
+		}
+		if !lockedOut {
+			if !wait(at.Add(-cutoff)) {
+				return
+			}
+			lockOut()
+		}
+		if !wait(at) {
+			return
+		}
+		log.Printf("scheduled shutdown")
+		s.StopServer()
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(canceled) })
+	}
+}
+
+// sends notice to every connected client, must be called from processingLoop only
+func (s *Server) announceShutdown(message string) {
+	s.auditf("", "", "shutdown_notice", "shutdown notice: %s", message)
+	for _, c := range s.clientHolder.GetAll() {
+		s.write(c, message)
+	}
+}
@@ -0,0 +1,56 @@
+package mobster
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleShutdown(t *testing.T) {
+	s := NewServer()
+	s.MaintenanceCutoff = 120 * time.Millisecond
+	s.MaintenanceMessage = "maintenance"
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	s.ScheduleShutdown(time.Now().Add(300*time.Millisecond), []NoticeSchedule{
+		{Before: 60 * time.Millisecond, Message: "last call"},
+		{Before: 240 * time.Millisecond},
+	})
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	var buf [64]byte
+	n, _ := c.Read(buf[:])
+	if notice := string(buf[:n]); !strings.HasPrefix(notice, "server shutdown in ") {
+		t.Errorf("expected countdown notice, got %q", notice)
+	}
+	time.Sleep(150 * time.Millisecond)
+	late := connect(t)
+	if msg := readFromServer(t, late); msg != "maintenance" {
+		t.Errorf("late connection should be rejected, got %q", msg)
+	}
+	n, _ = c.Read(buf[:])
+	if notice := string(buf[:n]); notice != "last call" {
+		t.Errorf("expected last notice, got %q", notice)
+	}
+	if _, err := c.Read(buf[:]); err == nil {
+		t.Error("client should be disconnected at shutdown")
+	}
+	// stopping again only waits for shutdown to finish
+	s.StopServer()
+}
+
+func TestScheduleShutdown_cancel(t *testing.T) {
+	s := NewServer()
+	s.StartServer(4009)
+	cancel := s.ScheduleShutdown(time.Now().Add(20*time.Millisecond), nil)
+	cancel()
+	cancel()
+	time.Sleep(40 * time.Millisecond)
+
+	connectAndSend(t, "a foo 123")
+	if clients := s.Stats().Clients; clients != 1 {
+		t.Errorf("canceled shutdown should not reject connections, got %d clients", clients)
+	}
+	s.StopServer()
+}
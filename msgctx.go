@@ -0,0 +1,50 @@
+package mobster
+
+import "context"
+
+// handles request with its context available from Ops.Context, parent carries span
+// when traced, must be called from processingLoop only
+func (s *Server) handleInContext(ops *Ops, r Request, parent context.Context) {
+	ctx, cancel := s.messageContext(parent, r.client)
+	s.handlerCtx = ctx
+	defer func() {
+		s.handlerCtx = nil
+		cancel()
+	}()
+	s.handleRequest(ops, r)
+}
+
+// derives context of single message, cancelled when client connection is lost or closed
+// and after MessageTimeout
+func (s *Server) messageContext(parent context.Context, c *Client) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if s.MessageTimeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, s.MessageTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	if c.ctx == nil {
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(c.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// starts context of client connection, cancelled by returned function
+func (c *Client) startContext() context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.ctx = ctx
+	c.cancel = cancel
+	return cancel
+}
+
+// cancels context of client connection, e.g. calls done on behalf of the message being handled
+func (c *Client) cancelContext() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
@@ -0,0 +1,90 @@
+package mobster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFlow_messageTimeout(t *testing.T) {
+	var err error
+	var hasDeadline bool
+	var stored context.Context
+	s := NewServer()
+	s.MessageTimeout = 10 * time.Millisecond
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessageContext = func(ctx context.Context, ops *Ops, user, room, message string) {
+		_, hasDeadline = ctx.Deadline()
+		stored = ops.Context()
+		<-ctx.Done()
+		err = ctx.Err()
+	}
+	s.StartServer(4009)
+	connectAndSend(t, "a foo 123", "slow")
+	time.Sleep(20 * time.Millisecond)
+	s.StopServer()
+
+	if !hasDeadline || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("handler context should time out, got %v", err)
+	}
+	if stored == nil || stored.Err() == nil {
+		t.Error("Ops.Context should be the one passed to handler and end with it")
+	}
+}
+
+func TestFlow_messageContextCancelledOnDisconnect(t *testing.T) {
+	result := make(chan error, 1)
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnDisconnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		select {
+		case <-ops.Context().Done():
+			result <- ops.Context().Err()
+		case <-time.After(time.Second):
+			result <- nil
+		}
+	}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo 123", "slow")
+	sleep()
+	c.Close()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("handler context should be cancelled when client is gone, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("handler did not finish")
+	}
+	s.StopServer()
+}
+
+func TestMessageContext(t *testing.T) {
+	s := NewServer()
+	if ctx := (&Ops{s}).Context(); ctx != context.Background() {
+		t.Error("background context expected outside of handlers")
+	}
+
+	c := NewClient("foo", "123", &fakeConn{})
+	ctx, cancel := s.messageContext(context.Background(), c)
+	if ctx.Err() != nil {
+		t.Error("context of client not read by server should stay alive")
+	}
+	cancel()
+	if ctx.Err() == nil {
+		t.Error("context should end with message")
+	}
+
+	c.startContext()
+	ctx, cancel = s.messageContext(context.Background(), c)
+	defer cancel()
+	c.cancelContext()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("context should end with client")
+	}
+}
@@ -0,0 +1,69 @@
+package mobster
+
+// tells what happens when user over MaxConnectionsPerUser connects again
+type DuplicateLoginPolicy int
+
+const (
+	// oldest connections of the user are disconnected to make room for the new one
+	DuplicateKickOld DuplicateLoginPolicy = iota
+	// new connection is refused
+	DuplicateReject
+)
+
+// applies MaxConnectionsPerUser to joining client, false if it was refused,
+// must be called from processingLoop only
+func (s *Server) admitConnection(c *Client) bool {
+	if s.MaxConnectionsPerUser <= 0 || c.bot != nil {
+		return true
+	}
+	existing := s.clientHolder.GetAllByName(c.user)
+	over := len(existing) - s.MaxConnectionsPerUser + 1
+	if over <= 0 {
+		return true
+	}
+	if s.DuplicateLogin == DuplicateReject {
+		s.auditf(c.room, c.user, "duplicate_refused", "%s: %s already connected, connection refused", c.room, c.user)
+		s.sendClose(c.conn, c.codec, CloseJoinDenied)
+		c.conn.Close()
+		return false
+	}
+	for _, old := range existing[:over] {
+		s.takeOver(old, c)
+	}
+	return true
+}
+
+// drops older connection of user who connected again, telling it why,
+// must be called from processingLoop only
+func (s *Server) takeOver(old, c *Client) {
+	s.auditf(old.room, old.user, "duplicate_kicked", "%s: %s connected again from %s, dropping older connection", old.room, old.user, c.conn.RemoteAddr())
+	displaced := old.info()
+	// failed write disconnects client already
+	if s.LoggedInElsewhereMessage == "" || s.write(old, s.LoggedInElsewhereMessage) == nil {
+		s.disconnect(old, CloseLoggedInElsewhere)
+	}
+	if s.OnDuplicateLogin != nil {
+		s.OnDuplicateLogin(&Ops{s}, displaced, c.info())
+	}
+}
+
+// writes message to every connection of user, ErrNotConnected when there is none,
+// must be called from processingLoop only
+func (s *Server) writeToUser(user, message string) (err error) {
+	clients := s.clientHolder.clientsByName[user]
+	if len(clients) == 0 {
+		return ErrNotConnected
+	}
+	end := s.traceWrite("mobster.send", user, "", len(clients))
+	defer func() { end(err) }()
+	if len(clients) == 1 {
+		return s.write(clients[0], message)
+	}
+	// copied as failed write removes client
+	for _, c := range s.clientHolder.GetAllByName(user) {
+		if e := s.write(c, message); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
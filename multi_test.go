@@ -0,0 +1,88 @@
+package mobster
+
+import (
+	"testing"
+)
+
+func TestFlow_multipleConnections(t *testing.T) {
+	connects := 0
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {
+		connects++
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		ops.SendTo(user, message)
+	}
+	s.StartServer(4009)
+
+	phone := connectAndSend(t, "a foo 123")
+	desktop := connectAndSend(t, "a foo 456", "hi")
+	if msg := readFromServer(t, phone); msg != "hi" {
+		t.Errorf("phone should get message, got %q", msg)
+	}
+	if msg := readFromServer(t, desktop); msg != "hi" {
+		t.Errorf("desktop should get message, got %q", msg)
+	}
+	s.StopServer()
+
+	if connects != 2 {
+		t.Errorf("expected connect per connection, got %d", connects)
+	}
+}
+
+func TestFlow_duplicateLogin(t *testing.T) {
+	for _, policy := range []DuplicateLoginPolicy{DuplicateKickOld, DuplicateReject} {
+		s := NewServer()
+		s.SendCloseCodes = true
+		s.MaxConnectionsPerUser = 1
+		s.DuplicateLogin = policy
+		s.StartServer(4009)
+
+		first := connectAndSend(t, "a foo 123")
+		second := connectAndSend(t, "a foo 123")
+		dropped, expected := first, "close logged_in_elsewhere"
+		if policy == DuplicateReject {
+			dropped, expected = second, "close join_denied"
+		}
+		if msg := readFromServer(t, dropped); msg != expected {
+			t.Errorf("policy %d: expected %q, got %q", policy, expected, msg)
+		}
+		if count := s.Stats().Clients; count != 1 {
+			t.Errorf("policy %d: expected single connection, got %d", policy, count)
+		}
+		s.StopServer()
+	}
+}
+
+func TestFlow_duplicateLoginTakeover(t *testing.T) {
+	var displaced, current ClientInfo
+	var codes []CloseCode
+	s := NewServer()
+	s.MaxConnectionsPerUser = 1
+	s.LoggedInElsewhereMessage = "logged in elsewhere"
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnDisconnectCode = func(ops *Ops, user, room string, code CloseCode) {
+		codes = append(codes, code)
+	}
+	s.OnDuplicateLogin = func(ops *Ops, old, new ClientInfo) {
+		displaced, current = old, new
+	}
+	s.StartServer(4009)
+
+	first := connectAndSend(t, "a foo 123")
+	second := connectAndSend(t, "a foo 456")
+	if msg := readFromServer(t, first); msg != "logged in elsewhere" {
+		t.Errorf("displaced connection should be told why, got %q", msg)
+	}
+	s.StopServer()
+
+	if displaced.Room != "123" || current.Room != "456" || displaced.User != "foo" {
+		t.Errorf("unexpected takeover %+v -> %+v", displaced, current)
+	}
+	if displaced.RemoteAddr.String() != first.LocalAddr().String() || current.RemoteAddr.String() != second.LocalAddr().String() {
+		t.Errorf("takeover should tell both addresses, got %v and %v", displaced.RemoteAddr, current.RemoteAddr)
+	}
+	if len(codes) == 0 || codes[0] != CloseLoggedInElsewhere {
+		t.Errorf("expected logged in elsewhere close code, got %v", codes)
+	}
+}
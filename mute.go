@@ -0,0 +1,50 @@
+package mobster
+
+import (
+	"time"
+)
+
+// drop messages of user in room for given duration, forever (until Unmute) when zero
+func (o *Ops) Mute(room, user string, duration time.Duration) {
+	s := o.server
+	now := time.Now()
+	for r, users := range s.mutes {
+		for u, until := range users {
+			if !until.IsZero() && now.After(until) {
+				delete(users, u)
+			}
+		}
+		if len(users) == 0 {
+			delete(s.mutes, r)
+		}
+	}
+
+	if s.mutes[room] == nil {
+		s.mutes[room] = make(map[string]time.Time)
+	}
+	var until time.Time
+	if duration > 0 {
+		until = now.Add(duration)
+	}
+	s.mutes[room][user] = until
+	s.auditf(room, user, "mute", "%s: %s muted for %s", room, user, duration)
+}
+
+func (o *Ops) Unmute(room, user string) {
+	delete(o.server.mutes[room], user)
+	if len(o.server.mutes[room]) == 0 {
+		delete(o.server.mutes, room)
+	}
+}
+
+func (o *Ops) IsMuted(room, user string) bool {
+	until, ok := o.server.mutes[room][user]
+	if !ok {
+		return false
+	}
+	if !until.IsZero() && time.Now().After(until) {
+		o.Unmute(room, user)
+		return false
+	}
+	return true
+}
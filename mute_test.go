@@ -0,0 +1,58 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMute(t *testing.T) {
+	ops := &Ops{NewServer()}
+
+	ops.Mute("1", "foo", 0)
+	ops.Mute("1", "bar", time.Millisecond)
+	if !ops.IsMuted("1", "foo") || !ops.IsMuted("1", "bar") {
+		t.Error("users should be muted")
+	}
+	if ops.IsMuted("2", "foo") {
+		t.Error("mutes should be per room")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if ops.IsMuted("1", "bar") {
+		t.Error("mute should expire")
+	}
+	ops.Unmute("1", "foo")
+	if ops.IsMuted("1", "foo") {
+		t.Error("user should be unmuted")
+	}
+	if len(ops.server.mutes) != 0 {
+		t.Error("mutes not cleaned up")
+	}
+}
+
+func TestFlow_mutedMessagesDropped(t *testing.T) {
+	var messages []string
+	s := NewServer()
+	s.MutedMessage = "you are muted"
+	s.OnConnect = func(ops *Ops, name, room string) {
+		ops.Mute(room, "bar", time.Minute)
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		messages = append(messages, message)
+	}
+	s.StartServer(4009)
+
+	c1 := connectAndSend(t, "a foo 123")
+	c2 := connectAndSend(t, "a bar 123")
+	send(t, c1, "hi")
+	send(t, c2, "you all suck")
+
+	if r := readFromServer(t, c2); r != "you are muted" {
+		t.Errorf("expected muted notice, got %q", r)
+	}
+	if len(messages) != 1 || messages[0] != "hi" {
+		t.Errorf("muted message should be dropped, got %v", messages)
+	}
+
+	s.StopServer()
+}
@@ -0,0 +1,48 @@
+package mobster
+
+import "net"
+
+// applies OnNegotiate to authenticated connection, returns codec of client with translation
+// applied before transport codec; on rejection error is sent to the client as formatted
+// by FormatError and connection is closed
+func (s *Server) negotiate(conn net.Conn, user, room, authMessage string, codec Codec) (string, Codec, bool) {
+	if s.OnNegotiate == nil {
+		return "", codec, true
+	}
+	version, translate, err := s.OnNegotiate(user, room, authMessage)
+	if err != nil {
+		s.OnError(user, "negotiate", err)
+		conn.Write(s.frame([]byte(s.FormatError(err))))
+		s.sendClose(conn, nil, CloseAuthFailed)
+		conn.Close()
+		return "", nil, false
+	}
+	if translate == nil {
+		return version, codec, true
+	}
+	if codec == nil {
+		return version, translate, true
+	}
+	return version, chainCodec{inner: translate, outer: codec}, true
+}
+
+// applies inner codec closer to application and outer closer to the wire
+type chainCodec struct {
+	inner, outer Codec
+}
+
+func (c chainCodec) Encode(message []byte) ([]byte, error) {
+	translated, err := c.inner.Encode(message)
+	if err != nil {
+		return nil, err
+	}
+	return c.outer.Encode(translated)
+}
+
+func (c chainCodec) Decode(message []byte) ([]byte, error) {
+	decoded, err := c.outer.Decode(message)
+	if err != nil {
+		return nil, err
+	}
+	return c.inner.Decode(decoded)
+}
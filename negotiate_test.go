@@ -0,0 +1,65 @@
+package mobster
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// translates messages of protocol v1, which used "say" instead of "chat"
+type v1Translation struct{}
+
+func (v1Translation) Encode(message []byte) ([]byte, error) {
+	return bytes.Replace(message, []byte("chat "), []byte("say "), 1), nil
+}
+
+func (v1Translation) Decode(message []byte) ([]byte, error) {
+	return bytes.Replace(message, []byte("say "), []byte("chat "), 1), nil
+}
+
+func TestOnNegotiate(t *testing.T) {
+	var versions []string
+	s := NewServer()
+	s.OnAuth = func(message string) (string, string, error) {
+		tokens := strings.Split(message, " ")
+		return tokens[1], tokens[2], nil
+	}
+	s.OnNegotiate = func(user, room, authMessage string) (string, Codec, error) {
+		switch version := strings.Split(authMessage, " ")[3]; version {
+		case "v2":
+			return version, nil, nil
+		case "v1":
+			return version, v1Translation{}, nil
+		default:
+			return "", nil, Errorf("unsupported_version", "use v1 or v2")
+		}
+	}
+	s.OnConnect = func(ops *Ops, name, room string) {
+		info, _ := ops.GetClientInfo(name)
+		versions = append(versions, info.ProtocolVersion)
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+
+	rejected := connectAndSend(t, "a baz 123 v3")
+	if msg := readFromServer(t, rejected); msg != "err unsupported_version use v1 or v2" {
+		t.Errorf("expected rejection, got %q", msg)
+	}
+
+	old := connectAndSend(t, "a foo 123 v1")
+	current := connectAndSend(t, "a bar 123 v2")
+	send(t, old, "say hi")
+	if msg := readFromServer(t, current); msg != "chat hi" {
+		t.Errorf("old message not translated, got %q", msg)
+	}
+	if msg := readFromServer(t, old); msg != "say hi" {
+		t.Errorf("message to old client not translated, got %q", msg)
+	}
+	s.StopServer()
+
+	if len(versions) != 2 || versions[0] != "v1" || versions[1] != "v2" {
+		t.Errorf("unexpected versions %v", versions)
+	}
+}
@@ -0,0 +1,102 @@
+package mobster
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// limit of single token of default auth packet
+const MaxAuthTokenSize = 256
+
+// limit of auth packet quoted in errors
+const maxQuotedPacket = 64
+
+var ErrMalformedAuth = errors.New("malformed auth request")
+
+// default auth packet "a <username> <room> [<secret>]", or with "s" instead of "a" for spectators
+type AuthPacket struct {
+	Spectator bool
+	Username  string
+	Room      string
+	Secret    string
+}
+
+// parses default auth packet, safe for untrusted input; tokens must be non empty valid utf-8
+// of at most MaxAuthTokenSize bytes without control characters
+func ParseAuth(packet string) (AuthPacket, error) {
+	var tokens [4]string
+	n := 0
+	for rest := packet; ; n++ {
+		if n == len(tokens) {
+			return AuthPacket{}, malformedAuth(packet)
+		}
+		token, tail, more := strings.Cut(rest, " ")
+		if !validAuthToken(token) {
+			return AuthPacket{}, malformedAuth(packet)
+		}
+		tokens[n] = token
+		if !more {
+			n++
+			break
+		}
+		rest = tail
+	}
+	if n < 3 || (tokens[0] != "a" && tokens[0] != "s") {
+		return AuthPacket{}, malformedAuth(packet)
+	}
+	return AuthPacket{Spectator: tokens[0] == "s", Username: tokens[1], Room: tokens[2], Secret: tokens[3]}, nil
+}
+
+func validAuthToken(token string) bool {
+	if token == "" || len(token) > MaxAuthTokenSize || !utf8.ValidString(token) {
+		return false
+	}
+	for i := 0; i < len(token); i++ {
+		if token[i] < 0x20 || token[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// tells if name coming from outside of auth packet, e.g. token claim, could be its token
+func validAuthName(name string) bool {
+	return validAuthToken(name) && !strings.Contains(name, " ")
+}
+
+// quotes at most maxQuotedPacket bytes of packet, so that garbage does not flood logs
+func malformedAuth(packet string) error {
+	if len(packet) > maxQuotedPacket {
+		return fmt.Errorf("%w %q... (%d bytes)", ErrMalformedAuth, packet[:maxQuotedPacket], len(packet))
+	}
+	return fmt.Errorf("%w %q", ErrMalformedAuth, packet)
+}
+
+// splits text packet into messages, blank lines are skipped and trailing
+// carriage returns removed
+func splitText(packet string) []string {
+	messages := make([]string, 0, strings.Count(packet, "\n")/2+1)
+	for line := range strings.SplitSeq(packet, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		messages = append(messages, line)
+	}
+	return messages
+}
+
+// decodes header of length prefixed frame
+func parseFrameHeader(header []byte, maxSize int) (int, error) {
+	if len(header) < frameHeaderSize {
+		return 0, fmt.Errorf("%w: header too short: %d bytes", errBadFrame, len(header))
+	}
+	size := binary.BigEndian.Uint32(header)
+	if maxSize < 0 || uint64(size) > uint64(maxSize) {
+		return 0, fmt.Errorf("%w: too big: %d bytes", errBadFrame, size)
+	}
+	return int(size), nil
+}
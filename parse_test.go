@@ -0,0 +1,112 @@
+package mobster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseAuth(t *testing.T) {
+	auth, err := ParseAuth("s foo room secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != (AuthPacket{Spectator: true, Username: "foo", Room: "room", Secret: "secret"}) {
+		t.Errorf("unexpected auth %+v", auth)
+	}
+	for _, packet := range []string{
+		"",
+		"a foo",
+		"x foo room",
+		"a foo room secret extra",
+		"a  room",
+		"a foo\x00 room",
+		"a foo\room",
+		"a \xff room",
+		"a " + strings.Repeat("x", MaxAuthTokenSize+1) + " room",
+	} {
+		if _, err := ParseAuth(packet); !errors.Is(err, ErrMalformedAuth) {
+			t.Errorf("packet %q should be malformed, got %v", packet, err)
+		}
+	}
+}
+
+func TestParseAuth_errorTruncated(t *testing.T) {
+	_, err := ParseAuth(strings.Repeat("x", 100000))
+	if len(err.Error()) > 2*maxQuotedPacket {
+		t.Errorf("error should not quote whole packet, got %d bytes", len(err.Error()))
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	messages := splitText("foo\r\n\n\n  \nbar\n")
+	if len(messages) != 2 || messages[0] != "foo" || messages[1] != "bar" {
+		t.Errorf("unexpected messages %q", messages)
+	}
+	if messages := splitText(strings.Repeat("\n", 100000)); len(messages) != 0 {
+		t.Errorf("blank lines should be skipped, got %d", len(messages))
+	}
+}
+
+func TestParseFrameHeader(t *testing.T) {
+	if _, err := parseFrameHeader([]byte{0, 0}, 10); err == nil {
+		t.Error("short header should fail")
+	}
+	if _, err := parseFrameHeader([]byte{0xff, 0xff, 0xff, 0xff}, DefaultMaxFrameSize); err == nil {
+		t.Error("huge frame should fail")
+	}
+	if size, err := parseFrameHeader([]byte{0, 0, 0, 10}, 10); err != nil || size != 10 {
+		t.Errorf("unexpected size %d, err %v", size, err)
+	}
+}
+
+func FuzzAuth(f *testing.F) {
+	for _, seed := range []string{"a foo room", "s foo room secret", "a foo\x00 room", "a  ", strings.Repeat(" ", 1000)} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, packet string) {
+		auth, err := ParseAuth(packet)
+		if err != nil {
+			return
+		}
+		for _, token := range []string{auth.Username, auth.Room} {
+			if !validAuthToken(token) {
+				t.Errorf("invalid token %q accepted", token)
+			}
+		}
+		if auth.Secret != "" && !validAuthToken(auth.Secret) {
+			t.Errorf("invalid secret %q accepted", auth.Secret)
+		}
+	})
+}
+
+func FuzzFrame(f *testing.F) {
+	f.Add([]byte("\x00\x00\x00\x03foo\x00\x00\x00\x00"))
+	f.Add([]byte("\xff\xff\xff\xff"))
+	f.Add([]byte("foo\nbar\r\n\n\x00\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		const maxSize = 64
+		r := bytes.NewReader(data)
+		for {
+			frame, err := readFrame(r, maxSize)
+			if err != nil {
+				break
+			}
+			if len(frame) > maxSize {
+				t.Fatalf("frame of %d bytes exceeds limit", len(frame))
+			}
+			var header [frameHeaderSize]byte
+			binary.BigEndian.PutUint32(header[:], uint32(len(frame)))
+			if size, err := parseFrameHeader(header[:], maxSize); err != nil || size != len(frame) {
+				t.Fatalf("header does not round trip: %d, %v", size, err)
+			}
+		}
+		for _, message := range splitText(string(data)) {
+			if strings.Contains(message, "\n") || strings.TrimSpace(message) == "" {
+				t.Fatalf("unexpected message %q", message)
+			}
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package mobster
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// default pong is "pong <unix milliseconds>", followed by payload of ping if there was any
+func formatPong(payload string, now time.Time) string {
+	pong := "pong " + strconv.FormatInt(now.UnixMilli(), 10)
+	if payload != "" {
+		pong += " " + payload
+	}
+	return pong
+}
+
+// tells if message is PingCommand, optionally followed by payload
+func (s *Server) isPing(message string) bool {
+	if s.PingCommand == "" {
+		return false
+	}
+	return message == s.PingCommand || strings.HasPrefix(message, s.PingCommand+" ")
+}
+
+func (s *Server) pong(ping string) string {
+	payload := strings.TrimLeft(strings.TrimPrefix(ping, s.PingCommand), " ")
+	return s.FormatPong(payload, time.Now())
+}
+
+// answers ping of client without codec right in its connection goroutine,
+// failures surface on next read
+func (s *Server) writePong(c *Client, conn net.Conn, ping string) {
+	if s.WriteTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+	n, _ := conn.Write(s.frame([]byte(s.pong(ping))))
+	s.countWrite(c, 1, n)
+}
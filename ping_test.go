@@ -0,0 +1,72 @@
+package mobster
+
+import (
+	"compress/flate"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatPong(t *testing.T) {
+	now := time.UnixMilli(1234)
+	if pong := formatPong("", now); pong != "pong 1234" {
+		t.Errorf("unexpected pong %q", pong)
+	}
+	if pong := formatPong("abc", now); pong != "pong 1234 abc" {
+		t.Errorf("unexpected pong %q", pong)
+	}
+}
+
+func TestFlow_ping(t *testing.T) {
+	var messages []string
+	s := NewServer()
+	s.PingCommand = "ping"
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		messages = append(messages, message)
+	}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo room", "ping abc")
+
+	pong := readFromServer(t, c)
+	if !strings.HasPrefix(pong, "pong ") || !strings.HasSuffix(pong, " abc") {
+		t.Errorf("unexpected pong %q", pong)
+	}
+	send(t, c, "pinguin")
+	sleep()
+	s.StopServer()
+
+	if len(messages) != 1 || messages[0] != "pinguin" {
+		t.Errorf("only non ping messages should reach handler, got %q", messages)
+	}
+}
+
+func TestFlow_pingWithCodec(t *testing.T) {
+	codec, _ := NewFlateCodec(flate.DefaultCompression)
+	s := NewServer()
+	s.Framing = FramingLengthPrefixed
+	s.PingCommand = "ping"
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnAuth = func(message string) (string, string, error) {
+		return "foo", "123", nil
+	}
+	s.OnSelectCodec = func(user, room, authMessage string) Codec {
+		return codec
+	}
+	s.StartServer(4009)
+
+	c := connect(t)
+	sendFrame(t, c, []byte("auth"))
+	encoded, _ := codec.Encode([]byte("ping"))
+	sendFrame(t, c, encoded)
+
+	response := []byte(readFromServer(t, c))
+	if len(response) < frameHeaderSize {
+		t.Fatal("no response")
+	}
+	decoded, err := codec.Decode(response[frameHeaderSize:])
+	if err != nil || !strings.HasPrefix(string(decoded), "pong ") {
+		t.Errorf("expected encoded pong, got %q, %v", decoded, err)
+	}
+	s.StopServer()
+}
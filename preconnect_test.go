@@ -0,0 +1,41 @@
+package mobster
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFlow_preConnect(t *testing.T) {
+	var connected []string
+	s := NewServer()
+	blocked := make(chan string, 2)
+	s.OnPreConnect = func(remote net.Addr) error {
+		if len(blocked) == 0 {
+			blocked <- remote.String()
+			return errors.New("blocked")
+		}
+		return nil
+	}
+	s.OnConnect = func(ops *Ops, user, room string) {
+		connected = append(connected, user)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	var buf [16]byte
+	if _, err := c.Read(buf[:]); err == nil {
+		t.Error("rejected connection should be closed")
+	}
+	connectAndSend(t, "a bar 123")
+	s.StopServer()
+
+	if len(connected) != 1 || connected[0] != "bar" {
+		t.Errorf("unexpected clients %v", connected)
+	}
+	if addr := <-blocked; addr != c.LocalAddr().String() {
+		t.Errorf("hook should see remote address, got %s", addr)
+	}
+}
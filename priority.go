@@ -0,0 +1,73 @@
+package mobster
+
+// priority of messages sent with async Server methods
+type Priority int
+
+const (
+	// queued in order with other async requests
+	PriorityNormal Priority = iota
+	// delivered before async requests queued so far, e.g. kick notices or turn deadlines,
+	// and before writes waiting for ClientBandwidth; caller blocks when urgent queue is full,
+	// dropped only when server is stopping
+	PriorityHigh
+)
+
+// message queued ahead of other async requests
+type urgentMessage struct {
+	name, message string // name of either user or room
+	room          bool
+}
+
+// like SendTo, PriorityHigh message skips queued async requests
+func (s *Server) SendToWithPriority(user, message string, priority Priority) {
+	if priority < PriorityHigh {
+		s.SendTo(user, message)
+		return
+	}
+	s.queueUrgent(urgentMessage{name: user, message: message})
+}
+
+// like SendToRoom, PriorityHigh message skips queued async requests
+func (s *Server) SendToRoomWithPriority(room, message string, priority Priority) {
+	if priority < PriorityHigh {
+		s.SendToRoom(room, message)
+		return
+	}
+	s.queueUrgent(urgentMessage{name: room, message: message, room: true})
+}
+
+// waits for room in urgent queue unless server is stopping, it is not read then
+func (s *Server) queueUrgent(m urgentMessage) {
+	select {
+	case s.urgent <- m:
+	case <-s.stopping:
+	case <-s.loopDone:
+	}
+}
+
+// delivers urgent messages waiting in queue, at most as many as queue holds so that
+// other requests are not starved, must be called from processingLoop only
+func (s *Server) flushUrgent() {
+	for n := cap(s.urgent); n > 0; n-- {
+		select {
+		case m := <-s.urgent:
+			s.deliverUrgent(m)
+		default:
+			return
+		}
+	}
+}
+
+// writes skip shaping queue, must be called from processingLoop only
+func (s *Server) deliverUrgent(m urgentMessage) {
+	s.writingUrgent = true
+	defer func() { s.writingUrgent = false }()
+	if m.room {
+		// messages batched in room go along, so that order is kept
+		s.flushRoom(m.name, m.message)
+		return
+	}
+	if s.writeToUser(m.name, m.message) == ErrNotConnected {
+		s.sendToOffline(m.name, m.message)
+	}
+}
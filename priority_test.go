@@ -0,0 +1,71 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendToWithPriority(t *testing.T) {
+	s := NewServer()
+	foo := &fakeConn{}
+	bar := &fakeConn{}
+	s.clientHolder.Add(NewClient("foo", "room", foo))
+	s.clientHolder.Add(NewClient("bar", "room", bar))
+
+	s.SendTo("foo", "chat")
+	s.SendToRoomWithPriority("room", "turn ends", PriorityNormal)
+	s.SendToWithPriority("foo", "kick notice", PriorityHigh)
+	s.SendToRoomWithPriority("room", "deadline", PriorityHigh)
+	s.flushUrgent()
+
+	if len(foo.written) != 2 || foo.written[0] != "kick notice" || foo.written[1] != "deadline" {
+		t.Errorf("urgent messages should be delivered first, got %q", foo.written)
+	}
+	if len(bar.written) != 1 || bar.written[0] != "deadline" {
+		t.Errorf("unexpected room messages %q", bar.written)
+	}
+	if len(s.responses) != 1 || len(s.responsesToRoom) != 1 {
+		t.Error("normal messages should stay queued")
+	}
+}
+
+func TestSendToWithPriority_skipsShaping(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.ClientBandwidth = 10
+	conn := &fakeConn{}
+	c := NewClient("foo", "room", conn)
+	s.clientHolder.Add(c)
+
+	s.write(c, "bulk bigger than burst")
+	s.write(c, "bulk waiting for bandwidth")
+	s.SendToWithPriority("foo", "kick notice", PriorityHigh)
+	s.flushUrgent()
+	c.shaper.timer.Stop()
+
+	if len(conn.written) != 2 || conn.written[1] != "kick notice" {
+		t.Errorf("urgent message should skip throttled writes, got %q", conn.written)
+	}
+	if len(c.shaper.queue) != 1 {
+		t.Errorf("bulk write should stay queued, got %d", len(c.shaper.queue))
+	}
+}
+
+func TestSendToWithPriority_stopped(t *testing.T) {
+	s := NewServer()
+	s.StartServer(4009)
+	s.StopServer()
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i <= cap(s.urgent); i++ {
+			s.SendToWithPriority("foo", "late", PriorityHigh)
+		}
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("urgent message should not block after stop")
+	}
+}
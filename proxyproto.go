@@ -0,0 +1,140 @@
+package mobster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PROXY protocol support, see https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// max length of v1 header including crlf
+const proxyV1MaxLength = 107
+
+// connection with remote address taken from PROXY protocol header
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// reads PROXY protocol header, returned connection reports real client address;
+// for LOCAL and UNKNOWN headers address of the proxy itself is kept
+func readProxyHeader(conn net.Conn) (net.Conn, error) {
+	reader := bufio.NewReaderSize(conn, 256)
+	sig, err := reader.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	var remote net.Addr
+	switch {
+	case bytes.Equal(sig, proxyV2Signature):
+		remote, err = readProxyV2(reader)
+	case bytes.HasPrefix(sig, []byte("PROXY ")):
+		remote, err = readProxyV1(reader)
+	default:
+		err = errors.New("no proxy protocol header")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if remote == nil {
+		remote = conn.RemoteAddr()
+	}
+	return &proxyConn{conn, reader, remote}, nil
+}
+
+func readProxyV1(reader *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return nil, errors.New("proxy v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("proxy v1 header not terminated with crlf")
+	}
+
+	// PROXY TCP4 <src> <dst> <srcport> <dstport>
+	tokens := strings.Split(string(line[:len(line)-2]), " ")
+	if len(tokens) >= 2 && tokens[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(tokens) != 6 || (tokens[1] != "TCP4" && tokens[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed proxy v1 header <%s>", line[:len(line)-2])
+	}
+	ip := net.ParseIP(tokens[2])
+	port, err := strconv.ParseUint(tokens[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed proxy v1 source address <%s %s>", tokens[2], tokens[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2(reader *bufio.Reader) (net.Addr, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported proxy protocol version %d", header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	family := header[13]
+	length := binary.BigEndian.Uint16(header[14:])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	// LOCAL command, e.g. health checks of the proxy
+	if command == 0 {
+		return nil, nil
+	}
+	if command != 1 {
+		return nil, fmt.Errorf("unsupported proxy v2 command %d", command)
+	}
+
+	switch family {
+	case 0x11, 0x12: // tcp or udp over ipv4
+		if len(payload) < 12 {
+			return nil, errors.New("proxy v2 ipv4 address too short")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21, 0x22: // tcp or udp over ipv6
+		if len(payload) < 36 {
+			return nil, errors.New("proxy v2 ipv6 address too short")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		// unix sockets or unspecified, keep proxy address
+		return nil, nil
+	}
+}
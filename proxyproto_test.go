@@ -0,0 +1,77 @@
+package mobster
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := append([]byte{}, proxyV2Signature...)
+	v2 = append(v2, 0x21, 0x11, 0, 12)
+	v2 = append(v2, 10, 0, 0, 1, 10, 0, 0, 2)
+	v2 = binary.BigEndian.AppendUint16(v2, 4321)
+	v2 = binary.BigEndian.AppendUint16(v2, 4009)
+
+	v2local := append([]byte{}, proxyV2Signature...)
+	v2local = append(v2local, 0x20, 0x00, 0, 0)
+
+	tests := []struct {
+		header string
+		addr   string // empty when proxy address should be kept
+		fails  bool
+	}{
+		{"PROXY TCP4 1.2.3.4 5.6.7.8 1111 4009\r\n", "1.2.3.4:1111", false},
+		{"PROXY TCP6 ::1 ::2 1111 4009\r\n", "[::1]:1111", false},
+		{"PROXY UNKNOWN\r\n", "", false},
+		{string(v2), "10.0.0.1:4321", false},
+		{string(v2local), "", false},
+		{"PROXY TCP4 1.2.3.4 5.6.7.8 1111\r\n", "", true},
+		{"PROXY TCP4 1.2.3.4 5.6.7.8 1111 4009\n", "", true},
+		{"a foo 123 and some more data", "", true},
+	}
+
+	for _, test := range tests {
+		local := &readerConn{r: strings.NewReader(test.header + "a foo 123")}
+
+		conn, err := readProxyHeader(local)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%q: expected error", test.header)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.header, err)
+			continue
+		}
+
+		addr := conn.RemoteAddr().String()
+		if test.addr == "" && addr != local.RemoteAddr().String() {
+			t.Errorf("%q: proxy address should be kept, got %s", test.header, addr)
+		}
+		if test.addr != "" && addr != test.addr {
+			t.Errorf("%q: expected %s, got %s", test.header, test.addr, addr)
+		}
+		rest, _ := io.ReadAll(conn)
+		if string(rest) != "a foo 123" {
+			t.Errorf("%q: data after header lost, got %q", test.header, rest)
+		}
+	}
+}
+
+// connection reading from given reader, only Read and RemoteAddr are usable
+type readerConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *readerConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *readerConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+}
@@ -0,0 +1,76 @@
+package mobster
+
+import (
+	"errors"
+	"fmt"
+)
+
+// default capacity of queues behind async Server methods like SendTo and Disconnect
+const DefaultAsyncQueueSize = 1024
+
+// ErrQueueFull is passed to SendToWithCallback result when message is dropped due to OverflowDrop
+var ErrQueueFull = errors.New("async queue full")
+
+// tells what happens to requests for processing loop when their queue is full
+type OverflowPolicy int
+
+const (
+	// caller blocks until processing loop catches up; never call async Server methods
+	// from handlers with this policy, use Ops instead
+	OverflowBlock OverflowPolicy = iota
+	// request is dropped and reported to OnError with "overflow" op
+	OverflowDrop
+)
+
+func (s *Server) asyncQueueSize() int {
+	if s.AsyncQueueSize > 0 {
+		return s.AsyncQueueSize
+	}
+	return DefaultAsyncQueueSize
+}
+
+// applies AsyncQueueSize to queues which are still empty, called before processing loop starts
+func (s *Server) resizeQueues() {
+	size := s.asyncQueueSize()
+	if cap(s.responses) != size && len(s.responses) == 0 {
+		s.responses = make(chan Response, size)
+	}
+	if cap(s.responsesToRoom) != size && len(s.responsesToRoom) == 0 {
+		s.responsesToRoom = make(chan Response, size)
+	}
+	if cap(s.urgent) != size && len(s.urgent) == 0 {
+		s.urgent = make(chan urgentMessage, size)
+	}
+	if cap(s.disconnects) != size && len(s.disconnects) == 0 {
+		s.disconnects = make(chan string, size)
+	}
+	if cap(s.disconnectsForRoom) != size && len(s.disconnectsForRoom) == 0 {
+		s.disconnectsForRoom = make(chan string, size)
+	}
+	if n := s.MaxPendingHandshakes; n > 0 && cap(s.handshakeSlots) != n {
+		s.handshakeSlots = make(chan struct{}, n)
+	}
+	// incoming clients stay unbuffered, so that client is known to processing loop
+	// before its first message arrives
+	if size := s.IncomingQueueSize; size >= 0 && cap(s.incomingRequests) != size && len(s.incomingRequests) == 0 {
+		s.incomingRequests = make(chan Request, size)
+	}
+}
+
+// puts v on queue according to policy, returns false if it was dropped
+func enqueue[T any](s *Server, policy OverflowPolicy, queue chan T, v T, user, what string) bool {
+	select {
+	case queue <- v:
+		return true
+	default:
+	}
+	if policy == OverflowDrop {
+		s.dropped.Add(1)
+		if s.OnError != nil {
+			s.OnError(user, "overflow", fmt.Errorf("%s dropped: %w", what, ErrQueueFull))
+		}
+		return false
+	}
+	queue <- v
+	return true
+}
@@ -0,0 +1,123 @@
+package mobster
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAsyncQueue_noGoroutinePerCall(t *testing.T) {
+	s := NewServer()
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		s.SendTo("user", "msg")
+		s.Disconnect("user")
+	}
+	if after := runtime.NumGoroutine(); after != before {
+		t.Error("goroutines spawned:", after-before)
+	}
+	if len(s.responses) != 100 || len(s.disconnects) != 100 {
+		t.Error("requests not queued:", len(s.responses), len(s.disconnects))
+	}
+}
+
+func TestAsyncQueue_resize(t *testing.T) {
+	s := NewServer()
+	s.AsyncQueueSize = 3
+	s.resizeQueues()
+	if cap(s.responses) != 3 || cap(s.responsesToRoom) != 3 || cap(s.disconnects) != 3 || cap(s.disconnectsForRoom) != 3 {
+		t.Error("queues not resized")
+	}
+}
+
+func TestAsyncQueue_drop(t *testing.T) {
+	s := NewServer()
+	s.AsyncQueueSize = 1
+	s.AsyncOverflow = OverflowDrop
+	s.resizeQueues()
+
+	var ops []string
+	s.OnError = func(user, op string, err error) {
+		if !errors.Is(err, ErrQueueFull) {
+			t.Error("unexpected error:", err)
+		}
+		ops = append(ops, user+" "+op)
+	}
+
+	s.SendTo("user", "first")
+	s.SendTo("user", "second")
+	s.SendToRoom("room", "first")
+	s.SendToRoom("room", "second")
+
+	var result error
+	s.SendToWithCallback("user", "third", func(err error) { result = err })
+	if result != ErrQueueFull {
+		t.Error("callback not told about drop:", result)
+	}
+	if len(ops) != 3 || ops[0] != "user overflow" || ops[1] != " overflow" {
+		t.Error("unexpected overflow reports:", ops)
+	}
+	if r := <-s.responses; r.message != "first" {
+		t.Error("wrong message kept:", r.message)
+	}
+}
+
+func TestSendToSync(t *testing.T) {
+	s := NewServer()
+	s.SyncTimeout = 20 * time.Millisecond
+	// nothing processes the queue yet
+	if err := s.SendToSync("foo", "msg"); err != ErrSyncTimeout {
+		t.Error("expected timeout, got", err)
+	}
+	<-s.responses
+
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo 123")
+	if err := s.SendToSync("foo", "hello"); err != nil {
+		t.Error(err)
+	}
+	if msg := readFromServer(t, c); msg != "hello" {
+		t.Errorf("expected message, got %q", msg)
+	}
+	if err := s.SendToSync("bar", "hello"); err != ErrNotConnected {
+		t.Error("expected ErrNotConnected, got", err)
+	}
+	s.StopServer()
+}
+
+func TestIncomingOverflow_drop(t *testing.T) {
+	release := make(chan bool)
+	var messages []string
+	var ops []string
+	s := NewServer()
+	s.IncomingQueueSize = 1
+	s.IncomingOverflow = OverflowDrop
+	s.OnError = func(user, op string, err error) {
+		ops = append(ops, op)
+	}
+	s.OnMessage = func(_ *Ops, user, room, message string) {
+		if message == "first" {
+			<-release
+		}
+		messages = append(messages, message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123", "first", "second", "third", "fourth")
+	sleep()
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	if dropped := s.Stats().Dropped; dropped != 2 {
+		t.Errorf("expected 2 dropped messages, got %d", dropped)
+	}
+	c.Close()
+	s.StopServer()
+
+	if len(messages) != 2 || messages[1] != "second" {
+		t.Errorf("unexpected messages %v", messages)
+	}
+	if len(ops) == 0 || ops[0] != "overflow" {
+		t.Errorf("expected overflow errors, got %v", ops)
+	}
+}
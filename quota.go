@@ -0,0 +1,122 @@
+package mobster
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// limits of single user, zero means unlimited, periods are calendar hours and days in UTC
+type Quota struct {
+	MessagesPerHour int64
+	MessagesPerDay  int64
+	BytesPerDay     int64
+}
+
+// persists quota usage, shared by instances so that limits hold across reconnects,
+// called from processing loop so implementations should be fast
+type QuotaStore interface {
+	// adds delta to counter of user and returns its new value, counter may be
+	// forgotten after it expires
+	Incr(user, counter string, delta int64, expires time.Time) (int64, error)
+}
+
+// keeps quota counters in memory, so that they survive reconnects but not restarts
+type MemoryQuotaStore struct {
+	mu       sync.Mutex
+	counters map[string]quotaCounter
+}
+
+type quotaCounter struct {
+	value   int64
+	expires time.Time
+}
+
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{counters: make(map[string]quotaCounter)}
+}
+
+func (m *MemoryQuotaStore) Incr(user, counter string, delta int64, expires time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	key := user + " " + counter
+	c, ok := m.counters[key]
+	if !ok {
+		// new counter is a good moment to forget expired ones
+		for k, old := range m.counters {
+			if now.After(old.expires) {
+				delete(m.counters, k)
+			}
+		}
+	}
+	if now.After(c.expires) {
+		c = quotaCounter{}
+	}
+	c.value += delta
+	c.expires = expires
+	m.counters[key] = c
+	return c.value, nil
+}
+
+// counts message against quota of its sender, returns name of exceeded limit;
+// messages over the limit are counted as well, store failures let messages through,
+// must be called from processingLoop only
+func (s *Server) exceedsQuota(user, message string, now time.Time) (string, bool) {
+	if s.QuotaFor == nil {
+		return "", false
+	}
+	q := s.QuotaFor(user)
+	if q == nil {
+		return "", false
+	}
+	now = now.UTC()
+	hour := now.Truncate(time.Hour)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	limits := []struct {
+		name    string
+		limit   int64
+		counter string
+		delta   int64
+		expires time.Time
+	}{
+		{"messages per hour", q.MessagesPerHour, "messages:" + hour.Format("2006010215"), 1, hour.Add(time.Hour)},
+		{"messages per day", q.MessagesPerDay, "messages:" + day.Format("20060102"), 1, day.AddDate(0, 0, 1)},
+		{"bytes per day", q.BytesPerDay, "bytes:" + day.Format("20060102"), int64(len(message)), day.AddDate(0, 0, 1)},
+	}
+	exceeded := ""
+	for _, l := range limits {
+		if l.limit <= 0 {
+			continue
+		}
+		value, err := s.QuotaStore.Incr(user, l.counter, l.delta, l.expires)
+		if err != nil {
+			s.OnError(user, "quota", err)
+			continue
+		}
+		if value > l.limit && exceeded == "" {
+			exceeded = l.name
+		}
+	}
+	return exceeded, exceeded != ""
+}
+
+// drops message of user over its quota, tells if it was dropped,
+// must be called from processingLoop only
+func (s *Server) checkQuota(ops *Ops, c *Client, message string) bool {
+	if c.bot != nil {
+		return false
+	}
+	limit, exceeded := s.exceedsQuota(c.user, message, time.Now())
+	if !exceeded {
+		return false
+	}
+	s.auditf(c.room, c.user, "quota", "%s: %s over quota of %s, message dropped", c.room, c.user, limit)
+	if s.QuotaExceededMessage != "" {
+		s.write(c, s.QuotaExceededMessage)
+	}
+	if s.OnQuotaExceeded != nil {
+		s.OnQuotaExceeded(ops, c.user, c.room, fmt.Sprintf("%s exceeded", limit))
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package mobster
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExceedsQuota(t *testing.T) {
+	s := NewServer()
+	s.QuotaFor = func(user string) *Quota {
+		if user == "paid" {
+			return nil
+		}
+		return &Quota{MessagesPerHour: 2, BytesPerDay: 10}
+	}
+	now := time.Date(2026, 10, 14, 10, 59, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if limit, exceeded := s.exceedsQuota("free", "ab", now); exceeded {
+			t.Fatalf("message %d should fit, %s exceeded", i, limit)
+		}
+	}
+	if limit, _ := s.exceedsQuota("free", "ab", now); limit != "messages per hour" {
+		t.Errorf("expected hourly limit, got %q", limit)
+	}
+	if _, exceeded := s.exceedsQuota("free", "ab", now.Add(time.Minute)); exceeded {
+		t.Error("hourly limit should reset with next hour")
+	}
+	if limit, _ := s.exceedsQuota("free", "abcdef", now.Add(time.Minute)); limit != "bytes per day" {
+		t.Errorf("expected daily bytes limit, got %q", limit)
+	}
+	for i := 0; i < 5; i++ {
+		if _, exceeded := s.exceedsQuota("paid", "ab", now); exceeded {
+			t.Fatal("user without quota should not be limited")
+		}
+	}
+}
+
+type failingQuotaStore struct{}
+
+func (failingQuotaStore) Incr(user, counter string, delta int64, expires time.Time) (int64, error) {
+	return 0, errors.New("store down")
+}
+
+func TestExceedsQuota_storeFailure(t *testing.T) {
+	var ops []string
+	s := NewServer()
+	s.QuotaStore = failingQuotaStore{}
+	s.QuotaFor = func(user string) *Quota { return &Quota{MessagesPerDay: 1} }
+	s.OnError = func(user, op string, err error) {
+		ops = append(ops, op)
+	}
+
+	if _, exceeded := s.exceedsQuota("foo", "bar", time.Now()); exceeded {
+		t.Error("store failure should let message through")
+	}
+	if len(ops) != 1 || ops[0] != "quota" {
+		t.Errorf("expected quota error, got %v", ops)
+	}
+}
+
+func TestFlow_quota(t *testing.T) {
+	var messages, reasons []string
+	s := NewServer()
+	s.QuotaFor = func(user string) *Quota { return &Quota{MessagesPerDay: 1} }
+	s.QuotaExceededMessage = "quota exceeded"
+	s.OnQuotaExceeded = func(ops *Ops, user, room, reason string) {
+		reasons = append(reasons, reason)
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		messages = append(messages, message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123", "first")
+	c.Close()
+	sleep()
+	// usage survives reconnect
+	c = connectAndSend(t, "a foo 123", "second")
+	if msg := readFromServer(t, c); msg != "quota exceeded" {
+		t.Errorf("expected notice, got %q", msg)
+	}
+	s.StopServer()
+
+	if len(messages) != 1 || messages[0] != "first" {
+		t.Errorf("unexpected messages %v", messages)
+	}
+	if len(reasons) != 1 || reasons[0] != "messages per day exceeded" {
+		t.Errorf("unexpected reasons %v", reasons)
+	}
+}
@@ -0,0 +1,194 @@
+package mobster
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// kinds of recorded events
+const (
+	RecordOpen  = "open"
+	RecordData  = "data"
+	RecordClose = "close"
+)
+
+// single entry of traffic recording, written as json line
+type Record struct {
+	// unix nanoseconds
+	Time   int64  `json:"t"`
+	Conn   uint64 `json:"conn"`
+	Kind   string `json:"kind"`
+	Remote string `json:"remote,omitempty"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+// Recorder captures timestamped inbound bytes of every connection, including auth packet,
+// as returned by reads, to be fed back with Replayer; safe for concurrent use
+type Recorder struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	err    error
+	lastID atomic.Uint64
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// returns first write error, recording stops after it
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(rec Record) {
+	rec.Time = time.Now().UnixNano()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(rec)
+	}
+}
+
+// wraps connection, so that everything read from it is recorded
+func (r *Recorder) wrap(conn net.Conn) net.Conn {
+	c := &recordingConn{Conn: conn, recorder: r, id: r.lastID.Add(1)}
+	r.record(Record{Conn: c.id, Kind: RecordOpen, Remote: conn.RemoteAddr().String()})
+	return c
+}
+
+type recordingConn struct {
+	net.Conn
+	recorder *Recorder
+	id       uint64
+	closed   atomic.Bool
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.recorder.record(Record{Conn: c.id, Kind: RecordData, Data: b[:n]})
+	}
+	return n, err
+}
+
+func (c *recordingConn) Close() error {
+	if !c.closed.Swap(true) {
+		c.recorder.record(Record{Conn: c.id, Kind: RecordClose})
+	}
+	return c.Conn.Close()
+}
+
+// returns connection hidden by recorder, for checks of concrete type
+func unwrapRecorded(conn net.Conn) net.Conn {
+	if c, ok := conn.(*recordingConn); ok {
+		return c.Conn
+	}
+	return conn
+}
+
+// Replayer feeds recorded traffic back, keeping original timing of every connection
+type Replayer struct {
+	// how many times faster than recorded, 0 or less replays as fast as possible
+	Speed float64
+	// opens connection standing for recorded one, e.g. to running server
+	// or simulated client; whatever is written to it by peer is discarded
+	Dial func(remote string) (net.Conn, error)
+}
+
+// replays traffic to s through in-memory connections, seen by s with their recorded
+// remote addresses
+func ReplayTo(s *Server, speed float64) *Replayer {
+	return &Replayer{Speed: speed, Dial: func(remote string) (net.Conn, error) {
+		client, server := net.Pipe()
+		s.ServeConn(replayedConn{server, recordedAddr(remote)})
+		return client, nil
+	}}
+}
+
+// replays recording read from r, returns when all connections are closed
+func (p *Replayer) Replay(r io.Reader) error {
+	conns := make(map[uint64]net.Conn)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer func() {
+		// connections left open at the end of recording
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	var start, first int64
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*DefaultMaxFrameSize)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("malformed record: %w", err)
+		}
+		if first == 0 {
+			first, start = rec.Time, time.Now().UnixNano()
+		}
+		p.wait(start, rec.Time-first)
+
+		switch rec.Kind {
+		case RecordOpen:
+			conn, err := p.Dial(rec.Remote)
+			if err != nil {
+				return fmt.Errorf("cannot open connection %d: %w", rec.Conn, err)
+			}
+			conns[rec.Conn] = conn
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				io.Copy(io.Discard, conn)
+			}()
+		case RecordData:
+			conn, ok := conns[rec.Conn]
+			if !ok {
+				continue
+			}
+			if _, err := conn.Write(rec.Data); err != nil && !errors.Is(err, io.ErrClosedPipe) && !errors.Is(err, net.ErrClosed) {
+				return fmt.Errorf("cannot replay connection %d: %w", rec.Conn, err)
+			}
+		case RecordClose:
+			if conn, ok := conns[rec.Conn]; ok {
+				conn.Close()
+				delete(conns, rec.Conn)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// sleeps until offset of recording, scaled by speed, passes since start
+func (p *Replayer) wait(start, offset int64) {
+	if p.Speed <= 0 {
+		return
+	}
+	at := start + int64(float64(offset)/p.Speed)
+	if d := time.Duration(at - time.Now().UnixNano()); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// in-memory connection standing for recorded one
+type replayedConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c replayedConn) RemoteAddr() net.Addr { return c.remote }
+
+type recordedAddr string
+
+func (a recordedAddr) Network() string { return "replay" }
+func (a recordedAddr) String() string  { return string(a) }
@@ -0,0 +1,57 @@
+package mobster
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFlow_recordAndReplay(t *testing.T) {
+	var recording bytes.Buffer
+	s := NewServer()
+	s.Recorder = NewRecorder(&recording)
+	s.OnMessage = func(ops *Ops, user, room, message string) {}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo room", "hello")
+	sleep()
+	send(t, c, "world")
+	sleep()
+	c.Close()
+	sleep()
+	s.StopServer()
+	if err := s.Recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var got []string
+	s = NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, user+" "+room+" "+ops.GetClientAddr(user).String())
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, message)
+	}
+	s.StartServer(4009)
+	if err := ReplayTo(s, 2).Replay(&recording); err != nil {
+		t.Fatal(err)
+	}
+	sleep()
+	s.StopServer()
+
+	if len(got) != 3 || !strings.HasPrefix(got[0], "foo room 127.0.0.1:") || got[1] != "hello" || got[2] != "world" {
+		t.Errorf("unexpected replay %q", got)
+	}
+}
+
+func TestReplay_malformed(t *testing.T) {
+	p := &Replayer{Dial: nil}
+	if err := p.Replay(strings.NewReader("garbage\n")); err == nil {
+		t.Error("malformed recording should fail")
+	}
+}
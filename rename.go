@@ -0,0 +1,58 @@
+package mobster
+
+import (
+	"errors"
+)
+
+// ErrUserExists is returned by RenameUser when new name is already connected
+var ErrUserExists = errors.New("user already connected")
+
+// rename connected user, all its connections, roles, mutes, session and pending asks
+// follow the new name; bans and messages stored for the old name stay with it
+func (o *Ops) RenameUser(oldName, newName string) error {
+	s := o.server
+	clients := s.clientHolder.GetAllByName(oldName)
+	if len(clients) == 0 {
+		return ErrNotConnected
+	}
+	if oldName == newName {
+		return nil
+	}
+	if s.clientHolder.GetByName(newName) != nil {
+		return ErrUserExists
+	}
+	for _, c := range clients {
+		s.clientHolder.Remove(c)
+		c.setUser(newName)
+		s.clientHolder.Add(c)
+	}
+	for _, users := range s.roles {
+		if role, ok := users[oldName]; ok {
+			delete(users, oldName)
+			users[newName] = role
+		}
+	}
+	for _, users := range s.mutes {
+		if until, ok := users[oldName]; ok {
+			delete(users, oldName)
+			users[newName] = until
+		}
+	}
+	if session := s.sessions[oldName]; session != nil {
+		delete(s.sessions, oldName)
+		session.user = newName
+		s.sessions[newName] = session
+	}
+	for _, p := range s.asks {
+		if p.user == oldName {
+			p.user = newName
+		}
+	}
+	s.backplaneUnsubscribe("user", oldName)
+	s.backplaneSubscribe("user", newName)
+	s.auditf("", oldName, "rename", "%s renamed to %s", oldName, newName)
+	if s.OnRename != nil {
+		s.OnRename(o, oldName, newName)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package mobster
+
+import (
+	"testing"
+)
+
+func TestRenameUser(t *testing.T) {
+	var renames []string
+	s := NewServer()
+	s.OnRename = func(ops *Ops, oldName, newName string) {
+		renames = append(renames, oldName+" "+newName)
+	}
+	ops := &Ops{s}
+	guest := NewClient("guest1", "123", &fakeConn{})
+	other := NewClient("bar", "123", &fakeConn{})
+	s.clientHolder.Add(guest)
+	s.clientHolder.Add(other)
+	ops.SetRole("123", "guest1", RoleOwner)
+	ops.Session("guest1").Set("score", 7)
+
+	if err := ops.RenameUser("nobody", "foo"); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+	if err := ops.RenameUser("guest1", "bar"); err != ErrUserExists {
+		t.Errorf("expected ErrUserExists, got %v", err)
+	}
+	if err := ops.RenameUser("guest1", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ops.GetClient("foo") != guest || ops.GetClient("guest1") != nil || guest.User() != "foo" {
+		t.Error("client should be known by new name only")
+	}
+	if users := ops.GetRoomUsers("123"); len(users) != 2 || users[1] != "foo" {
+		t.Errorf("room should list new name, got %v", users)
+	}
+	if ops.GetRole("123", "foo") != RoleOwner || ops.GetRole("123", "guest1") != RoleMember {
+		t.Error("role should follow rename")
+	}
+	if ops.Session("foo").Get("score") != 7 {
+		t.Error("session should follow rename")
+	}
+	if len(renames) != 1 || renames[0] != "guest1 foo" {
+		t.Errorf("unexpected renames %v", renames)
+	}
+}
+
+func TestFlow_renameSeenByConnection(t *testing.T) {
+	raw := make(chan string, 10)
+	s := NewServer()
+	s.DisableAudit = true
+	s.OnRawPacket = func(user string, data []byte) bool {
+		raw <- user
+		return false
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		if message == "rename" {
+			ops.RenameUser(user, "foo")
+		}
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a guest1 123")
+	send(t, c, "rename")
+	sleep()
+	send(t, c, "hello")
+	sleep()
+	s.StopServer()
+
+	close(raw)
+	var users []string
+	for user := range raw {
+		users = append(users, user)
+	}
+	if len(users) != 2 || users[0] != "guest1" || users[1] != "foo" {
+		t.Errorf("connection should report current name, got %v", users)
+	}
+}
@@ -0,0 +1,80 @@
+package mobster
+
+import (
+	"time"
+)
+
+// default limit of messages buffered for disconnected user
+const DefaultResendQueueSize = 100
+
+type pendingMessages struct {
+	room     string
+	until    time.Time
+	messages []string
+}
+
+// starts buffering messages for client which connection was lost,
+// must be called from processingLoop only
+func (s *Server) keepPending(c *Client) {
+	if s.ResendWindow <= 0 {
+		return
+	}
+	now := time.Now()
+	for user, p := range s.pending {
+		if now.After(p.until) {
+			delete(s.pending, user)
+		}
+	}
+	s.pending[c.user] = &pendingMessages{room: c.room, until: now.Add(s.ResendWindow)}
+}
+
+// buffers message if user disconnected recently, false if user is not awaited,
+// must be called from processingLoop only
+func (s *Server) queuePending(user, message string) bool {
+	p := s.pending[user]
+	if p == nil {
+		return false
+	}
+	if time.Now().After(p.until) {
+		delete(s.pending, user)
+		return false
+	}
+	size := s.ResendQueueSize
+	if size <= 0 {
+		size = DefaultResendQueueSize
+	}
+	// oldest messages are dropped first
+	if len(p.messages) >= size {
+		p.messages = p.messages[1:]
+	}
+	p.messages = append(p.messages, message)
+	return true
+}
+
+// buffers message for users which recently left given room,
+// must be called from processingLoop only
+func (s *Server) queuePendingForRoom(room, message string) {
+	for user, p := range s.pending {
+		if p.room == room {
+			s.queuePending(user, message)
+		}
+	}
+}
+
+// sends buffered messages to reconnected client, must be called from processingLoop only
+func (s *Server) flushPending(c *Client) {
+	p := s.pending[c.user]
+	if p == nil {
+		return
+	}
+	delete(s.pending, c.user)
+	if time.Now().After(p.until) {
+		return
+	}
+	if len(p.messages) > 0 {
+		s.auditf(c.room, c.user, "resend", "%s: %s resending %d messages", c.room, c.user, len(p.messages))
+	}
+	for _, message := range p.messages {
+		s.write(c, message)
+	}
+}
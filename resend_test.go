@@ -0,0 +1,55 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlow_resendOnReconnect(t *testing.T) {
+	s := NewServer()
+	s.ResendWindow = time.Second
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendToRoom(room, message)
+		ops.SendTo("bar", "private")
+	}
+	s.StartServer(4009)
+
+	c1 := connectAndSend(t, "a foo 123")
+	c2 := connectAndSend(t, "a bar 123")
+	c2.Close()
+	sleep()
+
+	send(t, c1, "hello")
+	readFromServer(t, c1)
+
+	c2 = connectAndSend(t, "a bar 123")
+	r := readFromServer(t, c2)
+	if len(r) < len("helloprivate") {
+		r += readFromServer(t, c2)
+	}
+	if r != "helloprivate" {
+		t.Errorf("expected buffered messages, got %q", r)
+	}
+
+	s.StopServer()
+}
+
+func TestQueuePending_bounded(t *testing.T) {
+	s := NewServer()
+	s.ResendWindow = time.Second
+	s.ResendQueueSize = 2
+	s.keepPending(&Client{user: "foo", room: "123"})
+
+	s.queuePending("foo", "1")
+	s.queuePendingForRoom("123", "2")
+	s.queuePending("foo", "3")
+	s.queuePending("bar", "4")
+
+	p := s.pending["foo"]
+	if len(p.messages) != 2 || p.messages[0] != "2" || p.messages[1] != "3" {
+		t.Errorf("expected two latest messages, got %v", p.messages)
+	}
+	if s.pending["bar"] != nil {
+		t.Error("nothing should be buffered for unknown user")
+	}
+}
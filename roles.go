@@ -0,0 +1,71 @@
+package mobster
+
+import (
+	"errors"
+	"fmt"
+)
+
+// role of user within room, higher roles include permissions of lower ones
+type Role int
+
+const (
+	RoleMember Role = iota
+	RoleModerator
+	RoleOwner
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleMember:
+		return "member"
+	case RoleModerator:
+		return "moderator"
+	case RoleOwner:
+		return "owner"
+	default:
+		return fmt.Sprintf("role(%d)", int(r))
+	}
+}
+
+var ErrForbidden = errors.New("forbidden")
+
+// set role of user in room, roles are forgotten when user leaves the room
+func (o *Ops) SetRole(room, user string, role Role) {
+	roles := o.server.roles[room]
+	if roles == nil {
+		roles = make(map[string]Role)
+		o.server.roles[room] = roles
+	}
+	if role == RoleMember {
+		delete(roles, user)
+		return
+	}
+	roles[user] = role
+}
+
+// get role of user in room, RoleMember when none was set
+func (o *Ops) GetRole(room, user string) Role {
+	return o.server.roles[room][user]
+}
+
+// check if user has at least given role in room
+func (o *Ops) HasRole(room, user string, role Role) bool {
+	return o.GetRole(room, user) >= role
+}
+
+// returns ErrForbidden if user does not have at least given role in room,
+// meant for gating commands like kick or mute
+func (o *Ops) RequireRole(room, user string, role Role) error {
+	if !o.HasRole(room, user, role) {
+		return fmt.Errorf("%w: %s is not %s of %s", ErrForbidden, user, role, room)
+	}
+	return nil
+}
+
+// must be called from processingLoop only
+func (s *Server) forgetRole(room, user string) {
+	delete(s.roles[room], user)
+	if len(s.roles[room]) == 0 {
+		delete(s.roles, room)
+	}
+}
@@ -0,0 +1,53 @@
+package mobster
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	ops := &Ops{NewServer()}
+
+	if ops.GetRole("1", "foo") != RoleMember {
+		t.Error("member should be default role")
+	}
+	ops.SetRole("1", "foo", RoleModerator)
+	if !ops.HasRole("1", "foo", RoleMember) || !ops.HasRole("1", "foo", RoleModerator) {
+		t.Error("moderator should have moderator and member permissions")
+	}
+	if err := ops.RequireRole("1", "foo", RoleOwner); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected forbidden, got %v", err)
+	}
+	if ops.GetRole("2", "foo") != RoleMember {
+		t.Error("roles should be per room")
+	}
+	ops.SetRole("1", "foo", RoleMember)
+	if len(ops.server.roles["1"]) != 0 {
+		t.Error("member role should not be stored")
+	}
+}
+
+func TestFlow_autoOwner(t *testing.T) {
+	var kicked []string
+	s := NewServer()
+	s.AutoOwner = true
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		if ops.RequireRole(room, name, RoleOwner) == nil {
+			kicked = append(kicked, message)
+			ops.Disconnect(message)
+		}
+	}
+	s.StartServer(4009)
+
+	c1 := connectAndSend(t, "a foo 123")
+	c2 := connectAndSend(t, "a bar 123")
+	connectAndSend(t, "a baz 123")
+	send(t, c2, "baz")
+	send(t, c1, "bar")
+
+	if len(kicked) != 1 || kicked[0] != "bar" {
+		t.Errorf("only owner should be able to kick, got %v", kicked)
+	}
+
+	s.StopServer()
+}
@@ -0,0 +1,178 @@
+package mobster
+
+// operations scoped to single room, see Ops.Room
+type RoomOps struct {
+	ops  *Ops
+	name string
+}
+
+// get operations of given room, like Ops it may be used from inside handlers only
+func (o *Ops) Room(name string) *RoomOps {
+	return &RoomOps{ops: o, name: name}
+}
+
+func (r *RoomOps) Name() string {
+	return r.name
+}
+
+// send message to all users in room
+func (r *RoomOps) Send(message string) {
+	r.ops.SendToRoom(r.name, message)
+}
+
+// get names of users in room, spectators excluded
+func (r *RoomOps) Users() []string {
+	return r.ops.GetRoomUsers(r.name)
+}
+
+// get number of users in room, spectators excluded
+func (r *RoomOps) Count() int {
+	return r.ops.GetRoomCount(r.name)
+}
+
+// disconnect user if it is in room, tells if it was; its connections to other rooms stay
+func (r *RoomOps) Kick(user string) bool {
+	kicked := false
+	for _, c := range r.ops.server.clientHolder.GetAllByName(user) {
+		if c.room == r.name {
+			r.ops.server.publish(EventKick, c.user, c.room, "")
+			r.ops.server.closeClient(c, CloseKicked)
+			kicked = true
+		}
+	}
+	return kicked
+}
+
+// disconnect all users in room
+func (r *RoomOps) KickAll() {
+	r.ops.DisconnectRoom(r.name)
+}
+
+// get application data of room, it is forgotten when room empties
+func (r *RoomOps) Data() map[string]any {
+	data := r.ops.server.roomData[r.name]
+	if data == nil {
+		data = make(map[string]any)
+		r.ops.server.roomData[r.name] = data
+	}
+	return data
+}
+
+// move all connections of user to other room, members of the room are not checked
+// against its password; ErrNotConnected if user is not connected
+func (o *Ops) MoveToRoom(user, room string) error {
+	if o.server.clientHolder.GetByName(user) == nil {
+		return ErrNotConnected
+	}
+	if o.server.roomFull(room, user) {
+		return ErrRoomFull
+	}
+	o.moveConnections(user, "", room)
+	return nil
+}
+
+// moves connections of user found in room from to room, all of them when from is empty
+func (o *Ops) moveConnections(user, from, room string) {
+	s := o.server
+	for _, c := range s.clientHolder.GetAllByName(user) {
+		old := c.room
+		if old == room || from != "" && old != from {
+			continue
+		}
+		if s.AutoOwner && !c.spectator && o.GetRoomCount(room) == 0 {
+			o.SetRole(room, c.user, RoleOwner)
+		}
+		created := s.clientHolder.GetRoomCount(room) == 0
+		s.clientHolder.Move(c, room)
+		s.auditf(old, c.user, "move", "%s: %s moves to %s", old, c.user, room)
+		if !s.inRoom(c.user, old) {
+			s.forgetRole(old, c.user)
+		}
+		if s.clientHolder.GetRoomCount(old) == 0 {
+			s.roomEmptied(old)
+		}
+		if created {
+			s.roomCreated(room)
+		}
+		s.attachMailbox(c)
+		s.publish(EventMove, c.user, room, old)
+		s.sendHistory(c)
+		if s.OnLeaveRoom != nil {
+			s.OnLeaveRoom(o, c.user, old)
+		}
+		if s.OnJoinRoom != nil {
+			s.OnJoinRoom(o, c.user, room)
+		}
+	}
+}
+
+// tells if user has any connection in room, must be called from processingLoop only
+func (s *Server) inRoom(user, room string) bool {
+	for _, c := range s.clientHolder.clientsByName[user] {
+		if c.room == room {
+			return true
+		}
+	}
+	return false
+}
+
+// must be called from processingLoop only, after first client joined the room
+func (s *Server) roomCreated(room string) {
+	s.startMailbox(room)
+	s.backplaneSubscribe("room", room)
+	s.startRoomType(room)
+	s.publish(EventRoomCreated, "", room, "")
+}
+
+// forgets state of room, must be called from processingLoop only, after last client left it
+func (s *Server) roomEmptied(room string) {
+	s.stopMailbox(room)
+	s.backplaneUnsubscribe("room", room)
+	s.stopRoomType(room)
+	s.startEmptyTTL(room)
+	delete(s.roomMessages, room)
+	delete(s.minuteMessages, room)
+	delete(s.roomSequences, room)
+	delete(s.roomData, room)
+	s.publish(EventRoomEmpty, "", room, "")
+	if s.OnRoomEmptied != nil {
+		s.OnRoomEmptied(&Ops{s}, room)
+	}
+}
+
+// tear room down: members get reason as final notice, unless empty, and are disconnected
+// with CloseRoomClosed without OnDisconnect; room is removed from lobby and its
+// password, invites and mutes are forgotten
+func (o *Ops) CloseRoom(room, reason string) {
+	o.closeRoom(room, reason, "")
+}
+
+// like CloseRoom, but members are moved to target room instead of being disconnected
+func (o *Ops) CloseRoomTo(room, reason, target string) {
+	o.closeRoom(room, reason, target)
+}
+
+func (o *Ops) closeRoom(room, reason, target string) {
+	s := o.server
+	s.auditf(room, "", "close_room", "%s: closing room", room)
+	s.flushRoom(room)
+	for _, c := range s.clientHolder.GetByRoom(room) {
+		if reason != "" && s.write(c, reason) != nil {
+			continue
+		}
+		if target == "" || target == room {
+			s.closeClient(c, CloseRoomClosed)
+		}
+	}
+	if target != "" && target != room {
+		for _, user := range s.clientHolder.GetRoomUsers(room) {
+			o.moveConnections(user, room, target)
+		}
+	}
+	s.forgetRoom(room)
+}
+
+// close room, see Ops.CloseRoom
+func (r *RoomOps) Close(reason string) {
+	r.ops.CloseRoom(r.name, reason)
+}
@@ -0,0 +1,145 @@
+package mobster
+
+import (
+	"testing"
+)
+
+func TestRoomOps(t *testing.T) {
+	var users []string
+	var kickedOther, kicked bool
+	var round any
+	s := NewServer()
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		r := ops.Room(room)
+		switch message {
+		case "start":
+			r.Data()["round"] = 1
+			r.Send("started")
+		case "kick":
+			users = r.Users()
+			kickedOther = ops.Room("other").Kick("bar")
+			kicked = r.Kick("bar")
+			round = r.Data()["round"]
+		}
+	}
+	s.StartServer(4009)
+
+	foo := connectAndSend(t, "a foo 123")
+	bar := connectAndSend(t, "a bar 123")
+	send(t, foo, "start")
+	if msg := readFromServer(t, bar); msg != "started" {
+		t.Errorf("room message not received, got %q", msg)
+	}
+	send(t, foo, "kick")
+	sleep()
+
+	if len(users) != 2 || kickedOther || !kicked || round != 1 {
+		t.Errorf("unexpected room ops results: %v %v %v %v", users, kickedOther, kicked, round)
+	}
+	s.StopServer()
+}
+
+func TestRoomOps_dataForgotten(t *testing.T) {
+	s := NewServer()
+	ops := &Ops{s}
+	c := NewClient("foo", "123", &fakeConn{})
+	s.clientHolder.Add(c)
+	ops.Room("123").Data()["key"] = "value"
+
+	s.removeClient(c)
+	if len(ops.Room("123").Data()) != 0 {
+		t.Error("data of empty room should be forgotten")
+	}
+}
+
+func TestMoveToRoom(t *testing.T) {
+	var hooks []string
+	s := NewServer()
+	s.AutoOwner = true
+	s.OnLeaveRoom = func(ops *Ops, user, room string) {
+		hooks = append(hooks, "leave "+user+" "+room)
+	}
+	s.OnJoinRoom = func(ops *Ops, user, room string) {
+		hooks = append(hooks, "join "+user+" "+room)
+	}
+	ops := &Ops{s}
+	foo := NewClient("foo", "lobby", &fakeConn{})
+	s.clientHolder.Add(foo)
+	ops.Room("lobby").Data()["x"] = 1
+	events, cancel := s.Subscribe(10)
+	defer cancel()
+
+	if err := ops.MoveToRoom("bar", "game"); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+	if err := ops.MoveToRoom("foo", "game"); err != nil {
+		t.Fatal(err)
+	}
+
+	if foo.Room() != "game" || ops.GetRoomCount("lobby") != 0 || ops.GetRoomCount("game") != 1 {
+		t.Error("client should be moved")
+	}
+	if len(ops.Room("lobby").Data()) != 0 {
+		t.Error("emptied room should be forgotten")
+	}
+	if ops.GetRole("game", "foo") != RoleOwner {
+		t.Error("first user of room should own it")
+	}
+	if len(hooks) != 2 || hooks[0] != "leave foo lobby" || hooks[1] != "join foo game" {
+		t.Errorf("unexpected hooks %v", hooks)
+	}
+	var types []EventType
+	for len(events) > 0 {
+		types = append(types, (<-events).Type)
+	}
+	if len(types) != 3 || types[0] != EventRoomEmpty || types[1] != EventRoomCreated || types[2] != EventMove {
+		t.Errorf("unexpected events %v", types)
+	}
+}
+
+func TestCloseRoom(t *testing.T) {
+	var emptied []string
+	s := NewServer()
+	s.SendCloseCodes = true
+	s.OnRoomEmptied = func(ops *Ops, room string) {
+		emptied = append(emptied, room)
+	}
+	ops := &Ops{s}
+	fooConn, barConn := &fakeConn{}, &fakeConn{}
+	s.clientHolder.Add(NewClient("foo", "game", fooConn))
+	s.clientHolder.Add(NewClient("bar", "game", barConn))
+	ops.SetRoomPublic("game", "chess")
+	ops.SetRoomPassword("game", "secret")
+
+	ops.CloseRoom("game", "game over")
+
+	for _, c := range []*fakeConn{fooConn, barConn} {
+		if len(c.written) != 2 || c.written[0] != "game over" || c.written[1] != "close room_closed" || !c.closed {
+			t.Errorf("expected notice and close, got %q", c.written)
+		}
+	}
+	if len(ops.GetPublicRooms()) != 0 || len(s.roomPasswords) != 0 {
+		t.Error("room should be forgotten")
+	}
+	if len(emptied) != 1 || emptied[0] != "game" {
+		t.Errorf("unexpected emptied rooms %v", emptied)
+	}
+}
+
+func TestCloseRoomTo(t *testing.T) {
+	s := NewServer()
+	ops := &Ops{s}
+	conn := &fakeConn{}
+	foo := NewClient("foo", "game", conn)
+	s.clientHolder.Add(foo)
+	s.clientHolder.Add(NewClient("foo", "other", &fakeConn{}))
+
+	ops.CloseRoomTo("game", "back to lobby", "lobby")
+
+	if foo.Room() != "lobby" || conn.closed || len(conn.written) != 1 {
+		t.Errorf("client should be moved to lobby, got %s %q", foo.Room(), conn.written)
+	}
+	if ops.GetRoomCount("other") != 1 {
+		t.Error("connections in other rooms should stay")
+	}
+}
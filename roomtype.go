@@ -0,0 +1,255 @@
+package mobster
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"time"
+)
+
+// ErrRoomFull is returned by Ops.MoveToRoom when target room reached its type capacity
+var ErrRoomFull = errors.New("room full")
+
+// settings shared by rooms of one kind, e.g. lobbies or 1v1 matches, see RegisterRoomType
+type RoomType struct {
+	Name string
+	// max users in room, spectators do not count, unlimited when zero
+	Capacity int
+	// how often OnTick is called while room has clients
+	TickRate time.Duration
+	OnTick   func(ops *Ops, room string)
+	// number of last room messages sent to users joining it
+	HistorySize int
+	// room is closed after so long without messages from its members, see Ops.CloseRoom;
+	// Server.RoomIdleTTL when zero
+	IdleTTL time.Duration
+	// optional notice sent to members of room closed due to IdleTTL
+	IdleMessage string
+	// overrides Server.Flood in rooms of this type
+	Flood *FloodPolicy
+	// overrides Server.RoomBatchWindow in rooms of this type
+	BatchWindow time.Duration
+}
+
+type roomTypeRoute struct {
+	pattern string
+	typ     *RoomType
+}
+
+// use room type for rooms which name matches pattern, as in path.Match, e.g. "match-*";
+// first matching pattern wins, OnRoomType is asked when none matches;
+// has to be called before server starts
+func (s *Server) RegisterRoomType(pattern string, t RoomType) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic(fmt.Sprintf("invalid room pattern %q: %s", pattern, err))
+	}
+	s.roomTypes = append(s.roomTypes, roomTypeRoute{pattern, &t})
+}
+
+// returns name of type of room, empty for untyped rooms
+func (r *RoomOps) Type() string {
+	if t := r.ops.server.roomType(r.name); t != nil {
+		return t.Name
+	}
+	return ""
+}
+
+// returns last messages of room, oldest first, kept only with RoomType.HistorySize
+func (r *RoomOps) History() []string {
+	if st := r.ops.server.rooms[r.name]; st != nil {
+		return slices.Clone(st.history)
+	}
+	return nil
+}
+
+// state of typed room with clients, or of room with idle ttl or batch window
+type roomState struct {
+	typ          *RoomType // nil for untyped room
+	idleTTL      time.Duration
+	tick         *time.Timer
+	idle         *time.Timer
+	lastActivity time.Time
+	history      []string
+	// room messages held until flush fires, see Server.RoomBatchWindow
+	batchWindow time.Duration
+	batch       []string
+	flush       *time.Timer
+}
+
+// kinds of room timers
+const (
+	roomTick = iota
+	roomIdle
+	roomEmpty
+	roomFlush
+)
+
+// fired timer of room
+type roomTimer struct {
+	room  string
+	state *roomState
+	kind  int
+}
+
+// returns type of room, nil for untyped, must be called from processingLoop only
+func (s *Server) roomType(room string) *RoomType {
+	if st := s.rooms[room]; st != nil {
+		return st.typ
+	}
+	for _, route := range s.roomTypes {
+		if ok, _ := path.Match(route.pattern, room); ok {
+			return route.typ
+		}
+	}
+	if s.OnRoomType != nil {
+		return s.OnRoomType(room)
+	}
+	return nil
+}
+
+// tells if user would exceed capacity of room, must be called from processingLoop only
+func (s *Server) roomFull(room, user string) bool {
+	t := s.roomType(room)
+	if t == nil || t.Capacity <= 0 || s.inRoom(user, room) {
+		return false
+	}
+	users := make(map[string]bool)
+	for _, c := range s.clientHolder.GetByRoom(room) {
+		if !c.spectator {
+			users[c.user] = true
+		}
+	}
+	return len(users) >= t.Capacity
+}
+
+// rejects client joining full room, must be called from processingLoop only
+func (s *Server) refuseFull(c *Client) {
+	s.auditf(c.room, c.user, "room_full", "%s: %s refused, room full", c.room, c.user)
+	if s.RoomFullMessage != "" {
+		s.write(c, s.RoomFullMessage)
+	}
+	s.sendClose(c.conn, c.codec, CloseRoomFull)
+	c.conn.Close()
+}
+
+// starts timers of typed room, must be called from processingLoop only
+func (s *Server) startRoomType(room string) {
+	s.cancelEmptyTTL(room)
+	t := s.roomType(room)
+	st := &roomState{typ: t, idleTTL: s.RoomIdleTTL, lastActivity: time.Now(), batchWindow: s.batchWindow(t)}
+	if t != nil && t.IdleTTL > 0 {
+		st.idleTTL = t.IdleTTL
+	}
+	if t == nil && st.idleTTL <= 0 && st.batchWindow <= 0 {
+		return
+	}
+	if t != nil && t.TickRate > 0 && t.OnTick != nil {
+		st.tick = s.armRoomTimer(room, st, t.TickRate, roomTick)
+	}
+	if st.idleTTL > 0 {
+		st.idle = s.armRoomTimer(room, st, st.idleTTL, roomIdle)
+	}
+	s.rooms[room] = st
+}
+
+// stops timers of typed room, must be called from processingLoop only
+func (s *Server) stopRoomType(room string) {
+	st := s.rooms[room]
+	if st == nil {
+		return
+	}
+	// members of other instances may still wait for batched messages
+	s.flushRoom(room)
+	if st.tick != nil {
+		st.tick.Stop()
+	}
+	if st.idle != nil {
+		st.idle.Stop()
+	}
+	delete(s.rooms, room)
+}
+
+func (s *Server) armRoomTimer(room string, st *roomState, d time.Duration, kind int) *time.Timer {
+	return time.AfterFunc(d, func() {
+		select {
+		case s.roomTimers <- roomTimer{room, st, kind}:
+		case <-s.stopping:
+		}
+	})
+}
+
+// must be called from processingLoop only
+func (s *Server) fireRoomTimer(ops *Ops, t roomTimer) {
+	if t.kind == roomEmpty {
+		s.expireEmptyRoom(ops, t)
+		return
+	}
+	st := t.state
+	// room may be emptied meanwhile, or even created again
+	if s.rooms[t.room] != st {
+		return
+	}
+	if t.kind == roomFlush {
+		s.flushRoom(t.room)
+		return
+	}
+	if t.kind == roomTick {
+		st.typ.OnTick(ops, t.room)
+		if s.rooms[t.room] == st {
+			st.tick = s.armRoomTimer(t.room, st, st.typ.TickRate, roomTick)
+		}
+		return
+	}
+	if idle := time.Since(st.lastActivity); idle < st.idleTTL {
+		st.idle = s.armRoomTimer(t.room, st, st.idleTTL-idle, roomIdle)
+		return
+	}
+	s.auditf(t.room, "", "idle_room", "%s: idle for %s", t.room, st.idleTTL)
+	var notice string
+	if st.typ != nil {
+		notice = st.typ.IdleMessage
+	}
+	ops.closeRoom(t.room, notice, "")
+	s.roomExpired(ops, t.room)
+}
+
+// must be called from processingLoop only
+func (s *Server) roomActive(room string, now time.Time) {
+	if st := s.rooms[room]; st != nil {
+		st.lastActivity = now
+	}
+}
+
+// keeps messages written to room in its history, must be called from processingLoop only
+func (s *Server) recordHistory(room string, messages []string) {
+	st := s.rooms[room]
+	if st == nil || st.typ == nil || st.typ.HistorySize <= 0 {
+		return
+	}
+	st.history = append(st.history, messages...)
+	if over := len(st.history) - st.typ.HistorySize; over > 0 {
+		st.history = slices.Delete(st.history, 0, over)
+	}
+}
+
+// writes room history to client which just joined, must be called from processingLoop only
+func (s *Server) sendHistory(c *Client) {
+	st := s.rooms[c.room]
+	if st == nil {
+		return
+	}
+	for _, message := range st.history {
+		if s.write(c, message) != nil {
+			return
+		}
+	}
+}
+
+// flood policy of room, must be called from processingLoop only
+func (s *Server) floodPolicy(room string) *FloodPolicy {
+	if st := s.rooms[room]; st != nil && st.typ != nil && st.typ.Flood != nil {
+		return st.typ.Flood
+	}
+	return s.Flood
+}
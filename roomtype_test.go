@@ -0,0 +1,93 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoomType_capacity(t *testing.T) {
+	s := NewServer()
+	s.RegisterRoomType("duel-*", RoomType{Name: "duel", Capacity: 2})
+	ops := &Ops{s}
+	var conns []*fakeConn
+	for _, user := range []string{"foo", "bar", "baz"} {
+		conn := &fakeConn{}
+		conns = append(conns, conn)
+		s.join(NewClient(user, "duel-1", conn))
+	}
+	spectator := NewClient("watcher", "duel-1", &fakeConn{})
+	spectator.spectator = true
+	s.join(spectator)
+	s.join(NewClient("qux", "lobby", &fakeConn{}))
+
+	if conns[1].closed || !conns[2].closed {
+		t.Error("only user over capacity should be refused")
+	}
+	if len(ops.GetRoomSpectators("duel-1")) != 1 {
+		t.Error("spectators should not count")
+	}
+	if err := ops.MoveToRoom("qux", "duel-1"); err != ErrRoomFull {
+		t.Errorf("move to full room should fail, got %v", err)
+	}
+	if ops.Room("duel-1").Type() != "duel" || ops.Room("lobby").Type() != "" {
+		t.Error("unexpected room types")
+	}
+}
+
+func TestRoomType_history(t *testing.T) {
+	s := NewServer()
+	s.OnRoomType = func(room string) *RoomType {
+		return &RoomType{Name: "chat", HistorySize: 2}
+	}
+	s.join(NewClient("foo", "room", &fakeConn{}))
+	s.writeToRoomLocal("room", "a", "b", "c")
+	conn := &fakeConn{}
+	s.join(NewClient("bar", "room", conn))
+
+	if len(conn.written) != 2 || conn.written[0] != "b" || conn.written[1] != "c" {
+		t.Errorf("joining user should get history, got %q", conn.written)
+	}
+	if h := (&Ops{s}).Room("room").History(); len(h) != 2 {
+		t.Errorf("unexpected history %q", h)
+	}
+}
+
+func TestRoomType_flood(t *testing.T) {
+	s := NewServer()
+	s.Flood = &FloodPolicy{MaxRepeats: 100}
+	s.RegisterRoomType("strict", RoomType{Flood: &FloodPolicy{MaxRepeats: 1}})
+	c := NewClient("foo", "strict", &fakeConn{})
+	s.join(c)
+	now := time.Now()
+	s.detectFlood(c, "spam", now)
+	if _, flood := s.detectFlood(c, "spam", now); !flood {
+		t.Error("room type flood policy should apply")
+	}
+}
+
+func TestFlow_roomTypeTickAndIdle(t *testing.T) {
+	ticks := 0
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.RegisterRoomType("match-*", RoomType{
+		TickRate: 5 * time.Millisecond,
+		OnTick:   func(ops *Ops, room string) { ticks++ },
+		IdleTTL:  50 * time.Millisecond,
+	})
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo match-1")
+	time.Sleep(30 * time.Millisecond)
+	if s.Stats().Clients != 1 {
+		t.Error("room should be kept before idle ttl")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if s.Stats().Clients != 0 {
+		t.Error("idle room should be closed")
+	}
+	s.StopServer()
+	c.Close()
+
+	if ticks < 3 {
+		t.Errorf("room should tick, got %d ticks", ticks)
+	}
+}
@@ -0,0 +1,126 @@
+package mobster
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+// set of handlers for rooms matching pattern registered with HandleRoom,
+// nil handlers fall back to ones set on the server; like on the server,
+// OnDisconnectCode is preferred over OnDisconnect and OnMessageContext or
+// OnMessageErr over OnMessage
+type Handlers struct {
+	OnConnect        func(ops *Ops, user, room string)
+	OnDisconnect     func(ops *Ops, user, room string)
+	OnDisconnectCode func(ops *Ops, user, room string, code CloseCode)
+	OnMessage        func(ops *Ops, user, room, message string)
+	OnMessageContext func(ctx context.Context, ops *Ops, user, room, message string)
+	OnMessageErr     func(ops *Ops, user, room, message string) error
+}
+
+func (h *Handlers) handlesDisconnect() bool {
+	return h.OnDisconnect != nil || h.OnDisconnectCode != nil
+}
+
+func (h *Handlers) handlesMessage() bool {
+	return h.OnMessage != nil || h.OnMessageContext != nil || h.OnMessageErr != nil
+}
+
+// replace server handlers while it runs, nil handlers are left unchanged; disconnect
+// or message handler given replaces whichever of them server used, so that swap takes
+// effect; swap happens in processing loop, between messages, ErrServerStopped is returned
+// when server is not running
+func (s *Server) SetHandlers(handlers Handlers) error {
+	done := make(chan bool, 1)
+	if err := toLoop(s, s.handlerUpdates, handlerUpdate{handlers, done}); err != nil {
+		return err
+	}
+	<-done
+	return nil
+}
+
+type handlerUpdate struct {
+	handlers Handlers
+	done     chan bool
+}
+
+// must be called from processingLoop only
+func (s *Server) applyHandlers(h Handlers) {
+	if h.OnConnect != nil {
+		s.OnConnect = h.OnConnect
+	}
+	if h.handlesDisconnect() {
+		s.OnDisconnectCode = h.OnDisconnectCode
+		if h.OnDisconnect != nil {
+			s.OnDisconnect = h.OnDisconnect
+		}
+	}
+	if h.handlesMessage() {
+		s.OnMessageContext = h.OnMessageContext
+		s.OnMessageErr = h.OnMessageErr
+		if h.OnMessage != nil {
+			s.OnMessage = h.OnMessage
+		}
+	}
+}
+
+type roomRoute struct {
+	pattern  string
+	handlers Handlers
+}
+
+// use handlers for rooms which name matches pattern, as in path.Match, e.g. "chess-*";
+// first matching pattern wins, has to be called before server starts
+func (s *Server) HandleRoom(pattern string, handlers Handlers) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic(fmt.Sprintf("invalid room pattern %q: %s", pattern, err))
+	}
+	s.roomRoutes = append(s.roomRoutes, roomRoute{pattern, handlers})
+}
+
+// returns handlers registered for room, nil if there are none
+func (s *Server) roomHandlers(room string) *Handlers {
+	for idx := range s.roomRoutes {
+		if ok, _ := path.Match(s.roomRoutes[idx].pattern, room); ok {
+			return &s.roomRoutes[idx].handlers
+		}
+	}
+	return nil
+}
+
+func (s *Server) onConnect(ops *Ops, user, room string) {
+	if h := s.roomHandlers(room); h != nil && h.OnConnect != nil {
+		h.OnConnect(ops, user, room)
+		return
+	}
+	s.OnConnect(ops, user, room)
+}
+
+func (s *Server) onDisconnect(ops *Ops, user, room string, code CloseCode) {
+	h := s.roomHandlers(room)
+	if h == nil || !h.handlesDisconnect() {
+		h = &Handlers{OnDisconnect: s.OnDisconnect, OnDisconnectCode: s.OnDisconnectCode}
+	}
+	if h.OnDisconnectCode != nil {
+		h.OnDisconnectCode(ops, user, room, code)
+		return
+	}
+	h.OnDisconnect(ops, user, room)
+}
+
+func (s *Server) onMessage(ops *Ops, user, room, message string) {
+	h := s.roomHandlers(room)
+	if h == nil || !h.handlesMessage() {
+		h = &Handlers{OnMessage: s.OnMessage, OnMessageContext: s.OnMessageContext, OnMessageErr: s.OnMessageErr}
+	}
+	if h.OnMessageContext != nil {
+		h.OnMessageContext(ops.Context(), ops, user, room, message)
+		return
+	}
+	if h.OnMessageErr != nil {
+		s.handleError(user, h.OnMessageErr(ops, user, room, message))
+		return
+	}
+	h.OnMessage(ops, user, room, message)
+}
@@ -0,0 +1,114 @@
+package mobster
+
+import "testing"
+
+func TestFlow_handleRoom(t *testing.T) {
+	var calls []string
+	s := NewServer()
+	s.HandleRoom("chess-*", Handlers{
+		OnMessage: func(ops *Ops, name, room, message string) {
+			calls = append(calls, "chess:"+message)
+		},
+	})
+	s.HandleRoom("lobby", Handlers{
+		OnConnect: func(ops *Ops, name, room string) {
+			calls = append(calls, "lobby:"+name)
+		},
+	})
+	s.OnConnect = func(ops *Ops, name, room string) {}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		calls = append(calls, "default:"+message)
+	}
+	s.StartServer(4009)
+
+	c1 := connectAndSend(t, "a foo chess-1")
+	c2 := connectAndSend(t, "a bar lobby")
+	send(t, c1, "e4")
+	send(t, c2, "hi")
+
+	s.StopServer()
+
+	expected := []string{"lobby:bar", "chess:e4", "default:hi"}
+	if len(calls) != len(expected) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	for idx := range expected {
+		if calls[idx] != expected[idx] {
+			t.Errorf("unexpected calls: %v", calls)
+		}
+	}
+}
+
+func TestHandleRoom_invalidPattern(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for invalid pattern")
+		}
+	}()
+	NewServer().HandleRoom("[", Handlers{})
+}
+
+func TestFlow_setHandlers(t *testing.T) {
+	var calls []string
+	s := NewServer()
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		calls = append(calls, "old:"+message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	send(t, c, "1")
+	err := s.SetHandlers(Handlers{OnMessage: func(ops *Ops, name, room, message string) {
+		calls = append(calls, "new:"+message)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, c, "2")
+
+	s.StopServer()
+	if err := s.SetHandlers(Handlers{}); err != ErrServerStopped {
+		t.Errorf("expected ErrServerStopped after stop, got %v", err)
+	}
+
+	if len(calls) != 2 || calls[0] != "old:1" || calls[1] != "new:2" {
+		t.Errorf("handlers not swapped: %v", calls)
+	}
+}
+
+func TestFlow_setHandlersOverridesPreferred(t *testing.T) {
+	var calls []string
+	s := NewServer()
+	s.DisableAudit = true
+	s.OnMessageErr = func(ops *Ops, name, room, message string) error {
+		calls = append(calls, "err:"+message)
+		return nil
+	}
+	s.HandleRoom("lobby", Handlers{OnMessageErr: func(ops *Ops, name, room, message string) error {
+		calls = append(calls, "lobby:"+message)
+		return nil
+	}})
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	lobby := connectAndSend(t, "a bar lobby")
+	send(t, c, "1")
+	if err := s.SetHandlers(Handlers{OnMessage: func(ops *Ops, name, room, message string) {
+		calls = append(calls, "new:"+message)
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	send(t, c, "2")
+	send(t, lobby, "3")
+	s.StopServer()
+
+	if len(calls) != 3 || calls[0] != "err:1" || calls[1] != "new:2" || calls[2] != "lobby:3" {
+		t.Errorf("swapped OnMessage should replace OnMessageErr, got %v", calls)
+	}
+}
+
+func TestSetHandlers_notStarted(t *testing.T) {
+	if err := NewServer().SetHandlers(Handlers{}); err != ErrServerStopped {
+		t.Errorf("expected ErrServerStopped before start, got %v", err)
+	}
+}
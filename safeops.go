@@ -0,0 +1,196 @@
+package mobster
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrServerStopped is returned by Server.Do and SafeOps when server is shutting down,
+// and by calls which need processing loop when it is not running
+var ErrServerStopped = errors.New("server stopped")
+
+// passes v to processing loop, fails with ErrServerStopped instead of blocking forever
+// when loop is not started yet or already gone
+func toLoop[T any](s *Server, queue chan T, v T) error {
+	select {
+	case <-s.loopStarted:
+	default:
+		return ErrServerStopped
+	}
+	select {
+	case queue <- v:
+		return nil
+	case <-s.stopping:
+		return ErrServerStopped
+	case <-s.loopDone:
+		return ErrServerStopped
+	}
+}
+
+// function run in processing loop on behalf of goroutine outside handlers
+type call struct {
+	fn   func(ops *Ops)
+	done chan struct{}
+}
+
+// Do runs fn with ops in processing loop and waits for it up to SyncTimeout, so that
+// goroutines outside handlers, e.g. http handlers or cron jobs, may use any Ops safely;
+// fn must not keep ops after it returns. On ErrSyncTimeout fn still runs later.
+// Must not be called from handlers, use ops they get instead.
+func (s *Server) Do(fn func(ops *Ops)) error {
+	c := call{fn: fn, done: make(chan struct{}, 1)}
+	timeout := s.SyncTimeout
+	if timeout <= 0 {
+		timeout = DefaultSyncTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case s.calls <- c:
+	case <-s.stopping:
+		return ErrServerStopped
+	case <-timer.C:
+		return ErrSyncTimeout
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-timer.C:
+		return ErrSyncTimeout
+	}
+}
+
+// must be called from processingLoop only
+func (s *Server) handleCall(ops *Ops, c call) {
+	c.fn(ops)
+	c.done <- struct{}{}
+}
+
+// SafeOps is thread-safe counterpart of Ops, every call goes through processing loop
+// with Server.Do, so it fails with ErrSyncTimeout or ErrServerStopped the same way
+type SafeOps struct {
+	server *Server
+}
+
+// returns thread-safe ops for goroutines outside handlers, must not be used from handlers
+func (s *Server) Ops() *SafeOps {
+	return &SafeOps{s}
+}
+
+// runs fn in processing loop, returning its result
+func safeCall[T any](o *SafeOps, fn func(ops *Ops) T) (T, error) {
+	var result T
+	err := o.server.Do(func(ops *Ops) { result = fn(ops) })
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// runs fn in processing loop, returning call error or its own
+func safeErr(o *SafeOps, fn func(ops *Ops) error) error {
+	err, callErr := safeCall(o, fn)
+	if callErr != nil {
+		return callErr
+	}
+	return err
+}
+
+func (o *SafeOps) GetRooms() ([]string, error) {
+	return safeCall(o, func(ops *Ops) []string { return ops.server.clientHolder.GetRooms() })
+}
+
+func (o *SafeOps) GetRoomUsers(room string) ([]string, error) {
+	return safeCall(o, func(ops *Ops) []string { return ops.GetRoomUsers(room) })
+}
+
+func (o *SafeOps) GetRoomCount(room string) (int, error) {
+	return safeCall(o, func(ops *Ops) int { return ops.GetRoomCount(room) })
+}
+
+func (o *SafeOps) GetRoomSpectators(room string) ([]string, error) {
+	return safeCall(o, func(ops *Ops) []string { return ops.GetRoomSpectators(room) })
+}
+
+func (o *SafeOps) GetPublicRooms() ([]RoomListing, error) {
+	return safeCall(o, func(ops *Ops) []RoomListing { return ops.GetPublicRooms() })
+}
+
+// ok is false when user is not connected
+func (o *SafeOps) GetClientInfo(user string) (info ClientInfo, ok bool, err error) {
+	type result struct {
+		info ClientInfo
+		ok   bool
+	}
+	r, err := safeCall(o, func(ops *Ops) result {
+		info, ok := ops.GetClientInfo(user)
+		return result{info, ok}
+	})
+	return r.info, r.ok, err
+}
+
+func (o *SafeOps) GetRole(room, user string) (Role, error) {
+	return safeCall(o, func(ops *Ops) Role { return ops.GetRole(room, user) })
+}
+
+func (o *SafeOps) IsMuted(room, user string) (bool, error) {
+	return safeCall(o, func(ops *Ops) bool { return ops.IsMuted(room, user) })
+}
+
+// returns write result like Ops.SendToWithResult
+func (o *SafeOps) SendTo(user, message string) error {
+	return safeErr(o, func(ops *Ops) error { return ops.SendToWithResult(user, message) })
+}
+
+func (o *SafeOps) SendToRoom(room, message string) error {
+	return o.server.Do(func(ops *Ops) { ops.SendToRoom(room, message) })
+}
+
+func (o *SafeOps) Disconnect(user string) error {
+	return o.server.Do(func(ops *Ops) { ops.Disconnect(user) })
+}
+
+func (o *SafeOps) DisconnectWithCode(user string, code CloseCode) error {
+	return o.server.Do(func(ops *Ops) { ops.DisconnectWithCode(user, code) })
+}
+
+func (o *SafeOps) MoveToRoom(user, room string) error {
+	return safeErr(o, func(ops *Ops) error { return ops.MoveToRoom(user, room) })
+}
+
+func (o *SafeOps) RenameUser(oldName, newName string) error {
+	return safeErr(o, func(ops *Ops) error { return ops.RenameUser(oldName, newName) })
+}
+
+func (o *SafeOps) CloseRoom(room, reason string) error {
+	return o.server.Do(func(ops *Ops) { ops.CloseRoom(room, reason) })
+}
+
+func (o *SafeOps) SetRole(room, user string, role Role) error {
+	return o.server.Do(func(ops *Ops) { ops.SetRole(room, user, role) })
+}
+
+func (o *SafeOps) Mute(room, user string, duration time.Duration) error {
+	return o.server.Do(func(ops *Ops) { ops.Mute(room, user, duration) })
+}
+
+func (o *SafeOps) Unmute(room, user string) error {
+	return o.server.Do(func(ops *Ops) { ops.Unmute(room, user) })
+}
+
+func (o *SafeOps) Ban(user string, duration time.Duration) error {
+	return o.server.Do(func(ops *Ops) { ops.Ban(user, duration) })
+}
+
+func (o *SafeOps) Unban(user string) error {
+	return o.server.Do(func(ops *Ops) { ops.Unban(user) })
+}
+
+func (o *SafeOps) SetRoomPassword(room, password string) error {
+	return o.server.Do(func(ops *Ops) { ops.SetRoomPassword(room, password) })
+}
+
+func (o *SafeOps) CreateInvite(room string) (string, error) {
+	return safeCall(o, func(ops *Ops) string { return ops.CreateInvite(room) })
+}
@@ -0,0 +1,52 @@
+package mobster
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestFlow_safeOps(t *testing.T) {
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo room")
+	sleep()
+
+	ops := s.Ops()
+	if users, err := ops.GetRoomUsers("room"); err != nil || len(users) != 1 || users[0] != "foo" {
+		t.Errorf("unexpected users %v, err %v", users, err)
+	}
+	if err := ops.SendTo("foo", "hello"); err != nil {
+		t.Error(err)
+	}
+	if msg := readFromServer(t, c); msg != "hello" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	if err := ops.SendTo("bar", "hello"); err != ErrNotConnected {
+		t.Errorf("send to missing user should fail, got %v", err)
+	}
+	if err := ops.MoveToRoom("foo", "other"); err != nil {
+		t.Error(err)
+	}
+	if info, ok, err := ops.GetClientInfo("foo"); err != nil || !ok || info.Room != "other" {
+		t.Errorf("unexpected client info %+v %v %v", info, ok, err)
+	}
+
+	// many goroutines at once, e.g. http handlers
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ops.GetRooms(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	s.StopServer()
+
+	if err := s.Do(func(ops *Ops) {}); err != ErrServerStopped {
+		t.Errorf("call after stop should fail, got %v", err)
+	}
+}
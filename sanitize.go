@@ -0,0 +1,43 @@
+package mobster
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// what to do with inbound messages that are not valid utf-8
+type UTF8Policy int
+
+const (
+	// pass messages as they are
+	UTF8Allow UTF8Policy = iota
+	// drop whole message
+	UTF8Reject
+	// remove invalid bytes
+	UTF8Strip
+)
+
+var errInvalidUTF8 = errors.New("invalid utf-8 in message")
+
+// applies server sanitization options to inbound message
+func (s *Server) sanitize(message string) (string, error) {
+	if !utf8.ValidString(message) {
+		switch s.InvalidUTF8 {
+		case UTF8Reject:
+			return "", errInvalidUTF8
+		case UTF8Strip:
+			message = strings.ToValidUTF8(message, "")
+		}
+	}
+	if s.StripControlChars {
+		message = strings.Map(func(r rune) rune {
+			if r != '\t' && unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, message)
+	}
+	return message, nil
+}
@@ -0,0 +1,30 @@
+package mobster
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		policy   UTF8Policy
+		strip    bool
+		in, out  string
+		rejected bool
+	}{
+		{UTF8Allow, false, "foo\xffbar\x1b[31m", "foo\xffbar\x1b[31m", false},
+		{UTF8Reject, false, "foo\xffbar", "", true},
+		{UTF8Reject, false, "zażółć", "zażółć", false},
+		{UTF8Strip, false, "foo\xffbar", "foobar", false},
+		{UTF8Allow, true, "foo\x1b[31m\tbar\x00", "foo[31m\tbar", false},
+		{UTF8Strip, true, "\x07foo\xff", "foo", false},
+	}
+
+	for _, test := range tests {
+		s := &Server{InvalidUTF8: test.policy, StripControlChars: test.strip}
+		out, err := s.sanitize(test.in)
+		if test.rejected != (err != nil) {
+			t.Errorf("%q: unexpected error %v", test.in, err)
+		}
+		if out != test.out {
+			t.Errorf("%q: expected %q, got %q", test.in, test.out, out)
+		}
+	}
+}
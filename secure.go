@@ -0,0 +1,115 @@
+package mobster
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+// encrypts and authenticates messages of clients unable to use tls;
+// key is derived from x25519 exchange: client sends its public key in auth packet
+// and knows server public key beforehand, both sides then use NewSecureCodec;
+// nonces are per direction counters, so replayed, reordered or reflected frames are rejected
+type SecureCodec struct {
+	aead  cipher.AEAD
+	inner Codec
+
+	mu sync.Mutex
+	// nonce prefixes of both directions, derived from order of public keys
+	sendDir, recvDir uint32
+	// counter of last frame sent and last frame accepted
+	sent, received uint64
+}
+
+// creates codec from own private key and public key of the other side,
+// inner codec, if not nil, is applied to plain messages, e.g. for compression;
+// codec keeps counters, so one has to be created per connection
+func NewSecureCodec(private *ecdh.PrivateKey, peerPublic []byte, inner Codec) (*SecureCodec, error) {
+	public, err := ecdh.X25519().NewPublicKey(peerPublic)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := private.ECDH(public)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Key(sha256.New, secret, nil, "mobster secure codec", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c := &SecureCodec{aead: aead, inner: inner, sendDir: 1, recvDir: 2}
+	if bytes.Compare(private.PublicKey().Bytes(), peerPublic) > 0 {
+		c.sendDir, c.recvDir = 2, 1
+	}
+	return c, nil
+}
+
+// size of counter preceding every sealed message
+const secureCounterSize = 8
+
+// outputs counter followed by sealed message
+func (c *SecureCodec) Encode(message []byte) ([]byte, error) {
+	if c.inner != nil {
+		encoded, err := c.inner.Encode(message)
+		if err != nil {
+			return nil, err
+		}
+		message = encoded
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sent == math.MaxUint64 {
+		return nil, errors.New("secure codec counter exhausted")
+	}
+	c.sent++
+	out := make([]byte, secureCounterSize, secureCounterSize+len(message)+c.aead.Overhead())
+	binary.BigEndian.PutUint64(out, c.sent)
+	return c.aead.Seal(out, c.nonce(c.sendDir, c.sent), message, nil), nil
+}
+
+// rejects messages with counter not greater than of last accepted one
+func (c *SecureCodec) Decode(message []byte) ([]byte, error) {
+	if len(message) < secureCounterSize {
+		return nil, errors.New("encrypted message too short")
+	}
+	counter, sealed := binary.BigEndian.Uint64(message), message[secureCounterSize:]
+	c.mu.Lock()
+	if counter <= c.received {
+		c.mu.Unlock()
+		return nil, errors.New("encrypted message replayed or out of order")
+	}
+	plain, err := c.aead.Open(nil, c.nonce(c.recvDir, counter), sealed, nil)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.received = counter
+	c.mu.Unlock()
+	if c.inner != nil {
+		return c.inner.Decode(plain)
+	}
+	return plain, nil
+}
+
+// direction prefix followed by counter, never reused for the same key
+func (c *SecureCodec) nonce(dir uint32, counter uint64) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce, dir)
+	binary.BigEndian.PutUint64(nonce[len(nonce)-secureCounterSize:], counter)
+	return nonce
+}
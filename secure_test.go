@@ -0,0 +1,90 @@
+package mobster
+
+import (
+	"compress/flate"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+func TestSecureCodec(t *testing.T) {
+	serverKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	clientKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	inner, _ := NewFlateCodec(flate.BestSpeed)
+
+	server, err := NewSecureCodec(serverKey, clientKey.PublicKey().Bytes(), inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewSecureCodec(clientKey, serverKey.PublicKey().Bytes(), inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := client.Encode([]byte("move e2 e4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := server.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != "move e2 e4" {
+		t.Errorf("wrong message after roundtrip: %q", decoded)
+	}
+
+	encoded[len(encoded)-1] ^= 1
+	if _, err := server.Decode(encoded); err == nil {
+		t.Error("tampered message should be rejected")
+	}
+}
+
+func TestSecureCodec_wrongKey(t *testing.T) {
+	serverKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	clientKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	otherKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	server, _ := NewSecureCodec(serverKey, clientKey.PublicKey().Bytes(), nil)
+	other, _ := NewSecureCodec(otherKey, serverKey.PublicKey().Bytes(), nil)
+
+	encoded, _ := other.Encode([]byte("hello"))
+	if _, err := server.Decode(encoded); err == nil {
+		t.Error("message encrypted with other key should be rejected")
+	}
+	if _, err := NewSecureCodec(serverKey, []byte("short"), nil); err == nil {
+		t.Error("expected error for malformed public key")
+	}
+}
+
+func TestSecureCodec_replay(t *testing.T) {
+	serverKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	clientKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	server, _ := NewSecureCodec(serverKey, clientKey.PublicKey().Bytes(), nil)
+	client, _ := NewSecureCodec(clientKey, serverKey.PublicKey().Bytes(), nil)
+
+	first, _ := client.Encode([]byte("first"))
+	second, _ := client.Encode([]byte("second"))
+	third, _ := client.Encode([]byte("third"))
+
+	if decoded, err := server.Decode(second); err != nil || string(decoded) != "second" {
+		t.Fatalf("expected second to be accepted, got %q, %v", decoded, err)
+	}
+	if _, err := server.Decode(second); err == nil {
+		t.Error("replayed message should be rejected")
+	}
+	if _, err := server.Decode(first); err == nil {
+		t.Error("reordered message should be rejected")
+	}
+	if decoded, err := server.Decode(third); err != nil || string(decoded) != "third" {
+		t.Errorf("expected third to be accepted, got %q, %v", decoded, err)
+	}
+
+	// frame sent by server must not be accepted when reflected back to it
+	reflected, _ := server.Encode([]byte("reflected"))
+	if _, err := server.Decode(reflected); err == nil {
+		t.Error("reflected message should be rejected")
+	}
+	if decoded, err := client.Decode(reflected); err != nil || string(decoded) != "reflected" {
+		t.Errorf("expected client to accept server message, got %q, %v", decoded, err)
+	}
+}
@@ -1,24 +1,39 @@
 package mobster
 
 import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+var ErrNotConnected = errors.New("user not connected")
+
 type Request struct {
 	client  *Client
 	message string
+	data    []byte // raw message, set only for length prefixed framing
+	ping    bool   // PingCommand of client with codec, answered by processing loop
+	// set when Tracer is used
+	ctx  context.Context
+	span Span
 }
 
 type Response struct {
 	name, message string // name of either user or room
+	// if set, called from processing loop with delivery result
+	result func(err error)
 }
 
 type Server struct {
@@ -29,27 +44,463 @@ type Server struct {
 
 	responses          chan (Response)
 	responsesToRoom    chan (Response)
-	disconnects        chan (string) // name of user to disconnect
-	disconnectsForRoom chan (string) // name of room to disconnect all users from
+	urgent             chan (urgentMessage) // PriorityHigh messages, see SendToWithPriority
+	disconnects        chan (string)        // name of user to disconnect
+	disconnectsForRoom chan (string)        // name of room to disconnect all users from
+	connectionsLost    chan (*Client)       // clients which connection failed on read
 
 	listener net.Listener
+	// optional udp channel, see ServeDatagrams
+	packetConn        net.PacketConn
+	incomingDatagrams chan (datagram)
 
 	clientHolder *ClientHolder
 
 	// true when shutdown procedure started, false otherwise
 	shutdownMode bool
+	// set when listener is closed on purpose while clients are still served, e.g. by Upgrade
+	acceptStopped atomic.Bool
+	// requests dropped due to OverflowDrop, reported in stats
+	dropped atomic.Uint64
+	// traffic of all connections, reported in stats
+	io ioCounters
+	// set by first StopServer call
+	stopped atomic.Bool
+	// set by Drain, new connections are rejected
+	draining atomic.Bool
+	// set shortly before scheduled shutdown, new connections are rejected
+	maintenance     atomic.Bool
+	shutdownNotices chan (string)
+	// closed when last client leaves after Drain
+	drained     chan struct{}
+	drainedDone bool
+	drainStarts chan (bool)
 	// notifies processingLoop about shutdown procedure
 	shutdownNow chan (bool)
+	// closed when shutdown procedure starts, for background loops other than processingLoop
+	stopping chan (struct{})
 
 	shutdownWaitGroup *sync.WaitGroup
 
+	// number of open connections, including not yet authenticated ones
+	connections int32
+
+	// stats requests served by processingLoop
+	statsRequests chan (chan ServerStats)
+	// closed when processing loop starts and returns
+	loopStarted chan struct{}
+	loopDone    chan struct{}
+	// closed when StopServer is over
+	stoppedDone chan struct{}
+	// see MaxPendingHandshakes
+	handshakeSlots chan struct{}
+	handshakes     handshakeStats
+	// connections being handled, force closed by StopServerWithTimeout
+	connsMu   sync.Mutex
+	openConns map[net.Conn]struct{}
+	// see Server.Do
+	calls chan call
+	// requests for state, see Snapshot
+	snapshotRequests chan (chan snapshotResult)
+	// memberships loaded by Restore, by user name, and rooms which data it loaded
+	restored      map[string]clientSnapshot
+	restoredRooms map[string]bool
+	// handler swaps applied by processingLoop
+	handlerUpdates chan (handlerUpdate)
+	// number of messages processed, total and per room
+	messages     uint64
+	roomMessages map[string]uint64
+	// distributions reported in stats, see rollMinute
+	roomRates      Histogram
+	fanouts        Histogram
+	minuteStart    time.Time
+	minuteMessages map[string]uint64
+
+	// last sequence number of message sent to room
+	roomSequences map[string]uint64
+
+	// application data of rooms, see RoomOps.Data
+	roomData map[string]map[string]any
+	// room types registered with RegisterRoomType, first match wins
+	roomTypes []roomTypeRoute
+	// state of typed rooms with clients
+	rooms      map[string]*roomState
+	roomTimers chan roomTimer
+	// clients which throttled writes may go on, see ClientBandwidth
+	shaped chan *Client
+	// set while PriorityHigh message is written, it skips shaping queue
+	writingUrgent bool
+	// set while caller waits for result of write, see Ops.SendToWithResult
+	waitingWrites bool
+	// writers of rooms with clients, see roomMailbox
+	mailboxes map[string]*roomMailbox
+	// failed writes of mailboxes, writesFailed is signalled when there are any
+	failuresMu    sync.Mutex
+	writeFailures []writeFailure
+	writesFailed  chan struct{}
+	// messages waiting for bot handlers, botsReady is signalled when queue is not empty
+	botDeliveries []botDelivery
+	botsReady     chan struct{}
+	// bot which handler is running, its own messages are not delivered back to it
+	activeBot *Client
+	// rooms without clients awaiting EmptyRoomTTL
+	emptyRooms map[string]*roomState
+	// context of message being handled, see Ops.Context
+	handlerCtx context.Context
+	// sessions by user, see Ops.Session
+	sessions map[string]*Session
+
+	// random id of this server, so that own backplane messages are skipped
+	instanceID string
+	// unsubscribe funcs of backplane subjects, by subject
+	backplaneSubs     map[string]func()
+	backplaneIncoming chan (backplaneMessage)
+
+	// descriptions of rooms listed in lobby
+	publicRooms map[string]string
+	// passwords of protected rooms
+	roomPasswords map[string]string
+	// rooms by single use invite tokens
+	invites map[string]string
+	// roles of users by room
+	roles map[string]map[string]Role
+	// mute expiry of users by room, zero time for muted until unmuted
+	mutes map[string]map[string]time.Time
+
+	// handlers by room pattern, see HandleRoom
+	roomRoutes []roomRoute
+	// handlers by first word of message, see Handle
+	commands map[string]CommandHandler
+	// json-rpc methods by name, see HandleRPC
+	rpcMethods map[string]RPCHandler
+
+	// banned users and ips, keyed "user:<name>" and "ip:<ip>", zero time means forever
+	bans map[string]time.Time
+
+	// requests waiting for client reply by id, see Ops.Ask
+	asks        map[uint64]*pendingAsk
+	lastAskID   uint64
+	askTimeouts chan (uint64)
+
+	// clients which did not reconnect within ReconnectGrace
+	graceExpirations chan (*Client)
+
+	// channels of Subscribe callers
+	subscribers subscribers
+
+	// messages waiting for users to reconnect, by user name
+	pending map[string]*pendingMessages
+
 	// if true there will be no timeout for auth packet
 	Debug bool
+	// version of application reported by Info and stats
+	Version string
+
+	// capacity of queues behind async methods like SendTo and Disconnect, DefaultAsyncQueueSize when zero,
+	// takes effect when set before server starts
+	AsyncQueueSize int
+	// what async methods do when their queue is full, OverflowBlock by default
+	AsyncOverflow OverflowPolicy
+	// capacity of queue of messages read from clients, unbuffered when zero so that each
+	// connection waits for processing loop; messages still queued when their client
+	// disconnects are dropped; takes effect when set before server starts
+	IncomingQueueSize int
+	// what connections do when incoming queue is full, OverflowBlock stops reading
+	// from the client until there is room, OverflowDrop drops the message
+	IncomingOverflow OverflowPolicy
+	// how long synchronous calls like SendToSync wait, DefaultSyncTimeout when zero
+	SyncTimeout time.Duration
+	// if true per message [audit] log lines are skipped, they are the main cost of hot path
+	DisableAudit bool
+	// if set, gets every audit event besides log, see SQLAuditSink
+	AuditSink AuditSink
+
+	// wire format of messages, text by default
+	Framing Framing
+	// if set with text framing, splits the stream into auth packet and messages instead of
+	// reads split on newlines, e.g. bufio.ScanLines for CRLF; tokens are not trimmed
+	SplitFunc bufio.SplitFunc
+	// appended to every message written with text framing, e.g. "\n", so that clients
+	// can split writes which got coalesced; nothing by default
+	Delimiter string
+	// if set, transforms every payload written to clients after codec and before framing,
+	// instead of appending Delimiter
+	FormatOutbound func(message []byte) []byte
+	// max size of length prefixed frame or SplitFunc token, DefaultMaxFrameSize when zero
+	MaxFrameSize int
+
+	// if true every connection has to start with PROXY protocol v1 or v2 header,
+	// real client address is then reported instead of load balancer one
+	ProxyProtocol bool
+
+	// period of tcp keepalive probes, go default when zero, negative disables keepalive
+	TCPKeepAlive time.Duration
+	// if true Nagle's algorithm batches small writes, by default they are sent right away
+	TCPDelay bool
+	// sizes of socket buffers, os default when zero
+	TCPReadBuffer  int
+	TCPWriteBuffer int
+
+	// max number of open connections, unlimited when zero
+	MaxClients int
+	// how long connection may take to send proxy header, challenge response and auth packet,
+	// DefaultHandshakeTimeout when zero
+	HandshakeTimeout time.Duration
+	// max number of connections not authenticated yet, unlimited when zero
+	MaxPendingHandshakes int
+	// connections over MaxPendingHandshakes waiting for their turn within HandshakeTimeout,
+	// more are rejected at once
+	HandshakeQueueSize int
+	// optional packet sent to connections rejected due to MaxClients or MaxPendingHandshakes
+	ServerFullMessage string
+	// optional packet sent to clients refused due to RoomType.Capacity
+	RoomFullMessage string
+	// optional packet sent to connection dropped by DuplicateKickOld, before its close code
+	LoggedInElsewhereMessage string
+	// optional packet sent to connections rejected after Drain
+	DrainingMessage string
+	// how long before ScheduleShutdown new connections are rejected, DefaultMaintenanceCutoff when zero
+	MaintenanceCutoff time.Duration
+	// optional packet sent to connections rejected before scheduled shutdown
+	MaintenanceMessage string
+	// formats shutdown notices without message, see ScheduleShutdown
+	FormatShutdownNotice func(remaining time.Duration) string
+
+	// if true messages sent to room are stamped with per room sequence number,
+	// so that clients can detect missed messages, sequence starts over when room empties
+	RoomSequences bool
+	// formats stamped room message, "<seq> <message>" by default
+	FormatSequenced func(seq uint64, message string) string
+
+	// if set, messages to users whose connection was lost are buffered for that long
+	// and sent after they reconnect, including messages sent to their last room
+	ResendWindow time.Duration
+	// max number of buffered messages per user, DefaultResendQueueSize when zero
+	ResendQueueSize int
+	// if set, users whose connection was lost stay in their room for that long, messages
+	// to them are buffered and OnDisconnect is called only if they do not reconnect
+	// to the same room in time; ResendWindow starts after that
+	ReconnectGrace time.Duration
+	// how long after start users restored by Restore may return to their previous room,
+	// DefaultRestoreGrace when zero
+	RestoreGrace time.Duration
+	// how long sessions of disconnected users are kept, see Ops.Session; they are
+	// forgotten on disconnect when zero
+	SessionTTL time.Duration
+	// max number of simultaneous connections of single user, e.g. phone and desktop,
+	// unlimited when zero; messages sent to the user reach all its connections,
+	// OnConnect and OnDisconnect are called for each of them
+	MaxConnectionsPerUser int
+	// what happens when user over MaxConnectionsPerUser connects, DuplicateKickOld by default
+	DuplicateLogin DuplicateLoginPolicy
+	// if set, called for each connection dropped by DuplicateKickOld with details of it and
+	// of the new one, e.g. to warn user about account sharing or stolen credentials
+	OnDuplicateLogin func(ops *Ops, displaced, current ClientInfo)
+	// if set, called when connection is lost and ReconnectGrace starts
+	OnConnectionLost func(ops *Ops, user, room string)
+	// if set, called when user reconnects within ReconnectGrace, instead of OnConnect
+	OnConnectionResumed func(ops *Ops, user, room string)
+
+	// if true messages sent to users which are not connected are saved in MessageStore
+	// and delivered when they authenticate next time
+	StoreOffline bool
+	// in memory store by default
+	MessageStore MessageStore
+
+	// tells if client joins its room as spectator, receiving room messages only
+	IsSpectator func(authMessage string) bool
+	// extracts room password or invite from auth packet, see Ops.SetRoomPassword
+	AuthSecret func(authMessage string) string
+	// optional packet sent to clients denied to join protected room
+	JoinDeniedMessage string
+
+	// optional notice sent back to muted users instead of their message, see Ops.Mute
+	MutedMessage string
+
+	// if set, returns quota of user, nil means unlimited
+	QuotaFor func(user string) *Quota
+	// keeps quota usage, memory store by default, share it between instances
+	QuotaStore QuotaStore
+	// optional notice sent back to users over their quota instead of their message
+	QuotaExceededMessage string
+	// if set, called for each message dropped due to quota
+	OnQuotaExceeded func(ops *Ops, user, room, reason string)
+
+	// if set, called for each text message before handlers see it, may rewrite
+	// the message or drop it by returning false
+	FilterInbound func(user, room, message string) (string, bool)
+	// if set, called for each message before it is written to recipient user,
+	// may rewrite the message or drop it by returning false; room broadcasts are
+	// filtered per recipient so are no longer framed once
+	FilterOutbound func(user, room, message string) (string, bool)
+
+	// if set, flooding clients are kicked and banned
+	Flood *FloodPolicy
+	// if set, called when client floods with reason like FloodRate,
+	// returning false lets the message through without kicking the client
+	OnFlood func(ops *Ops, user, room, reason string) bool
+
+	// if true first user joining empty room becomes its owner
+	AutoOwner bool
+
+	// if set, clients sending exactly this message get list of public rooms
+	// instead of OnMessage being called
+	LobbyCommand string
+	// formats room list sent in response to LobbyCommand, one "<room> <users> <description>" line per room by default
+	FormatRoomList func(rooms []RoomListing) string
+
+	// inbound sanitization applied before OnMessage
+	InvalidUTF8       UTF8Policy
+	StripControlChars bool
+
+	OnAuth func(message string) (username, room string, err error)
+	// if true clients may authenticate as guests with "g" or "g <room>" packet instead of
+	// going through OnAuth, getting username from IDGenerator
+	GuestAuth bool
+	// usernames of guests, RandomIDs with "guest-" prefix by default
+	IDGenerator IDGenerator
+	// if set, picks room of guests sending no room, they are refused otherwise;
+	// called from connection goroutines so has to be thread safe
+	OnGuestRoom func(user string) string
+	// if set, tls clients presenting verified certificate are authenticated by it
+	// and send no auth packet, others still go through OnAuth
+	OnCertAuth func(cert *x509.Certificate) (username, room string, err error)
+	// if set, called for each new connection before anything is read from it (except
+	// proxy protocol header), returning error closes connection right away;
+	// called from connection goroutines so has to be thread safe
+	OnPreConnect func(remote net.Addr) error
+	// if set, each connection has to answer its challenge before sending auth packet,
+	// e.g. ProofOfWork to slow down bots
+	Challenger Challenger
+	// time for answering challenge and sending auth packet, HandshakeTimeout when zero
+	ChallengeTimeout time.Duration
+	// if set, gets each packet read from authenticated client before it is trimmed, split
+	// or decoded, returning true consumes it so it never reaches message handlers;
+	// called from connection goroutines so has to be thread safe, data must not be
+	// retained after it returns
+	OnRawPacket func(user string, data []byte) bool
+	// if set, called after auth to pick codec for the client, e.g. compression the client
+	// declared in its auth packet (empty for certificate auth); nil codec means none
+	OnSelectCodec func(user, room, authMessage string) Codec
+	// if set, called after auth with protocol version client declared in its auth packet
+	// (empty for certificate auth) to accept it, returning version reported in ClientInfo,
+	// and optionally codec translating messages of older protocol; returned error rejects
+	// the client, it is sent back as formatted by FormatError, e.g. HandlerError
+	OnNegotiate func(user, room, authMessage string) (version string, translate Codec, err error)
 
-	OnAuth       func(message string) (username, room string, err error)
 	OnConnect    func(ops *Ops, user, room string)
 	OnDisconnect func(ops *Ops, user, room string)
 	OnMessage    func(ops *Ops, user, room, message string)
+	// if set, called instead of OnMessage with context of the message, see Ops.Context
+	OnMessageContext func(ctx context.Context, ops *Ops, user, room, message string)
+	// deadline of handling single message, context passed to OnMessageContext and returned
+	// by Ops.Context is cancelled after it passes; no deadline when zero
+	MessageTimeout time.Duration
+	// if set, called when user is moved between rooms with Ops.MoveToRoom,
+	// OnLeaveRoom first
+	OnLeaveRoom func(ops *Ops, user, room string)
+	OnJoinRoom  func(ops *Ops, user, room string)
+	// rooms are closed after so long without messages from their members, unless
+	// their RoomType says otherwise; rooms are kept regardless of activity when zero
+	RoomIdleTTL time.Duration
+	// state kept for rooms after last client left, like lobby listing, password, invites
+	// and mutes, is forgotten after so long; it is kept until room is closed when zero
+	EmptyRoomTTL time.Duration
+	// if set, called after room was closed due to idle ttl or its state was forgotten
+	// due to EmptyRoomTTL
+	OnRoomExpired func(ops *Ops, room string)
+	// if set, messages equal to it or starting with it and space are answered with
+	// FormatPong right in the read path, without OnMessage or flood and quota checks,
+	// so that clients may measure round trip time; e.g. "ping"
+	PingCommand string
+	FormatPong  func(payload string, now time.Time) string
+	// if set, room messages written within that much time are sent to each member as
+	// single message made by FormatBatch, saving syscalls of rooms with many tiny updates;
+	// RoomType.BatchWindow overrides it
+	RoomBatchWindow time.Duration
+	// joins batched room messages, newline separated by default
+	FormatBatch func(messages []string) string
+	// formats messages of Announce, "announce <message>" by default
+	FormatAnnouncement func(message string) string
+	// if set, asked for type of rooms not matching any RegisterRoomType pattern, nil
+	// means untyped room; may be called more than once for the same room
+	OnRoomType func(room string) *RoomType
+	// if set, messages are traced from read through handler to writes
+	Tracer Tracer
+	// if set, inbound traffic of every connection is recorded, see Replayer
+	Recorder *Recorder
+	// if set, called when last client leaves the room, after its state is forgotten
+	OnRoomEmptied func(ops *Ops, room string)
+	// if set, called after user was renamed with Ops.RenameUser
+	OnRename func(ops *Ops, oldName, newName string)
+	// if set, called instead of OnDisconnect with reason of disconnect
+	OnDisconnectCode func(ops *Ops, user, room string, code CloseCode)
+	// if true clients get final frame telling why they are disconnected, see FormatClose
+	SendCloseCodes bool
+	// formats final frame, "close <code name>" by default
+	FormatClose func(code CloseCode) string
+	// format requests of Ops.Ask and parse their replies, "ask <id> <request>"
+	// and "reply <id> <reply>" by default
+	FormatAsk  func(id uint64, request string) string
+	ParseReply func(message string) (id uint64, reply string, ok bool)
+	// if set, OnSlowHandler is called when message handler does not return in time
+	HandlerTimeout time.Duration
+	// if true client which message handler timed out gets disconnected
+	DisconnectSlowClients bool
+	// if set, writes not finished in time fail and the client is disconnected,
+	// so that client not reading its socket cannot stall the server
+	WriteTimeout time.Duration
+	// if set, bytes per second written to each client; writes over it wait in shaping queue,
+	// so that clients on slow links get reduced rate stream instead of stalling, see
+	// Ops.SetBandwidth
+	ClientBandwidth int
+	// max bytes waiting in shaping queue of client, oldest writes are dropped over it,
+	// DefaultShapingQueueSize when zero
+	ShapingQueueSize int
+
+	// encoding of typed messages, see RegisterMessage, json by default
+	Encoding Encoding
+
+	// if set, called for messages not matching any command registered with Handle,
+	// otherwise such messages reach OnMessage
+	OnUnknownCommand func(ops *Ops, user, room, command, args string)
+	// if set, messages of spectators are passed here, otherwise they are dropped
+	OnSpectatorMessage func(ops *Ops, user, room, message string)
+	// called when client is not let into password protected room, connection is closed
+	OnJoinDenied func(ops *Ops, user, room string)
+
+	// if set, called instead of OnMessage, returned error is sent back to the client
+	OnMessageErr func(ops *Ops, user, room, message string) error
+	// formats error returned from handlers, "err <code> <message>" by default, see HandlerError
+	FormatError func(err error) string
+
+	// if set, called instead of OnMessage with untouched payload when
+	// length prefixed framing is used
+	OnBinaryMessage func(ops *Ops, user, room string, message []byte)
+
+	// called with payload of datagram received from authenticated client
+	OnDatagram func(ops *Ops, user, room string, payload []byte)
+
+	// called on transport and validation failures, op is one of "accept", "proxy", "auth", "read", "validate", "codec", "decode", "handler", "write", "store", "datagram", "overflow", "tcp", "backplane", "negotiate", "challenge", "quota";
+	// user is empty when not known yet, may be called from multiple goroutines
+	OnError func(user, op string, err error)
+	// called from watchdog goroutine with stacks of all goroutines, see HandlerTimeout
+	OnSlowHandler func(user, room string, elapsed time.Duration, stack []byte)
+	// http sessions without requests for that long are closed, DefaultHTTPSessionTimeout
+	// when zero, see HTTPHandler
+	HTTPSessionTimeout time.Duration
+
+	// if set, room messages and messages to users not connected here are passed to other
+	// instances, messages to users connected nowhere are lost instead of stored then
+	Backplane Backplane
+	// prefix of backplane subjects, DefaultBackplanePrefix when empty
+	BackplanePrefix string
+
+	// called when listener fails permanently, server stops accepting new connections
+	OnListenerError func(err error)
+	// if set, called from background goroutine with current stats every StatsInterval
+	OnStats       func(stats ServerStats)
+	StatsInterval time.Duration
 }
 
 func NewServer() *Server {
@@ -60,21 +511,81 @@ func NewServer() *Server {
 	s.incomingClients = make(chan *Client)
 	s.incomingRequests = make(chan Request)
 
-	s.responses = make(chan Response)
-	s.responsesToRoom = make(chan Response)
-	s.disconnects = make(chan string)
-	s.disconnectsForRoom = make(chan string)
+	s.responses = make(chan Response, DefaultAsyncQueueSize)
+	s.responsesToRoom = make(chan Response, DefaultAsyncQueueSize)
+	s.urgent = make(chan urgentMessage, DefaultAsyncQueueSize)
+	s.disconnects = make(chan string, DefaultAsyncQueueSize)
+	s.disconnectsForRoom = make(chan string, DefaultAsyncQueueSize)
+	s.connectionsLost = make(chan *Client)
+	s.incomingDatagrams = make(chan datagram, datagramQueueSize)
 
 	s.shutdownNow = make(chan bool)
+	s.stopping = make(chan struct{})
 	s.shutdownWaitGroup = &sync.WaitGroup{}
 
-	// default auth function accepts packets like "a <username> <room>"
+	s.statsRequests = make(chan chan ServerStats)
+	s.loopStarted = make(chan struct{})
+	s.loopDone = make(chan struct{})
+	s.stoppedDone = make(chan struct{})
+	s.openConns = make(map[net.Conn]struct{})
+	s.calls = make(chan call)
+	s.snapshotRequests = make(chan chan snapshotResult)
+	s.drained = make(chan struct{})
+	s.asks = make(map[uint64]*pendingAsk)
+	s.bans = make(map[string]time.Time)
+	s.askTimeouts = make(chan uint64)
+	s.shutdownNotices = make(chan string)
+	s.graceExpirations = make(chan *Client)
+	s.roomTimers = make(chan roomTimer)
+	s.shaped = make(chan *Client)
+	s.botsReady = make(chan struct{}, 1)
+	s.mailboxes = make(map[string]*roomMailbox)
+	s.writesFailed = make(chan struct{}, 1)
+	s.rooms = make(map[string]*roomState)
+	s.emptyRooms = make(map[string]*roomState)
+	s.drainStarts = make(chan bool)
+	s.restored = make(map[string]clientSnapshot)
+	s.restoredRooms = make(map[string]bool)
+	s.handlerUpdates = make(chan handlerUpdate)
+	s.roomMessages = make(map[string]uint64)
+	s.roomRates = newHistogram(rateBounds)
+	s.fanouts = newHistogram(sizeBounds)
+	s.minuteMessages = make(map[string]uint64)
+	s.roomSequences = make(map[string]uint64)
+	s.roomData = make(map[string]map[string]any)
+	s.sessions = make(map[string]*Session)
+	// random token of datagrams is good enough as instance id
+	s.instanceID = newDatagramToken()
+	s.backplaneSubs = make(map[string]func())
+	s.backplaneIncoming = make(chan backplaneMessage, backplaneQueueSize)
+	s.pending = make(map[string]*pendingMessages)
+	s.publicRooms = make(map[string]string)
+	s.roomPasswords = make(map[string]string)
+	s.invites = make(map[string]string)
+	s.roles = make(map[string]map[string]Role)
+	s.mutes = make(map[string]map[string]time.Time)
+	s.MessageStore = NewMemoryMessageStore(0)
+	s.QuotaStore = NewMemoryQuotaStore()
+	s.Encoding = JSONEncoding{}
+
+	// default auth function accepts packets like "a <username> <room> [<secret>]",
+	// or with "s" instead of "a" for spectators
 	s.OnAuth = func(message string) (username, room string, err error) {
-		tokens := strings.Split(message, " ")
-		if len(tokens) != 3 || tokens[0] != "a" {
-			return "", "", fmt.Errorf("malformed auth request <%s>", message)
-		}
-		return tokens[1], tokens[2], nil
+		auth, err := ParseAuth(message)
+		return auth.Username, auth.Room, err
+	}
+	s.FormatSequenced = func(seq uint64, message string) string {
+		return fmt.Sprintf("%d %s", seq, message)
+	}
+	s.FormatRoomList = formatRoomList
+	s.FormatError = formatError
+	s.AuthSecret = authSecret
+	s.FormatPong = formatPong
+	s.FormatBatch = formatBatch
+	s.FormatAnnouncement = formatAnnouncement
+	s.IDGenerator = RandomIDs{Prefix: "guest-"}
+	s.IsSpectator = func(authMessage string) bool {
+		return strings.HasPrefix(authMessage, "s ")
 	}
 	s.OnConnect = func(ops *Ops, user, room string) {
 		log.Println("warn: OnConnect default handler")
@@ -82,32 +593,102 @@ func NewServer() *Server {
 	s.OnDisconnect = func(ops *Ops, user, room string) {
 		log.Println("warn: OnDisconnect default handler")
 	}
+	s.OnJoinDenied = func(ops *Ops, user, room string) {
+		log.Printf("warn: %s denied to join %s", user, room)
+	}
 	s.OnMessage = func(ops *Ops, user, room, message string) {
 		log.Println("warn: OnMessage default handler")
 	}
+	s.OnDatagram = func(ops *Ops, user, room string, payload []byte) {
+		log.Println("warn: OnDatagram default handler")
+	}
+	s.OnError = func(user, op string, err error) {
+		if user != "" {
+			log.Printf("%s error (%s): %s", op, user, err)
+			return
+		}
+		log.Printf("%s error: %s", op, err)
+	}
+	s.OnSlowHandler = logSlowHandler
+	s.FormatClose = formatClose
+	s.FormatShutdownNotice = formatShutdownNotice
+	s.FormatAsk = formatAsk
+	s.ParseReply = parseReply
+	s.OnListenerError = func(err error) {
+		log.Println("listener error, no longer accepting connections:", err)
+	}
 
 	return s
 }
 
 func (s *Server) StartServer(port int) {
-	s.startTime = time.Now()
-
 	log.Printf("starting server on port %d", port)
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
+	if err := s.StartServerOn("tcp", fmt.Sprintf(":%d", port)); err != nil {
 		log.Fatal("cannot listen:", err)
 	}
+}
+
+// starts server on any stream network supported by net.Listen, e.g. "tcp" or "unix",
+// stale unix socket file left by a crashed process is removed, one still listened on
+// is an error
+func (s *Server) StartServerOn(network, address string) error {
+	if network == "unix" {
+		if err := removeStaleSocket(address); err != nil {
+			return err
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	s.ServeListener(listener)
+	return nil
+}
 
+// removes unix socket file nobody listens on
+func removeStaleSocket(address string) error {
+	fi, err := os.Stat(address)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	conn, err := net.Dial("unix", address)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use", address)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(address)
+}
+
+// starts server on listener created by caller, e.g. obtained via systemd socket
+// activation or wrapped in tls, listener is closed by StopServer
+func (s *Server) ServeListener(listener net.Listener) {
+	s.startTime = time.Now()
+
+	log.Printf("serving on %s", listener.Addr())
 	s.listener = listener
+	s.resizeQueues()
 
 	s.shutdownWaitGroup.Add(2)
+	close(s.loopStarted)
 	go s.processingLoop()
 	go s.acceptingLoop()
+	if s.OnStats != nil && s.StatsInterval > 0 {
+		s.shutdownWaitGroup.Add(1)
+		go s.statsLoop()
+	}
 }
 
 func (s *Server) StartServerAndWait(port int) {
 	s.StartServer(port)
+	s.WaitForSignals()
+}
 
+// blocks handling signals, dumps stats on SIGQUIT, stops server and exits on SIGINT and SIGTERM
+func (s *Server) WaitForSignals() {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	for {
@@ -122,127 +703,422 @@ func (s *Server) StartServerAndWait(port int) {
 	}
 }
 
-func (s *Server) StopServer() {
-	log.Printf("shutting down...")
-	s.shutdownMode = true
-	s.listener.Close()
-	s.shutdownNow <- true
-	s.shutdownWaitGroup.Wait()
-	log.Printf("bye!")
-}
+// max delay between accept retries after temporary error
+const maxAcceptDelay = 1 * time.Second
 
 func (s *Server) acceptingLoop() {
 	defer s.shutdownWaitGroup.Done()
+	var delay time.Duration // how long to sleep on accept failure
 	for {
 		conn, err := s.listener.Accept()
-		if s.shutdownMode {
+		if s.shutdownMode || s.acceptStopped.Load() {
+			// accepted just as listener was given up, nobody serves it
+			if conn != nil {
+				conn.Close()
+			}
 			return
 		}
 		if err != nil {
-			log.Println("accept error:", err)
-			continue
+			// same approach as in net/http, back off on temporary errors like EMFILE
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else {
+					delay *= 2
+				}
+				if delay > maxAcceptDelay {
+					delay = maxAcceptDelay
+				}
+				s.OnError("", "accept", fmt.Errorf("%s; retrying in %s", err, delay))
+				time.Sleep(delay)
+				continue
+			}
+			s.OnListenerError(err)
+			return
 		}
-		s.shutdownWaitGroup.Add(1)
-		go s.handleConnection(conn)
+		delay = 0
+		s.ServeConn(conn)
 	}
 }
 
-func (s *Server) handleConnection(conn net.Conn) {
+// serves connection established outside of server listener, so that any transport
+// providing net.Conn can be plugged in, e.g. quic streams or websockets;
+// server has to be running
+func (s *Server) ServeConn(conn net.Conn) {
+	if s.shutdownMode {
+		conn.Close()
+		return
+	}
+	if s.draining.Load() {
+		s.reject(conn, "server draining", s.DrainingMessage)
+		return
+	}
+	if s.maintenance.Load() {
+		s.reject(conn, "maintenance", s.MaintenanceMessage)
+		return
+	}
+	if s.MaxClients > 0 && int(atomic.LoadInt32(&s.connections)) >= s.MaxClients {
+		s.reject(conn, "server full", s.ServerFullMessage)
+		return
+	}
+	admission := s.admitHandshake()
+	if admission == handshakeRejected {
+		s.reject(conn, "too many pending handshakes", s.ServerFullMessage)
+		return
+	}
+	atomic.AddInt32(&s.connections, 1)
+	s.shutdownWaitGroup.Add(1)
+	go s.handleConnection(conn, admission == handshakeQueued)
+}
+
+// closes connection not let in, e.g. over MaxClients limit, sending it optional message
+func (s *Server) reject(conn net.Conn, reason, message string) {
+	log.Printf("%s, rejecting connection: %s", reason, conn.RemoteAddr().String())
+	if message != "" {
+		conn.SetWriteDeadline(time.Now().Add(1 * time.Second))
+		conn.Write(s.frame([]byte(message)))
+	}
+	conn.Close()
+}
+
+func (s *Server) handleConnection(conn net.Conn, queued bool) {
 	defer s.shutdownWaitGroup.Done()
+	defer atomic.AddInt32(&s.connections, -1)
+	defer s.trackConn(conn)()
 
-	log.Println("new connection:", conn.RemoteAddr().String())
+	if queued && !s.awaitHandshake() {
+		s.reject(conn, "handshake queue timeout", s.ServerFullMessage)
+		return
+	}
+	handshaking := true
+	defer func() {
+		if handshaking {
+			s.endHandshake()
+		}
+	}()
+	s.tuneTCP(conn)
 	if !s.Debug {
-		conn.SetDeadline(time.Now().Add(1 * time.Second))
+		conn.SetDeadline(time.Now().Add(s.handshakeTimeout()))
 	}
-	var req string
-	err := read(&req, conn)
+	if s.ProxyProtocol {
+		proxied, err := readProxyHeader(conn)
+		if err != nil {
+			s.OnError("", "proxy", err)
+			conn.Close()
+			return
+		}
+		conn = proxied
+	}
+	if s.Recorder != nil {
+		conn = s.Recorder.wrap(conn)
+	}
+	if s.OnPreConnect != nil {
+		if err := s.OnPreConnect(conn.RemoteAddr()); err != nil {
+			s.reject(conn, err.Error(), "")
+			return
+		}
+	}
+	log.Println("new connection:", conn.RemoteAddr().String())
+	reader := s.newFrameReader(conn)
+	if err := s.challenge(conn, reader); err != nil {
+		s.OnError("", "challenge", err)
+		s.sendClose(conn, nil, CloseAuthFailed)
+		conn.Close()
+		return
+	}
+	user, room, req, err := s.authenticate(conn, reader)
 	if err != nil {
-		log.Println("cannot read auth packet:", err)
+		s.OnError("", "auth", err)
+		s.sendClose(conn, nil, CloseAuthFailed)
 		conn.Close()
 		return
 	}
 	conn.SetDeadline(time.Time{})
+	handshaking = false
+	s.endHandshake()
 
-	user, room, err := s.OnAuth(req)
-	if err != nil {
-		log.Println("auth error:", err)
-		conn.Close()
+	var codec Codec
+	if s.OnSelectCodec != nil {
+		codec = s.OnSelectCodec(user, room, req)
+	}
+	version, codec, ok := s.negotiate(conn, user, room, req, codec)
+	if !ok {
 		return
 	}
 
-	client := &Client{user, room, conn}
+	now := time.Now()
+	client := &Client{user: user, room: room, conn: conn, codec: codec, token: newDatagramToken(), connectedAt: now, lastActivity: now}
+	client.protocolVersion = version
+	client.name.Store(&user)
+	client.roomName.Store(&room)
+	defer client.startContext()()
+	if req != "" {
+		client.secret = s.AuthSecret(req)
+		client.spectator = s.IsSpectator(req)
+		client.guest = s.GuestAuth && isGuestPacket(req)
+	}
+	reader.countFor(client)
 	s.incomingClients <- client
 
+	if s.OnRawPacket != nil {
+		reader.raw = func(data []byte) bool {
+			return s.OnRawPacket(client.currentUser(), data)
+		}
+	}
 	for {
-		var req string
-		err := read(&req, client.conn)
+		messages, data, err := reader.readMessages()
 		if err != nil {
 			if !s.shutdownMode {
-				log.Println("read error:", err)
-				s.disconnects <- user
+				s.OnError(client.currentUser(), "read", err)
+				// handler may be busy with its message, processing loop learns later
+				client.cancelContext()
+				s.connectionsLost <- client
 			}
 			return
 		}
-		messages := strings.Split(req, "\n")
-		for _, message := range messages {
-			s.incomingRequests <- Request{client, message}
+		for idx, message := range messages {
+			r := Request{client: client, message: message}
+			if data != nil {
+				r.data = data[idx]
+			}
+			if codec != nil {
+				decoded, err := codec.Decode([]byte(message))
+				if err != nil {
+					s.OnError(client.currentUser(), "codec", err)
+					continue
+				}
+				r.message = string(decoded)
+				if r.data != nil {
+					r.data = decoded
+				}
+			}
+			if s.isPing(r.message) {
+				if codec == nil {
+					s.writePong(client, conn, r.message)
+					continue
+				}
+				// codecs may keep state, so they are used by processing loop only
+				r.ping = true
+			}
+			if r.data == nil || s.OnBinaryMessage == nil {
+				r.message, err = s.sanitize(r.message)
+				if err != nil {
+					s.OnError(client.currentUser(), "validate", err)
+					continue
+				}
+			}
+			s.traceRead(&r)
+			if !enqueue(s, s.IncomingOverflow, s.incomingRequests, r, client.currentUser(), "incoming message") && r.span != nil {
+				r.span.End()
+			}
 		}
 	}
 }
 
-// extracted to go routine, so that rooms ops are thread safe (adding/removing clients)
+// extracted to go routine, so that rooms ops are thread safe (adding/removing clients);
+// connections are written to by mailboxes of rooms, see roomMailbox
 func (s *Server) processingLoop() {
 	defer s.shutdownWaitGroup.Done()
+	defer close(s.loopDone)
 	ops := &Ops{s}
+	// Drain may be called before start
+	s.checkDrained()
 	for {
+		if len(s.urgent) > 0 {
+			s.flushUrgent()
+		}
 		select {
 		case <-s.shutdownNow:
 			log.Printf("disconnecting all clients")
 			for _, c := range s.clientHolder.GetAll() {
-				c.conn.Close()
-				s.clientHolder.Remove(c)
-				s.OnDisconnect(ops, c.user, c.room)
+				s.closeConn(c, CloseShutdown)
+				s.removeClient(c)
+				s.onDisconnect(ops, c.user, c.room, CloseShutdown)
 			}
+			s.closeSubscribers()
+			s.closeDrained()
+			s.closeBackplane()
 			return
 		case c := <-s.incomingClients:
-			s.clientHolder.Add(c)
-			log.Printf("[audit] %s: %s joins", c.room, c.user)
-			s.OnConnect(ops, c.user, c.room)
+			s.join(c)
 		case r := <-s.incomingRequests:
-			log.Printf("[audit] %s: %s -> %s", r.client.room, r.client.user, r.message)
-			s.OnMessage(ops, r.client.user, r.client.room, r.message)
+			s.traceRequest(ops, r)
 
 		// async requests from calls outside handlers
 		case user := <-s.disconnects:
-			c := s.clientHolder.GetByName(user)
-			// may be nil when ops disconnect is used and then accepting loop read nothing
-			if c != nil {
-				log.Printf("[audit] %s: %s disconnects", c.room, c.user)
-				c.conn.Close()
-				s.clientHolder.Remove(c)
-				s.OnDisconnect(ops, c.user, c.room)
+			// may be none when ops disconnect is used and then accepting loop read nothing
+			for _, c := range s.clientHolder.GetAllByName(user) {
+				s.publish(EventKick, c.user, c.room, "")
+				s.disconnect(c, CloseKicked)
 			}
+		case c := <-s.connectionsLost:
+			// may be already gone when disconnected by ops or on write failure
+			if s.clientHolder.Has(c) && !s.suspend(ops, c) {
+				s.keepPending(c)
+				s.disconnect(c, CloseLost)
+			}
+		case c := <-s.graceExpirations:
+			s.expireGrace(c)
+		case t := <-s.roomTimers:
+			s.fireRoomTimer(ops, t)
+		case c := <-s.shaped:
+			s.drainShaper(c)
+		case <-s.botsReady:
+			s.deliverToBots(ops)
+		case <-s.writesFailed:
+			s.handleWriteFailures()
 		case room := <-s.disconnectsForRoom:
-			users := s.clientHolder.GetRoomUsers(room)
-			s.DisconnectUsers(users...)
+			for _, c := range s.clientHolder.GetByRoom(room) {
+				s.disconnect(c, CloseRoomClosed)
+			}
 		case r := <-s.responses:
-			c := s.clientHolder.GetByName(r.name)
-			// may be nil when already disconnected and async server call is used
-			if c != nil {
-				c.conn.Write([]byte(r.message))
-				log.Printf("[audit] %s: %s <- %s", c.room, c.user, r.message)
+			if r.result != nil {
+				r.result(ops.SendToWithResult(r.name, r.message))
+				continue
 			}
-		case r := <-s.responsesToRoom:
-			for _, c := range s.clientHolder.GetByRoom(r.name) {
-				c.conn.Write([]byte(r.message))
-				log.Printf("[audit] %s: %s <- %s", c.room, c.user, r.message)
+			// may be gone when already disconnected and async server call is used
+			if s.writeToUser(r.name, r.message) == ErrNotConnected {
+				s.sendToOffline(r.name, r.message)
 			}
+		case r := <-s.responsesToRoom:
+			s.writeToRooms(s.coalesceRoomMessages(r))
+		case m := <-s.urgent:
+			s.deliverUrgent(m)
+		case message := <-s.shutdownNotices:
+			s.announceShutdown(message)
+		case d := <-s.incomingDatagrams:
+			s.handleDatagram(d)
+		case m := <-s.backplaneIncoming:
+			s.handleBackplaneMessage(m)
+		case id := <-s.askTimeouts:
+			s.expireAsk(id)
+		case u := <-s.handlerUpdates:
+			s.applyHandlers(u.handlers)
+			u.done <- true
+		case c := <-s.calls:
+			s.handleCall(ops, c)
+		case reply := <-s.statsRequests:
+			reply <- s.collectStats()
+		case reply := <-s.snapshotRequests:
+			reply <- s.marshalSnapshot()
+		case <-s.drainStarts:
+			s.checkDrained()
 		}
 	}
 }
 
-func (s *Server) DumpStats() {
-	log.Printf("uptime: %s, connected clients: %d", time.Since(s.startTime), s.clientHolder.Count())
+// must be called from processingLoop only
+func (s *Server) join(c *Client) {
+	if s.banned(c) {
+		s.auditf(c.room, c.user, "banned_refused", "%s: %s banned, connection refused", c.room, c.user)
+		s.sendClose(c.conn, c.codec, CloseBanned)
+		c.conn.Close()
+		return
+	}
+	if s.resume(c) {
+		return
+	}
+	if !s.rejoin(c) && !s.canJoin(c) {
+		s.denyJoin(c)
+		return
+	}
+	if !c.spectator && s.roomFull(c.room, c.user) {
+		s.refuseFull(c)
+		return
+	}
+	if !s.admitConnection(c) {
+		return
+	}
+	ops := &Ops{s}
+	if s.AutoOwner && !c.spectator && ops.GetRoomCount(c.room) == 0 {
+		ops.SetRole(c.room, c.user, RoleOwner)
+	}
+	created := s.clientHolder.GetRoomCount(c.room) == 0
+	s.clientHolder.Add(c)
+	s.auditf(c.room, c.user, "join", "%s: %s joins", c.room, c.user)
+	s.resumeSession(c.user)
+	if created {
+		s.roomCreated(c.room)
+	}
+	s.attachMailbox(c)
+	s.backplaneSubscribe("user", c.user)
+	s.publish(EventConnect, c.user, c.room, "")
+	s.flushPending(c)
+	s.flushStored(c)
+	s.sendHistory(c)
+	s.onConnect(ops, c.user, c.room)
+}
+
+// must be called from processingLoop only
+func (s *Server) handleRequest(ops *Ops, r Request) {
+	// may be already gone when disconnected while its messages were queued
+	if !s.clientHolder.Has(r.client) {
+		return
+	}
+	if r.ping {
+		s.write(r.client, s.pong(r.message))
+		return
+	}
+	r.client.lastActivity = time.Now()
+	s.roomActive(r.client.room, r.client.lastActivity)
+	if s.checkFlood(ops, r.client, r.message) {
+		return
+	}
+	s.messages++
+	s.roomMessages[r.client.room]++
+	s.rollMinute(r.client.lastActivity)
+	s.minuteMessages[r.client.room]++
+	if ops.IsMuted(r.client.room, r.client.user) {
+		s.auditf(r.client.room, r.client.user, "muted", "%s: %s muted, message dropped", r.client.room, r.client.user)
+		if s.MutedMessage != "" {
+			s.write(r.client, s.MutedMessage)
+		}
+		return
+	}
+	if s.checkQuota(ops, r.client, r.message) {
+		return
+	}
+	if r.data == nil || s.OnBinaryMessage == nil {
+		var ok bool
+		if r.message, ok = s.filterInbound(r.client, r.message); !ok {
+			return
+		}
+	}
+	if r.client.spectator {
+		if !s.DisableAudit {
+			s.auditf(r.client.room, r.client.user, "spectator_message", "%s: spectator %s -> %s", r.client.room, r.client.user, r.message)
+		}
+		if s.OnSpectatorMessage != nil {
+			s.OnSpectatorMessage(ops, r.client.user, r.client.room, r.message)
+		}
+		return
+	}
+	if r.data != nil && s.OnBinaryMessage != nil {
+		if !s.DisableAudit {
+			s.auditf(r.client.room, r.client.user, "binary_message", "%s: %s -> %d bytes", r.client.room, r.client.user, len(r.data))
+		}
+		if len(s.subscribers.get()) > 0 {
+			s.publish(EventMessage, r.client.user, r.client.room, string(r.data))
+		}
+		watchdog := s.startWatchdog(r.client)
+		s.OnBinaryMessage(ops, r.client.user, r.client.room, r.data)
+		stopWatchdog(watchdog)
+		return
+	}
+	if !s.DisableAudit {
+		s.auditf(r.client.room, r.client.user, "message", "%s: %s -> %s", r.client.room, r.client.user, r.message)
+	}
+	s.publish(EventMessage, r.client.user, r.client.room, r.message)
+	if s.handleReply(ops, r.client.user, r.message) {
+		return
+	}
+	if s.LobbyCommand != "" && r.message == s.LobbyCommand {
+		s.write(r.client, s.FormatRoomList(ops.GetPublicRooms()))
+		return
+	}
+	watchdog := s.startWatchdog(r.client)
+	s.dispatch(ops, r.client.user, r.client.room, r.message)
+	stopWatchdog(watchdog)
 }
 
 // server operations that may be called from inside OnConnect, OnDisconnect, OnMessage
@@ -250,73 +1126,335 @@ type Ops struct {
 	server *Server
 }
 
-// send message to given user
+// send message to given user, to all of its connections when there are several
 func (o *Ops) SendTo(user, message string) {
-	c := o.server.clientHolder.GetByName(user)
-	c.conn.Write([]byte(message))
-	log.Printf("[audit] %s: %s <- %s", c.room, user, message)
+	if o.server.writeToUser(user, message) == ErrNotConnected {
+		o.server.sendToOffline(user, message)
+	}
+}
+
+// send message to given user, ErrNotConnected is returned if there is no such user,
+// message is not stored for later delivery then
+func (o *Ops) SendToWithResult(user, message string) error {
+	o.server.waitingWrites = true
+	defer func() { o.server.waitingWrites = false }()
+	return o.server.writeToUser(user, message)
 }
 
 // send message to all users in given room
 func (o *Ops) SendToRoom(room, message string) {
-	for _, c := range o.server.clientHolder.GetByRoom(room) {
-		c.conn.Write([]byte(message))
-		log.Printf("[audit] %s: %s <- %s", room, c.user, message)
-	}
+	o.server.writeToRoom(room, message)
 }
 
-// disconnect user
+// disconnect user, OnDisconnect is not called
 func (o *Ops) Disconnect(user string) {
-	c := o.server.clientHolder.GetByName(user)
-	c.conn.Close()
-	o.server.clientHolder.Remove(c)
-	log.Printf("[audit] %s: %s disconnects", c.room, c.user)
+	o.DisconnectWithCode(user, CloseKicked)
 }
 
-// disconnect all users in room
+// disconnect all users in room, their connections to other rooms stay
 func (o *Ops) DisconnectRoom(room string) {
-	for _, user := range o.server.clientHolder.GetRoomUsers(room) {
-		o.Disconnect(user)
+	for _, c := range o.server.clientHolder.GetByRoom(room) {
+		o.server.closeClient(c, CloseRoomClosed)
 	}
 }
 
-// get names of all users in given room
+// get names of all users in given room, spectators excluded
 func (o *Ops) GetRoomUsers(room string) []string {
-	return o.server.clientHolder.GetRoomUsers(room)
+	return o.server.clientHolder.GetRoomPlayers(room)
 }
 
-// get number of users in given room
+// get number of users in given room, spectators excluded
 func (o *Ops) GetRoomCount(room string) int {
-	return o.server.clientHolder.GetRoomCount(room)
+	return len(o.server.clientHolder.GetRoomPlayers(room))
+}
+
+// get names of spectators in given room
+func (o *Ops) GetRoomSpectators(room string) []string {
+	return o.server.clientHolder.GetRoomSpectators(room)
+}
+
+// get sequence number of last message sent to given room
+func (o *Ops) GetRoomSequence(room string) uint64 {
+	return o.server.roomSequences[room]
 }
 
+// get newest client of given user, nil if user is not connected; client is owned by
+// processing loop, so it should not be used outside of handlers
+func (o *Ops) GetClient(user string) *Client {
+	return o.server.clientHolder.GetByName(user)
+}
+
+// get connection details of given user, false if user is not connected
+func (o *Ops) GetClientInfo(user string) (ClientInfo, bool) {
+	c := o.server.clientHolder.GetByName(user)
+	if c == nil {
+		return ClientInfo{}, false
+	}
+	return c.info(), true
+}
+
+// get remote address of given user, nil if user is not connected
+func (o *Ops) GetClientAddr(user string) net.Addr {
+	c := o.server.clientHolder.GetByName(user)
+	if c == nil {
+		return nil
+	}
+	return c.conn.RemoteAddr()
+}
+
+// async methods below queue requests for processing loop, see AsyncQueueSize and AsyncOverflow
 func (s *Server) SendTo(user, message string) {
-	go func() { s.responses <- Response{user, message} }()
+	enqueue(s, s.AsyncOverflow, s.responses, Response{name: user, message: message}, user, "message")
+}
+
+// like Ops.SendToWithResult, result is passed to callback called from processing loop,
+// or from caller with ErrQueueFull when message is dropped due to OverflowDrop
+func (s *Server) SendToWithCallback(user, message string, result func(err error)) {
+	if !enqueue(s, s.AsyncOverflow, s.responses, Response{name: user, message: message, result: result}, user, "message") && result != nil {
+		result(ErrQueueFull)
+	}
+}
+
+// default limit of waiting in synchronous calls like SendToSync
+const DefaultSyncTimeout = 5 * time.Second
+
+// returned from synchronous calls when processing loop does not answer in time
+var ErrSyncTimeout = errors.New("timed out waiting for server")
+
+// like SendToWithCallback, but waits for result up to SyncTimeout, ErrNotConnected or write
+// error is returned as Ops.SendToWithResult does; must not be called from handlers
+func (s *Server) SendToSync(user, message string) error {
+	result := make(chan error, 1)
+	s.SendToWithCallback(user, message, func(err error) { result <- err })
+	timeout := s.SyncTimeout
+	if timeout <= 0 {
+		timeout = DefaultSyncTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		return ErrSyncTimeout
+	}
 }
 
 func (s *Server) SendToRoom(room, message string) {
-	go func() { s.responsesToRoom <- Response{room, message} }()
+	enqueue(s, s.AsyncOverflow, s.responsesToRoom, Response{name: room, message: message}, "", "room message")
 }
 
 func (s *Server) Disconnect(user string) {
-	go func() { s.disconnects <- user }()
+	enqueue(s, s.AsyncOverflow, s.disconnects, user, user, "disconnect")
 }
 
 func (s *Server) DisconnectUsers(users ...string) {
-	go func() {
-		for _, user := range users {
-			s.disconnects <- user
-		}
-	}()
+	for _, user := range users {
+		s.Disconnect(user)
+	}
 }
 
 func (s *Server) DisconnectRoom(room string) {
-	go func() { s.disconnectsForRoom <- room }()
+	enqueue(s, s.AsyncOverflow, s.disconnectsForRoom, room, "", "room disconnect")
+}
+
+// writes to client connection, client is disconnected on failure,
+// must be called from processingLoop only
+func (s *Server) write(c *Client, message string) error {
+	return s.writeShared(c, message, nil)
+}
+
+// like write, framed is message already framed for clients without codec, so that
+// room broadcasts convert message once, may be nil
+func (s *Server) writeShared(c *Client, message string, framed []byte) error {
+	if s.FilterOutbound != nil {
+		filtered, ok := s.filterOutbound(c, message)
+		if !ok {
+			return nil
+		}
+		if filtered != message {
+			message, framed = filtered, nil
+		}
+	}
+	if c.bot != nil {
+		return s.writeToBot(c, message)
+	}
+	data := framed
+	if c.codec != nil {
+		encoded, err := c.codec.Encode([]byte(message))
+		if err != nil {
+			s.OnError(c.user, "codec", err)
+			return err
+		}
+		data = s.frame(encoded)
+	} else if data == nil {
+		buf := getWriteBuffer()
+		defer putWriteBuffer(buf)
+		*buf = s.appendFrame(*buf, message)
+		data = *buf
+	}
+	return s.writeData(c, data, message)
+}
+
+// writes framed data carrying given messages, on failure messages are kept for resend
+// and client is disconnected, must be called from processingLoop only
+func (s *Server) writeData(c *Client, data []byte, messages ...string) error {
+	if s.writingUrgent {
+		s.chargeShaper(c, len(data))
+	} else if s.shape(c, data, messages) {
+		return nil
+	}
+	return s.writeNow(c, data, messages...)
+}
+
+// like writeData, bypassing ClientBandwidth; data is queued in mailbox of client's room,
+// failures are handled when mailbox reports them, unless caller waits for result as
+// Ops.SendToWithResult does; must be called from processingLoop only
+func (s *Server) writeNow(c *Client, data []byte, messages ...string) error {
+	if m := c.mailbox; m != nil {
+		// data may be pooled buffer, reused once this returns
+		item := mailboxItem{client: c, conn: c.conn, data: append([]byte(nil), data...), messages: messages}
+		if s.waitingWrites {
+			item.result = make(chan error, 1)
+		}
+		if m.push(item, s.writingUrgent) {
+			if item.result != nil {
+				if err := <-item.result; err != nil {
+					s.writeFailed(c, messages, err)
+					return err
+				}
+			}
+			s.auditReceived(c, messages)
+			return nil
+		}
+		// stopped meanwhile, connection is free once earlier writes are done
+		<-m.done
+		c.mailbox = nil
+	}
+	n, err := s.writeConn(c.conn, data)
+	s.countWrite(c, max(len(messages), 1), n)
+	if err != nil {
+		s.writeFailed(c, messages, err)
+		return err
+	}
+	s.auditReceived(c, messages)
+	return nil
+}
+
+// keeps messages of failed write for resend and disconnects client,
+// must be called from processingLoop only
+func (s *Server) writeFailed(c *Client, messages []string, err error) {
+	s.OnError(c.user, "write", err)
+	// may be already gone when write fails inside of OnDisconnect
+	if s.clientHolder.Has(c) {
+		s.keepPending(c)
+		for _, message := range messages {
+			s.queuePending(c.user, message)
+		}
+		s.disconnect(c, CloseLost)
+	}
+}
+
+// must be called from processingLoop only
+func (s *Server) auditReceived(c *Client, messages []string) {
+	if !s.DisableAudit {
+		for _, message := range messages {
+			s.auditf(c.room, c.user, "receive", "%s: %s <- %s", c.room, c.user, message)
+		}
+	}
+}
+
+// writes messages to all clients in room, here and on other instances connected by backplane,
+// must be called from processingLoop only
+func (s *Server) writeToRoom(room string, messages ...string) {
+	if st := s.rooms[room]; st != nil && st.batchWindow > 0 {
+		s.batchRoomMessages(room, st, messages)
+		return
+	}
+	s.backplanePublish("room", room, messages...)
+	s.writeToRoomLocal(room, messages...)
+}
+
+// writes messages to all clients in room, stamping them with sequence numbers if enabled;
+// messages are framed once and written with single Write to every client without codec,
+// must be called from processingLoop only
+func (s *Server) writeToRoomLocal(room string, messages ...string) {
+	clients := s.clientHolder.GetByRoom(room)
+	if len(clients) == 0 && len(s.pending) == 0 {
+		return
+	}
+	defer s.traceWrite("mobster.broadcast", "", room, len(clients))(nil)
+	s.fanouts.Observe(float64(len(clients)))
+	if s.RoomSequences {
+		for i, message := range messages {
+			s.roomSequences[room]++
+			messages[i] = s.FormatSequenced(s.roomSequences[room], message)
+		}
+	}
+	buf := getWriteBuffer()
+	defer putWriteBuffer(buf)
+	for _, message := range messages {
+		*buf = s.appendFrame(*buf, message)
+	}
+	// codec clients share frames encoded once per codec instance
+	var shared []codecFrames
+	for _, c := range clients {
+		if c.codec != nil && c.bot == nil && s.FilterOutbound == nil {
+			var data []byte
+			var ok bool
+			if shared, data, ok = s.encodeShared(shared, c.codec, messages); ok {
+				s.writeData(c, data, messages...)
+				continue
+			}
+		}
+		if c.bot != nil || c.codec != nil || s.FilterOutbound != nil {
+			for _, message := range messages {
+				if s.writeShared(c, message, nil) != nil {
+					break
+				}
+			}
+			continue
+		}
+		s.writeData(c, *buf, messages...)
+	}
+	for _, message := range messages {
+		s.queuePendingForRoom(room, message)
+	}
+	s.recordHistory(room, messages)
+}
+
+// closes and forgets client, must be called from processingLoop only
+func (s *Server) disconnect(c *Client, code CloseCode) {
+	s.closeClient(c, code)
+	s.onDisconnect(&Ops{s}, c.user, c.room, code)
+}
+
+// forgets client and state of its room when it was the last one,
+// must be called from processingLoop only
+func (s *Server) removeClient(c *Client) {
+	s.clientHolder.Remove(c)
+	c.cancelContext()
+	if !s.inRoom(c.user, c.room) {
+		s.forgetRole(c.room, c.user)
+	}
+	if s.clientHolder.GetByName(c.user) == nil {
+		if len(s.asks) > 0 {
+			s.forgetAsks(c.user)
+		}
+		s.leaveSession(c.user)
+		s.backplaneUnsubscribe("user", c.user)
+	}
+	s.publish(EventDisconnect, c.user, c.room, "")
+	if s.clientHolder.GetRoomCount(c.room) == 0 {
+		s.roomEmptied(c.room)
+	}
+	s.checkDrained()
 }
 
 // reads from connection
-func read(message *string, conn net.Conn) error {
-	var buf [512]byte
+func read(message *string, conn io.Reader) error {
+	buf := readBuffers.Get().(*[readBufferSize]byte)
+	defer readBuffers.Put(buf)
 	n, err := conn.Read(buf[0:])
 	if err != nil {
 		return err
@@ -1,16 +1,24 @@
 package mobster
 
 import (
+	"errors"
 	"flag"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
 )
 
 func TestMain(m *testing.M) {
+	// started by TestUpgrade_keepsClients in place of new server version
+	if os.Getenv(listenerFDEnv) != "" {
+		os.Exit(0)
+	}
 	flag.Parse()
 	if !testing.Verbose() {
 		log.SetOutput(ioutil.Discard)
@@ -155,6 +163,96 @@ func TestFlow_echoToRoomResponse(t *testing.T) {
 	s.StopServer()
 }
 
+func TestFlow_roomSequences(t *testing.T) {
+	s := NewServer()
+	s.RoomSequences = true
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+
+	c1 := connectAndSend(t, "a foo 123")
+	c2 := connectAndSend(t, "a bar 123")
+
+	send(t, c1, "boo")
+	readFromServer(t, c1)
+	if r := readFromServer(t, c2); r != "1 boo" {
+		t.Errorf("expected first sequence number, got %q", r)
+	}
+	send(t, c2, "baz")
+	if r := readFromServer(t, c1); r != "2 baz" {
+		t.Errorf("expected increasing sequence numbers, got %q", r)
+	}
+
+	s.StopServer()
+}
+
+func TestFlow_sendToWithResult(t *testing.T) {
+	var offline, online error
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		offline = ops.SendToWithResult("bar", "hi")
+		online = ops.SendToWithResult(name, "hi")
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	results := make(chan error, 2)
+	s.SendToWithCallback("foo", "hello", func(err error) { results <- err })
+	s.SendToWithCallback("bar", "hello", func(err error) { results <- err })
+
+	if offline != ErrNotConnected || online != nil {
+		t.Errorf("unexpected results from ops: %v, %v", offline, online)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-results:
+			if err != nil && err != ErrNotConnected {
+				t.Errorf("unexpected result: %v", err)
+			}
+		case <-time.After(50 * time.Millisecond):
+			t.Error("callback not called")
+		}
+	}
+	readFromServer(t, c)
+
+	s.StopServer()
+}
+
+func TestFlow_spectators(t *testing.T) {
+	var messages, spectated []string
+	var count int
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		count = ops.GetRoomCount(room)
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		messages = append(messages, message)
+		ops.SendToRoom(room, message)
+	}
+	s.OnSpectatorMessage = func(ops *Ops, name, room, message string) {
+		spectated = append(spectated, message)
+	}
+	s.StartServer(4009)
+
+	c1 := connectAndSend(t, "a foo 123")
+	c2 := connectAndSend(t, "s bar 123")
+	send(t, c1, "move")
+	send(t, c2, "gg")
+
+	if r := readFromServer(t, c2); r != "move" {
+		t.Errorf("spectator should receive room messages, got %q", r)
+	}
+	if count != 1 {
+		t.Errorf("spectators should not be counted, got %d", count)
+	}
+	if len(messages) != 1 || len(spectated) != 1 || spectated[0] != "gg" {
+		t.Errorf("spectator messages should be routed separately, got %v and %v", messages, spectated)
+	}
+
+	s.StopServer()
+}
+
 func TestFlow_disconnectRoom(t *testing.T) {
 	s := NewServer()
 
@@ -195,6 +293,272 @@ func TestFlow_sendToDisconnected(t *testing.T) {
 	s.StopServer()
 }
 
+func TestFlow_errorHandler(t *testing.T) {
+	var ops []string
+	s := NewServer()
+	s.OnError = func(user, op string, err error) {
+		ops = append(ops, op+":"+user)
+	}
+	s.StartServer(4009)
+
+	connectAndSend(t, "malformed")
+	c := connectAndSend(t, "a foo 123")
+	c.Close()
+	sleep()
+
+	s.StopServer()
+
+	if len(ops) != 2 || ops[0] != "auth:" || ops[1] != "read:foo" {
+		t.Errorf("unexpected errors reported: %v", ops)
+	}
+}
+
+func TestFlow_clientInfo(t *testing.T) {
+	var info ClientInfo
+	var found bool
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		info, found = ops.GetClientInfo(name)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+
+	if !found {
+		t.Fatal("client info not found")
+	}
+	if info.User != "foo" || info.Room != "123" || info.Transport != "tcp" {
+		t.Errorf("wrong client info: %+v", info)
+	}
+	if info.RemoteAddr.String() != c.LocalAddr().String() {
+		t.Errorf("wrong remote address: %s", info.RemoteAddr)
+	}
+	if info.ConnectedAt.IsZero() {
+		t.Error("connect time not set")
+	}
+
+	s.StopServer()
+}
+
+func TestFlow_clientLastActivity(t *testing.T) {
+	var connected, afterMessage ClientInfo
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		connected, _ = ops.GetClientInfo(name)
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		afterMessage, _ = ops.GetClientInfo(name)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	sleep()
+	send(t, c, "hello")
+	sleep()
+
+	if !connected.LastActivity.Equal(connected.ConnectedAt) {
+		t.Errorf("last activity should start at connect time: %+v", connected)
+	}
+	if !afterMessage.LastActivity.After(connected.LastActivity) {
+		t.Errorf("last activity not updated by message: %+v", afterMessage)
+	}
+
+	s.StopServer()
+}
+
+func TestFlow_writeFailureDisconnects(t *testing.T) {
+	disconnected := make(chan string, 10)
+	s := NewServer()
+	s.OnDisconnect = func(ops *Ops, name, room string) {
+		disconnected <- name
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	defer c.Close()
+	broken, other := net.Pipe()
+	other.Close()
+	s.incomingClients <- &Client{user: "bar", room: "123", conn: broken}
+
+	s.SendToRoom("123", "hello")
+	select {
+	case name := <-disconnected:
+		if name != "bar" {
+			t.Errorf("broken client should be disconnected, got %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("broken client not disconnected")
+	}
+	sleep()
+	select {
+	case name := <-disconnected:
+		t.Errorf("only broken client should be disconnected, got %s too", name)
+	default:
+	}
+
+	s.StopServer()
+}
+
+func TestFlow_maxClients(t *testing.T) {
+	connections := 0
+	s := NewServer()
+	s.MaxClients = 1
+	s.ServerFullMessage = "full"
+	s.OnConnect = func(ops *Ops, name, room string) {
+		connections++
+	}
+	s.StartServer(4009)
+
+	connectAndSend(t, "a foo 123")
+	c := connectAndSend(t, "a bar 123")
+
+	if response := readFromServer(t, c); response != "full" {
+		t.Errorf("expected server full packet, got %q", response)
+	}
+	if connections != 1 {
+		t.Error("only one client should be connected")
+	}
+
+	s.StopServer()
+}
+
+func TestServeListener(t *testing.T) {
+	connected := false
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		connected = true
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ServeListener(l)
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, c, "a foo 123")
+
+	if !connected {
+		t.Error("on connect did not fire")
+	}
+	s.StopServer()
+}
+
+func TestServeConn(t *testing.T) {
+	s := NewServer()
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		ops.SendTo(name, message)
+	}
+	s.StartServer(4009)
+
+	local, remote := net.Pipe()
+	s.ServeConn(local)
+	send(t, remote, "a foo 123")
+	go send(t, remote, "foo bar")
+
+	if response := readFromServer(t, remote); response != "foo bar" {
+		t.Errorf("expected echo over served connection, got %q", response)
+	}
+
+	s.StopServer()
+}
+
+func TestStartServerOn_unix(t *testing.T) {
+	connected := false
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		connected = true
+	}
+	path := filepath.Join(t.TempDir(), "mobster.sock")
+	if err := s.StartServerOn("unix", path); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, c, "a foo 123")
+
+	if !connected {
+		t.Error("on connect did not fire")
+	}
+	s.StopServer()
+}
+
+func TestStartServerOn_unixSocketInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mobster.sock")
+	first := NewServer()
+	if err := first.StartServerOn("unix", path); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewServer().StartServerOn("unix", path); err == nil {
+		t.Error("socket of running server should not be taken over")
+	}
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal("first server lost its socket:", err)
+	}
+	c.Close()
+	first.StopServer()
+
+	// stale socket file left without listener is replaced
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	s := NewServer()
+	if err := s.StartServerOn("unix", path); err != nil {
+		t.Fatal("stale socket should be removed:", err)
+	}
+	s.StopServer()
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// returns given errors from Accept, one by one
+type failingListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	err := l.errs[0]
+	l.errs = l.errs[1:]
+	return nil, err
+}
+
+func TestAcceptingLoop_backoff(t *testing.T) {
+	var fatal error
+	var retries int
+	s := NewServer()
+	s.OnError = func(user, op string, err error) {
+		retries++
+	}
+	s.OnListenerError = func(err error) {
+		fatal = err
+	}
+	s.listener = &failingListener{errs: []error{temporaryError{}, temporaryError{}, io.EOF}}
+
+	s.shutdownWaitGroup.Add(1)
+	s.acceptingLoop()
+
+	if retries != 2 {
+		t.Errorf("expected two retries, got %d", retries)
+	}
+	if fatal != io.EOF {
+		t.Errorf("expected listener error, got %v", fatal)
+	}
+}
+
 func connect(t *testing.T) net.Conn {
 	conn, err := net.Dial("tcp", "127.0.0.1:4009")
 	if err != nil {
@@ -234,3 +598,35 @@ func readFromServer(t *testing.T, conn net.Conn) string {
 func sleep() {
 	time.Sleep(1 * time.Millisecond)
 }
+
+func TestWriteTimeout(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.WriteTimeout = 10 * time.Millisecond
+	var op string
+	s.OnError = func(user, o string, err error) {
+		op = o
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Error("expected deadline error:", err)
+		}
+	}
+	disconnected := false
+	s.OnDisconnect = func(ops *Ops, user, room string) { disconnected = true }
+
+	// nobody reads the other end, so write blocks until deadline
+	local, remote := net.Pipe()
+	defer remote.Close()
+	c := &Client{user: "foo", room: "room", conn: local}
+	s.clientHolder.Add(c)
+
+	start := time.Now()
+	if err := s.write(c, "hello"); err == nil {
+		t.Fatal("expected write to fail")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("write not bounded by timeout")
+	}
+	if op != "write" || !disconnected || s.clientHolder.GetByName("foo") != nil {
+		t.Error("client not disconnected after timeout")
+	}
+}
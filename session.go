@@ -0,0 +1,86 @@
+package mobster
+
+import "time"
+
+// application data of user which outlives single connection, see Ops.Session;
+// like Ops it may be used from inside handlers only
+type Session struct {
+	user    string
+	created time.Time
+	// zero while user is connected
+	expires time.Time
+	data    map[string]any
+}
+
+func (s *Session) User() string {
+	return s.user
+}
+
+// when session was created, i.e. first connection of the user
+func (s *Session) Created() time.Time {
+	return s.created
+}
+
+// get value stored under key, nil when missing
+func (s *Session) Get(key string) any {
+	return s.data[key]
+}
+
+func (s *Session) Set(key string, value any) {
+	s.data[key] = value
+}
+
+func (s *Session) Delete(key string) {
+	delete(s.data, key)
+}
+
+// get session of user, created for connected users on first use; sessions of
+// disconnected users are kept for SessionTTL, nil for unknown users
+func (o *Ops) Session(user string) *Session {
+	s := o.server
+	session := s.sessions[user]
+	if session != nil && !session.expires.IsZero() && time.Now().After(session.expires) {
+		delete(s.sessions, user)
+		session = nil
+	}
+	if session == nil && s.clientHolder.GetByName(user) != nil {
+		session = &Session{user: user, created: time.Now(), data: make(map[string]any)}
+		s.sessions[user] = session
+	}
+	return session
+}
+
+// forgets session of user, next call to Session starts a new one
+func (o *Ops) EndSession(user string) {
+	delete(o.server.sessions, user)
+}
+
+// keeps session of user for its next connection, must be called from processingLoop only
+func (s *Server) resumeSession(user string) {
+	if session := s.sessions[user]; session != nil {
+		if !session.expires.IsZero() && time.Now().After(session.expires) {
+			delete(s.sessions, user)
+			return
+		}
+		session.expires = time.Time{}
+	}
+}
+
+// starts expiration of session of user which is gone, must be called from processingLoop only
+func (s *Server) leaveSession(user string) {
+	session := s.sessions[user]
+	if session == nil || s.clientHolder.GetByName(user) != nil {
+		return
+	}
+	if s.SessionTTL <= 0 {
+		delete(s.sessions, user)
+		return
+	}
+	now := time.Now()
+	session.expires = now.Add(s.SessionTTL)
+	for name, other := range s.sessions {
+		if !other.expires.IsZero() && now.After(other.expires) {
+			delete(s.sessions, name)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mobster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFlow_session(t *testing.T) {
+	s := NewServer()
+	s.SessionTTL = time.Second
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		session := ops.Session(user)
+		if message == "get" {
+			ops.SendTo(user, fmt.Sprint(session.Get("score")))
+			return
+		}
+		session.Set("score", message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123", "42")
+	c.Close()
+	sleep()
+	c = connectAndSend(t, "a foo 456", "get")
+	if msg := readFromServer(t, c); msg != "42" {
+		t.Errorf("session should survive reconnect, got %q", msg)
+	}
+	s.StopServer()
+}
+
+func TestSession_expiry(t *testing.T) {
+	s := NewServer()
+	s.SessionTTL = time.Millisecond
+	ops := &Ops{s}
+	c := NewClient("foo", "123", &fakeConn{})
+	s.clientHolder.Add(c)
+
+	if ops.Session("bar") != nil {
+		t.Error("unknown user should have no session")
+	}
+	ops.Session("foo").Set("score", 1)
+	s.removeClient(c)
+	if ops.Session("foo").Get("score") != 1 {
+		t.Error("session should be kept for its ttl")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if ops.Session("foo") != nil {
+		t.Error("session should expire")
+	}
+
+	s.SessionTTL = 0
+	s.clientHolder.Add(c)
+	ops.Session("foo").Set("score", 1)
+	s.removeClient(c)
+	if ops.Session("foo") != nil {
+		t.Error("session should end with connection without ttl")
+	}
+}
@@ -0,0 +1,100 @@
+package mobster
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownError is returned by StopServerWithTimeout when shutdown did not finish in time
+type ShutdownError struct {
+	// processing loop was still busy, e.g. in stuck handler
+	ProcessingLoop bool
+	// connections which were still open and got force closed
+	Connections int
+}
+
+func (e *ShutdownError) Error() string {
+	var parts []string
+	if e.ProcessingLoop {
+		parts = append(parts, "processing loop busy")
+	}
+	if e.Connections > 0 {
+		parts = append(parts, fmt.Sprintf("%d connections force closed", e.Connections))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "background goroutines still running")
+	}
+	return "shutdown timed out: " + strings.Join(parts, ", ")
+}
+
+// like StopServer, but waits at most d; connections still open then are force closed and
+// ShutdownError tells what did not finish, server goroutines may still be unwinding
+func (s *Server) StopServerWithTimeout(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-s.stopServer():
+		return nil
+	case <-timer.C:
+	}
+	err := &ShutdownError{Connections: int(atomic.LoadInt32(&s.connections))}
+	select {
+	case <-s.loopDone:
+	default:
+		err.ProcessingLoop = true
+	}
+	s.closeConns()
+	log.Printf("shutdown: %s", err)
+	return err
+}
+
+func (s *Server) StopServer() {
+	<-s.stopServer()
+}
+
+// starts shutdown unless already started, returned channel is closed when it is over
+func (s *Server) stopServer() <-chan struct{} {
+	if s.stopped.Swap(true) {
+		// already stopping, e.g. due to ScheduleShutdown
+		return s.stoppedDone
+	}
+	log.Printf("shutting down...")
+	s.shutdownMode = true
+	close(s.stopping)
+	s.listener.Close()
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	go func() {
+		// processing loop may be stuck in handler
+		s.shutdownNow <- true
+		s.shutdownWaitGroup.Wait()
+		log.Printf("bye!")
+		close(s.stoppedDone)
+	}()
+	return s.stoppedDone
+}
+
+// tracks open connection for force close, returned function forgets it
+func (s *Server) trackConn(conn net.Conn) func() {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	s.openConns[conn] = struct{}{}
+	return func() {
+		s.connsMu.Lock()
+		defer s.connsMu.Unlock()
+		delete(s.openConns, conn)
+	}
+}
+
+func (s *Server) closeConns() {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for conn := range s.openConns {
+		conn.Close()
+	}
+}
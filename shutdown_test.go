@@ -0,0 +1,45 @@
+package mobster
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStopServerWithTimeout(t *testing.T) {
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.StartServer(4009)
+	connectAndSend(t, "a foo room")
+	sleep()
+	if err := s.StopServerWithTimeout(time.Second); err != nil {
+		t.Errorf("clean shutdown should succeed, got %v", err)
+	}
+}
+
+func TestStopServerWithTimeout_stuckHandler(t *testing.T) {
+	unblock := make(chan bool)
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) { <-unblock }
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo room", "stuck")
+	sleep()
+
+	err := s.StopServerWithTimeout(20 * time.Millisecond)
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) || !shutdownErr.ProcessingLoop || shutdownErr.Connections != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err.Error() != "shutdown timed out: processing loop busy, 1 connections force closed" {
+		t.Errorf("unexpected message %q", err)
+	}
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	var buf [16]byte
+	if _, err := c.Read(buf[:]); err == nil {
+		t.Error("connection should be force closed")
+	}
+
+	close(unblock)
+	s.StopServer()
+}
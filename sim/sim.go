@@ -0,0 +1,394 @@
+// Package sim drives fake clients of mobster server from declarative scripts, so that
+// protocol scenarios read as text instead of test code full of sleeps.
+//
+// Script has one step per line, blank lines and lines starting with # are skipped:
+//
+//	timeout 500ms
+//	connect alice a alice lobby
+//	connect bob a bob lobby
+//	send alice hello
+//	expect bob alice: hello
+//	match bob ^alice: .*$
+//	quiet alice 100ms
+//	send bob /quit
+//	closed bob
+//	sleep 50ms
+//	disconnect alice
+//
+// timeout sets how long expect, match and closed wait for server, 1s by default;
+// connect opens connection and sends rest of line as auth packet; send sends rest of
+// line as message; expect wants next message of client to be rest of line and match
+// wants it to match regexp; quiet wants no message for given duration; closed waits
+// for server to close connection, skipping messages before; disconnect closes
+// connection from client side and sleep pauses script.
+//
+// Use Run from go test with server listening on test address, or cmd/mobster-sim.
+package sim
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaults of Options
+const (
+	DefaultTimeout   = time.Second
+	DefaultAuthDelay = 20 * time.Millisecond
+)
+
+type Options struct {
+	// address of server, used by default Dial
+	Addr string
+	// opens connection for connect step, net.Dial of Addr when nil
+	Dial func() (net.Conn, error)
+	// delimiter of server messages with text framing, see mobster.Server.Delimiter;
+	// every read is one message when empty, as server writes them by default
+	Delimiter string
+	// messages are length prefixed, as with mobster.FramingLengthPrefixed
+	LengthPrefixed bool
+	// initial timeout of steps waiting for server, DefaultTimeout when zero
+	Timeout time.Duration
+	// pause after auth packet with text framing, so that server does not read following
+	// message as part of it, DefaultAuthDelay when zero
+	AuthDelay time.Duration
+}
+
+type Step struct {
+	Line int
+	Op   string
+	// name of client, empty for sleep and timeout
+	Client string
+	// rest of line, e.g. message or auth packet
+	Arg      string
+	duration time.Duration
+	pattern  *regexp.Regexp
+}
+
+type Script struct {
+	Name  string
+	Steps []Step
+}
+
+// StepError tells which step of script failed
+type StepError struct {
+	Script string
+	Step   Step
+	Err    error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("%s:%d: %s %s: %v", e.Script, e.Step.Line, e.Step.Op, e.Step.Client, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+var errTimeout = errors.New("timed out")
+
+// parses script, name is used in errors
+func Parse(name string, r io.Reader) (*Script, error) {
+	script := &Script{Name: name}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		step, err := parseStep(line, text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		script.Steps = append(script.Steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// parses script from file
+func ParseFile(path string) (*Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(path, f)
+}
+
+func parseStep(line int, text string) (Step, error) {
+	op, rest, _ := strings.Cut(text, " ")
+	step := Step{Line: line, Op: op}
+	switch op {
+	case "sleep", "timeout":
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return step, err
+		}
+		step.duration = d
+		return step, nil
+	case "connect", "send", "expect", "match", "quiet", "disconnect", "closed":
+	default:
+		return step, fmt.Errorf("unknown step %q", op)
+	}
+	step.Client, step.Arg, _ = strings.Cut(strings.TrimSpace(rest), " ")
+	if step.Client == "" {
+		return step, fmt.Errorf("%s needs client name", op)
+	}
+	switch op {
+	case "connect":
+		if step.Arg == "" {
+			return step, errors.New("connect needs auth packet")
+		}
+	case "match":
+		re, err := regexp.Compile(step.Arg)
+		if err != nil {
+			return step, err
+		}
+		step.pattern = re
+	case "quiet":
+		d, err := time.ParseDuration(step.Arg)
+		if err != nil {
+			return step, err
+		}
+		step.duration = d
+	case "disconnect", "closed":
+		if step.Arg != "" {
+			return step, fmt.Errorf("unexpected %q after client name", step.Arg)
+		}
+	}
+	return step, nil
+}
+
+// runs script step by step, stopping at first failure which is returned as *StepError;
+// connections left open are closed at the end
+func (s *Script) Run(opts Options) error {
+	if opts.Dial == nil {
+		addr := opts.Addr
+		opts.Dial = func() (net.Conn, error) { return net.Dial("tcp", addr) }
+	}
+	if opts.AuthDelay <= 0 {
+		opts.AuthDelay = DefaultAuthDelay
+	}
+	r := &runner{opts: opts, timeout: opts.Timeout, clients: make(map[string]*client)}
+	if r.timeout <= 0 {
+		r.timeout = DefaultTimeout
+	}
+	defer r.close()
+	for _, step := range s.Steps {
+		if err := r.step(step); err != nil {
+			return &StepError{Script: s.Name, Step: step, Err: err}
+		}
+	}
+	return nil
+}
+
+// parses and runs script file
+func RunFile(path string, opts Options) error {
+	script, err := ParseFile(path)
+	if err != nil {
+		return err
+	}
+	return script.Run(opts)
+}
+
+type runner struct {
+	opts    Options
+	timeout time.Duration
+	clients map[string]*client
+}
+
+func (r *runner) step(step Step) error {
+	switch step.Op {
+	case "sleep":
+		time.Sleep(step.duration)
+		return nil
+	case "timeout":
+		r.timeout = step.duration
+		return nil
+	case "connect":
+		if _, ok := r.clients[step.Client]; ok {
+			return errors.New("already connected")
+		}
+		c, err := r.connect(step.Arg)
+		if err != nil {
+			return err
+		}
+		r.clients[step.Client] = c
+		return nil
+	}
+	c, ok := r.clients[step.Client]
+	if !ok {
+		return errors.New("not connected")
+	}
+	switch step.Op {
+	case "send":
+		_, err := c.conn.Write(r.frame(step.Arg, "\n"))
+		return err
+	case "expect":
+		message, err := c.next(r.timeout)
+		if err != nil {
+			return fmt.Errorf("expected %q: %w", step.Arg, err)
+		}
+		if message != step.Arg {
+			return fmt.Errorf("expected %q, got %q", step.Arg, message)
+		}
+	case "match":
+		message, err := c.next(r.timeout)
+		if err != nil {
+			return fmt.Errorf("expected match of %q: %w", step.Arg, err)
+		}
+		if !step.pattern.MatchString(message) {
+			return fmt.Errorf("expected match of %q, got %q", step.Arg, message)
+		}
+	case "quiet":
+		message, err := c.next(step.duration)
+		if err == nil {
+			return fmt.Errorf("expected no message, got %q", message)
+		}
+		if !errors.Is(err, errTimeout) {
+			return err
+		}
+	case "disconnect":
+		c.close()
+		delete(r.clients, step.Client)
+	case "closed":
+		deadline := time.After(r.timeout)
+		for {
+			select {
+			case _, ok := <-c.messages:
+				if ok {
+					continue
+				}
+				c.close()
+				delete(r.clients, step.Client)
+				return nil
+			case <-deadline:
+				return errors.New("connection still open")
+			}
+		}
+	}
+	return nil
+}
+
+func (r *runner) connect(auth string) (*client, error) {
+	conn, err := r.opts.Dial()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(r.frame(auth, "")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !r.opts.LengthPrefixed {
+		time.Sleep(r.opts.AuthDelay)
+	}
+	c := &client{conn: conn, messages: make(chan string, 1024), done: make(chan struct{})}
+	go c.read(r.opts)
+	return c, nil
+}
+
+// frames message, text ones get suffix
+func (r *runner) frame(message, suffix string) []byte {
+	if r.opts.LengthPrefixed {
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(message))), message...)
+	}
+	return []byte(message + suffix)
+}
+
+func (r *runner) close() {
+	for _, c := range r.clients {
+		c.close()
+	}
+}
+
+type client struct {
+	conn net.Conn
+	// closed when connection is lost
+	messages chan string
+	err      error
+	// closed with connection, so that unread messages do not block reader
+	done chan struct{}
+}
+
+func (c *client) close() {
+	close(c.done)
+	c.conn.Close()
+}
+
+func (c *client) next(timeout time.Duration) (string, error) {
+	select {
+	case message, ok := <-c.messages:
+		if !ok {
+			return "", fmt.Errorf("connection closed: %w", c.err)
+		}
+		return message, nil
+	case <-time.After(timeout):
+		return "", errTimeout
+	}
+}
+
+func (c *client) read(opts Options) {
+	defer close(c.messages)
+	c.err = readMessages(c.conn, opts, func(message string) {
+		select {
+		case c.messages <- message:
+		case <-c.done:
+		}
+	})
+}
+
+func readMessages(conn net.Conn, opts Options, deliver func(string)) error {
+	if opts.LengthPrefixed {
+		r := bufio.NewReader(conn)
+		var header [4]byte
+		for {
+			if _, err := io.ReadFull(r, header[:]); err != nil {
+				return err
+			}
+			data := make([]byte, binary.BigEndian.Uint32(header[:]))
+			if _, err := io.ReadFull(r, data); err != nil {
+				return err
+			}
+			deliver(string(data))
+		}
+	}
+	if opts.Delimiter != "" {
+		var pending string
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := conn.Read(buf)
+			pending += string(buf[:n])
+			for {
+				message, rest, ok := strings.Cut(pending, opts.Delimiter)
+				if !ok {
+					break
+				}
+				deliver(message)
+				pending = rest
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			deliver(string(buf[:n]))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
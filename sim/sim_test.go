@@ -0,0 +1,142 @@
+package sim
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prozz/mobster"
+)
+
+func sendToOthers(ops *mobster.Ops, room, user, message string) {
+	for _, u := range ops.GetRoomUsers(room) {
+		if u != user {
+			ops.SendTo(u, message)
+		}
+	}
+}
+
+// starts chat server which broadcasts messages to room except sender
+func startServer(t *testing.T) string {
+	t.Helper()
+	s := mobster.NewServer()
+	s.Delimiter = "\n"
+	s.OnConnect = func(ops *mobster.Ops, user, room string) {
+		sendToOthers(ops, room, user, user+" joined")
+	}
+	s.OnDisconnect = func(ops *mobster.Ops, user, room string) {
+		ops.SendToRoom(room, user+" left")
+	}
+	s.OnMessage = func(ops *mobster.Ops, user, room, message string) {
+		if message == "/kick" {
+			sendToOthers(ops, room, user, user+" kicked")
+			ops.Disconnect(user)
+			return
+		}
+		sendToOthers(ops, room, user, user+": "+message)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ServeListener(l)
+	t.Cleanup(s.StopServer)
+	return l.Addr().String()
+}
+
+func TestRunFile(t *testing.T) {
+	addr := startServer(t)
+	if err := RunFile("testdata/chat.sim", Options{Addr: addr, Delimiter: "\n"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun_failures(t *testing.T) {
+	tests := []struct {
+		script string
+		line   int
+		err    string
+	}{
+		{"connect a a a r\nconnect b a b r\nexpect a nope", 3, `expected "nope", got "b joined"`},
+		{"timeout 10ms\nconnect a a a r\nexpect a anything", 3, "timed out"},
+		{"connect a a a r\nconnect b a b r\nmatch a ^c", 3, `expected match of "^c", got "b joined"`},
+		{"connect a a a r\nconnect b a b r\nquiet a 50ms", 3, `expected no message, got "b joined"`},
+		{"timeout 10ms\nconnect a a a r\nclosed a", 3, "connection still open"},
+		{"send a hello", 1, "not connected"},
+		{"connect a a a r\nconnect a a a r", 2, "already connected"},
+	}
+	for _, tt := range tests {
+		script, err := Parse("test", strings.NewReader(tt.script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = script.Run(Options{Addr: startServer(t), Delimiter: "\n"})
+		var stepErr *StepError
+		if !errors.As(err, &stepErr) {
+			t.Errorf("%q: expected step error, got %v", tt.script, err)
+			continue
+		}
+		if stepErr.Step.Line != tt.line || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: expected %q at line %d, got %v", tt.script, tt.err, tt.line, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	script, err := Parse("test", strings.NewReader("# comment\n\nconnect a a a  r \nsleep 5ms\nsend a hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(script.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(script.Steps))
+	}
+	if step := script.Steps[0]; step.Line != 3 || step.Client != "a" || step.Arg != "a a  r" {
+		t.Errorf("unexpected connect step %+v", step)
+	}
+	if step := script.Steps[1]; step.duration != 5*time.Millisecond {
+		t.Errorf("unexpected sleep step %+v", step)
+	}
+	if step := script.Steps[2]; step.Arg != "hello world" {
+		t.Errorf("unexpected send step %+v", step)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	for _, script := range []string{
+		"jump a",
+		"send",
+		"connect a",
+		"sleep soon",
+		"quiet a",
+		"match a (",
+		"closed a now",
+	} {
+		if _, err := Parse("test", strings.NewReader(script)); err == nil || !strings.HasPrefix(err.Error(), "test:1: ") {
+			t.Errorf("%q: expected error at line 1, got %v", script, err)
+		}
+	}
+}
+
+func TestRun_lengthPrefixed(t *testing.T) {
+	s := mobster.NewServer()
+	s.Framing = mobster.FramingLengthPrefixed
+	s.OnMessage = func(ops *mobster.Ops, user, room, message string) {
+		ops.SendTo(user, "echo "+message)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ServeListener(l)
+	defer s.StopServer()
+
+	script, err := Parse("test", strings.NewReader("connect a a a r\nsend a one\nsend a two\nexpect a echo one\nexpect a echo two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := script.Run(Options{Addr: l.Addr().String(), LengthPrefixed: true}); err != nil {
+		t.Fatal(err)
+	}
+}
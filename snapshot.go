@@ -0,0 +1,188 @@
+package mobster
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// how long after start restored users may return to their previous room
+const DefaultRestoreGrace = 5 * time.Minute
+
+// logical server state, see Snapshot
+type snapshot struct {
+	Version       int                             `json:"version"`
+	Clients       []clientSnapshot                `json:"clients"`
+	PublicRooms   map[string]string               `json:"public_rooms"`
+	RoomPasswords map[string]string               `json:"room_passwords"`
+	Invites       map[string]string               `json:"invites"`
+	Roles         map[string]map[string]Role      `json:"roles"`
+	Mutes         map[string]map[string]time.Time `json:"mutes"`
+	RoomSequences map[string]uint64               `json:"room_sequences"`
+	RoomMessages  map[string]uint64               `json:"room_messages"`
+	RoomData      map[string]map[string]any       `json:"room_data"`
+	Sessions      []sessionSnapshot               `json:"sessions"`
+}
+
+type clientSnapshot struct {
+	User      string `json:"user"`
+	Room      string `json:"room"`
+	Spectator bool   `json:"spectator"`
+}
+
+type sessionSnapshot struct {
+	User    string         `json:"user"`
+	Created time.Time      `json:"created"`
+	Expires time.Time      `json:"expires"` // zero for connected users
+	Data    map[string]any `json:"data"`
+}
+
+// snapshot encoded by processing loop, as room and session data may be changed by handlers
+type snapshotResult struct {
+	data []byte
+	err  error
+}
+
+// Snapshot captures rooms, memberships, roles, mutes, passwords, invites, room data and
+// sessions of running server, so that they can be brought back with Restore after restart;
+// it contains room passwords and invites, store it accordingly. Room and session data
+// is encoded as json, so values come back as json.Unmarshal decodes them, e.g. numbers
+// as float64. ErrServerStopped is returned when server is not running.
+func (s *Server) Snapshot() ([]byte, error) {
+	reply := make(chan snapshotResult, 1)
+	if err := toLoop(s, s.snapshotRequests, reply); err != nil {
+		return nil, err
+	}
+	r := <-reply
+	return r.data, r.err
+}
+
+// Restore loads state captured by Snapshot, it has to be called before server starts.
+// Users which were connected and join within RestoreGrace after start return to their
+// previous room regardless of room they ask for, if its password or invite lets them in.
+// Sessions of users connected at snapshot are kept for SessionTTL or RestoreGrace,
+// whichever is longer, data of rooms nobody returned to is forgotten after RestoreGrace.
+func (s *Server) Restore(data []byte) error {
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+	maps.Copy(s.publicRooms, snap.PublicRooms)
+	maps.Copy(s.roomPasswords, snap.RoomPasswords)
+	maps.Copy(s.invites, snap.Invites)
+	maps.Copy(s.roles, snap.Roles)
+	maps.Copy(s.mutes, snap.Mutes)
+	maps.Copy(s.roomSequences, snap.RoomSequences)
+	maps.Copy(s.roomMessages, snap.RoomMessages)
+	for _, c := range snap.Clients {
+		s.restored[c.User] = c
+	}
+	for room, data := range snap.RoomData {
+		s.roomData[room] = data
+		s.restoredRooms[room] = true
+	}
+	keep := time.Now().Add(max(s.SessionTTL, s.restoreGrace()))
+	for _, session := range snap.Sessions {
+		if session.Expires.IsZero() {
+			session.Expires = keep
+		}
+		if session.Data == nil {
+			session.Data = make(map[string]any)
+		}
+		s.sessions[session.User] = &Session{user: session.User, created: session.Created, expires: session.Expires, data: session.Data}
+	}
+	return nil
+}
+
+// must be called from processingLoop only
+func (s *Server) marshalSnapshot() snapshotResult {
+	data, err := json.Marshal(s.takeSnapshot())
+	return snapshotResult{data, err}
+}
+
+// must be called from processingLoop only
+func (s *Server) takeSnapshot() snapshot {
+	snap := snapshot{
+		Version:       snapshotVersion,
+		Clients:       []clientSnapshot{},
+		PublicRooms:   maps.Clone(s.publicRooms),
+		RoomPasswords: maps.Clone(s.roomPasswords),
+		Invites:       maps.Clone(s.invites),
+		Roles:         make(map[string]map[string]Role),
+		Mutes:         make(map[string]map[string]time.Time),
+		RoomSequences: maps.Clone(s.roomSequences),
+		RoomMessages:  maps.Clone(s.roomMessages),
+		RoomData:      s.roomData,
+		Sessions:      []sessionSnapshot{},
+	}
+	for _, session := range s.sessions {
+		if !session.expires.IsZero() && time.Now().After(session.expires) {
+			continue
+		}
+		snap.Sessions = append(snap.Sessions, sessionSnapshot{User: session.user, Created: session.created, Expires: session.expires, Data: session.data})
+	}
+	for room, roles := range s.roles {
+		snap.Roles[room] = maps.Clone(roles)
+	}
+	for room, mutes := range s.mutes {
+		snap.Mutes[room] = maps.Clone(mutes)
+	}
+	for _, c := range s.clientHolder.GetAll() {
+		if c.bot != nil {
+			continue
+		}
+		snap.Clients = append(snap.Clients, clientSnapshot{User: c.user, Room: c.room, Spectator: c.spectator})
+	}
+	return snap
+}
+
+// puts client back to the room it was in before restart, tells if it did; client stays
+// in room it asked for when grace is over or it is not allowed into previous room,
+// must be called from processingLoop only
+func (s *Server) rejoin(c *Client) bool {
+	if len(s.restored) == 0 && len(s.restoredRooms) == 0 {
+		return false
+	}
+	if time.Since(s.startTime) > s.restoreGrace() {
+		clear(s.restored)
+		s.forgetRestoredRooms()
+		return false
+	}
+	prev, ok := s.restored[c.user]
+	if !ok {
+		return false
+	}
+	delete(s.restored, c.user)
+	room, spectator := c.room, c.spectator
+	c.setRoom(prev.Room)
+	c.spectator = prev.Spectator
+	if !s.canJoin(c) {
+		c.setRoom(room)
+		c.spectator = spectator
+		return false
+	}
+	return true
+}
+
+func (s *Server) restoreGrace() time.Duration {
+	if s.RestoreGrace > 0 {
+		return s.RestoreGrace
+	}
+	return DefaultRestoreGrace
+}
+
+// drops data of restored rooms nobody came back to, must be called from processingLoop only
+func (s *Server) forgetRestoredRooms() {
+	for room := range s.restoredRooms {
+		if s.clientHolder.GetRoomCount(room) == 0 {
+			delete(s.roomData, room)
+		}
+	}
+	clear(s.restoredRooms)
+}
@@ -0,0 +1,113 @@
+package mobster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		if name == "foo" {
+			ops.SetRole(room, name, RoleModerator)
+			ops.SetRoomPublic(room, "game")
+			ops.SetRoomPassword(room, "secret")
+			ops.Room(room).Data()["turn"] = "white"
+			ops.Session(name).Set("score", 7)
+		}
+	}
+	s.StartServer(4009)
+	connectAndSend(t, "a foo 123")
+
+	data, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.StopServer()
+
+	var room string
+	var role Role
+	var public []RoomListing
+	var turn, score any
+	restored := NewServer()
+	restored.OnConnect = func(ops *Ops, name, r string) {
+		room = r
+		role = ops.GetRole(r, name)
+		public = ops.GetPublicRooms()
+		turn = ops.Room(r).Data()["turn"]
+		score = ops.Session(name).Get("score")
+	}
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	restored.StartServer(4009)
+
+	// previous room password still applies
+	connectAndSend(t, "a foo other secret")
+	restored.StopServer()
+
+	if room != "123" || role != RoleModerator {
+		t.Errorf("client not restored, room %s, role %s", room, role)
+	}
+	if len(public) != 1 || public[0].Room != "123" {
+		t.Errorf("public rooms not restored: %v", public)
+	}
+	if turn != "white" {
+		t.Errorf("room data not restored: %v", turn)
+	}
+	// numbers come back as json decodes them
+	if score != float64(7) {
+		t.Errorf("session not restored: %v", score)
+	}
+}
+
+func TestSnapshot_notRunning(t *testing.T) {
+	s := NewServer()
+	if _, err := s.Snapshot(); err != ErrServerStopped {
+		t.Errorf("expected ErrServerStopped before start, got %v", err)
+	}
+	s.StartServer(4009)
+	s.StopServer()
+	if _, err := s.Snapshot(); err != ErrServerStopped {
+		t.Errorf("expected ErrServerStopped after stop, got %v", err)
+	}
+}
+
+func TestRestore_rejoinChecks(t *testing.T) {
+	data := []byte(`{"version": 1, "clients": [{"user": "foo", "room": "123"}, {"user": "bar", "room": "123"}],
+		"room_passwords": {"123": "secret"}, "room_data": {"123": {"turn": "white"}}}`)
+
+	rooms := map[string]string{}
+	s := NewServer()
+	s.RestoreGrace = 50 * time.Millisecond
+	s.OnConnect = func(ops *Ops, name, room string) {
+		rooms[name] = room
+	}
+	if err := s.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	s.StartServer(4009)
+
+	// without password user stays in room it asked for
+	connectAndSend(t, "a foo other")
+	time.Sleep(60 * time.Millisecond)
+	// restored membership expired
+	connectAndSend(t, "a bar other secret")
+	s.StopServer()
+
+	if rooms["foo"] != "other" {
+		t.Errorf("foo should not get into protected room without password, got %q", rooms["foo"])
+	}
+	if rooms["bar"] != "other" {
+		t.Errorf("bar should not be restored after grace, got %q", rooms["bar"])
+	}
+	if _, ok := s.roomData["123"]; ok {
+		t.Error("data of restored room nobody returned to should be forgotten after grace")
+	}
+}
+
+func TestRestore_badVersion(t *testing.T) {
+	if err := NewServer().Restore([]byte(`{"version": 99}`)); err == nil {
+		t.Error("expected error")
+	}
+}
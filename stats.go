@@ -0,0 +1,230 @@
+package mobster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// output format used by WriteStats
+type StatsFormat int
+
+const (
+	StatsText StatsFormat = iota
+	StatsJSON
+)
+
+type RoomStats struct {
+	Room        string  `json:"room"`
+	Clients     int     `json:"clients"`
+	Messages    uint64  `json:"messages"`
+	MessageRate float64 `json:"message_rate"` // messages per second since server start
+}
+
+type ServerStats struct {
+	Version     string        `json:"version,omitempty"`
+	Uptime      time.Duration `json:"uptime"`
+	Clients     int           `json:"clients"`
+	Messages    uint64        `json:"messages"`
+	MessageRate float64       `json:"message_rate"` // messages per second since server start
+	Goroutines  int           `json:"goroutines"`
+	HeapAlloc   uint64        `json:"heap_alloc"`
+	Sys         uint64        `json:"sys"`
+	NumGC       uint32        `json:"num_gc"`
+	Dropped     uint64        `json:"dropped"` // queued requests dropped due to OverflowDrop
+	// connections not authenticated yet, see MaxPendingHandshakes
+	PendingHandshakes  int    `json:"pending_handshakes"`
+	QueuedHandshakes   int    `json:"queued_handshakes"`
+	RejectedHandshakes uint64 `json:"rejected_handshakes"`
+	// traffic of all connections
+	IO    IOStats     `json:"io"`
+	Rooms []RoomStats `json:"rooms"`
+	// current number of clients per room
+	RoomSizes Histogram `json:"room_sizes"`
+	// messages per room in each minute since start
+	RoomMessagesPerMinute Histogram `json:"room_messages_per_minute"`
+	// number of recipients of each room broadcast since start
+	Fanout Histogram `json:"fanout"`
+}
+
+// current server stats, zero value when server is not running
+func (s *Server) Stats() ServerStats {
+	stats, _ := s.stats()
+	return stats
+}
+
+func (s *Server) stats() (ServerStats, error) {
+	reply := make(chan ServerStats, 1)
+	if err := toLoop(s, s.statsRequests, reply); err != nil {
+		return ServerStats{}, err
+	}
+	return <-reply, nil
+}
+
+// write current server stats to w in given format, ErrServerStopped when server is not running
+func (s *Server) WriteStats(w io.Writer, format StatsFormat) error {
+	stats, err := s.stats()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case StatsJSON:
+		return json.NewEncoder(w).Encode(stats)
+	case StatsText:
+		if stats.Version != "" {
+			if _, err := fmt.Fprintf(w, "version: %s, ", stats.Version); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "uptime: %s, connected clients: %d, messages: %d (%.2f/s), goroutines: %d, heap: %d bytes, sys: %d bytes, gc: %d, dropped: %d\n",
+			stats.Uptime, stats.Clients, stats.Messages, stats.MessageRate, stats.Goroutines, stats.HeapAlloc, stats.Sys, stats.NumGC, stats.Dropped)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "handshakes: %d pending, %d queued, %d rejected\n",
+			stats.PendingHandshakes, stats.QueuedHandshakes, stats.RejectedHandshakes)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "io: %d frames in, %d frames out, %d bytes in, %d bytes out, %d short reads, %d framing errors\n",
+			stats.IO.FramesIn, stats.IO.FramesOut, stats.IO.BytesIn, stats.IO.BytesOut, stats.IO.ShortReads, stats.IO.FramingErrors)
+		if err != nil {
+			return err
+		}
+		for _, r := range stats.Rooms {
+			_, err := fmt.Fprintf(w, "room %s: %d clients, %d messages (%.2f/s)\n", r.Room, r.Clients, r.Messages, r.MessageRate)
+			if err != nil {
+				return err
+			}
+		}
+		for _, h := range []struct {
+			name string
+			h    Histogram
+		}{{"room sizes", stats.RoomSizes}, {"room messages per minute", stats.RoomMessagesPerMinute}, {"fanout", stats.Fanout}} {
+			_, err := fmt.Fprintf(w, "%s: count %d, mean %.2f, p50 %g, p90 %g, p99 %g, max %g\n",
+				h.name, h.h.Count, h.h.Mean(), h.h.Quantile(0.5), h.h.Quantile(0.9), h.h.Quantile(0.99), h.h.Max)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown stats format %d", format)
+	}
+}
+
+// old name of WriteStats, kept for compatibility
+func (s *Server) DumpStatsTo(w io.Writer, format StatsFormat) error {
+	return s.WriteStats(w, format)
+}
+
+// log current server stats in text format
+func (s *Server) DumpStats() {
+	var buf bytes.Buffer
+	if err := s.WriteStats(&buf, StatsText); err != nil {
+		log.Printf("cannot dump stats: %s", err)
+		return
+	}
+	log.Print(buf.String())
+}
+
+// serve current server stats, as json with "format=json" query parameter and as text
+// otherwise, so that it can be mounted on existing debug mux
+func (s *Server) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := StatsText
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if r.URL.Query().Get("format") == "json" {
+			format = StatsJSON
+			w.Header().Set("Content-Type", "application/json")
+		}
+		var buf bytes.Buffer
+		if err := s.WriteStats(&buf, format); err != nil {
+			status := http.StatusInternalServerError
+			if err == ErrServerStopped {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Write(buf.Bytes())
+	})
+}
+
+// reports stats to OnStats until server stops
+func (s *Server) statsLoop() {
+	defer s.shutdownWaitGroup.Done()
+	ticker := time.NewTicker(s.StatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stopping:
+			return
+		}
+		reply := make(chan ServerStats)
+		select {
+		case s.statsRequests <- reply:
+		case <-s.stopping:
+			return
+		}
+		s.OnStats(<-reply)
+	}
+}
+
+// must be called from processingLoop only
+func (s *Server) collectStats() ServerStats {
+	uptime := time.Since(s.startTime)
+	rate := func(n uint64) float64 {
+		if uptime <= 0 {
+			return 0
+		}
+		return float64(n) / uptime.Seconds()
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := ServerStats{
+		Version:     s.Version,
+		Uptime:      uptime,
+		Clients:     s.clientHolder.Count(),
+		Messages:    s.messages,
+		MessageRate: rate(s.messages),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   mem.HeapAlloc,
+		Sys:         mem.Sys,
+		NumGC:       mem.NumGC,
+		Dropped:     s.dropped.Load(),
+		Rooms:       []RoomStats{},
+		RoomSizes:   newHistogram(sizeBounds),
+
+		PendingHandshakes:  int(s.handshakes.pending.Load()),
+		QueuedHandshakes:   int(s.handshakes.queued.Load()),
+		RejectedHandshakes: s.handshakes.rejected.Load(),
+		IO:                 s.io.stats(),
+	}
+	s.rollMinute(time.Now())
+	stats.RoomMessagesPerMinute = s.roomRates.clone()
+	stats.Fanout = s.fanouts.clone()
+
+	rooms := s.clientHolder.GetRooms()
+	sort.Strings(rooms)
+	for _, room := range rooms {
+		stats.Rooms = append(stats.Rooms, RoomStats{
+			Room:        room,
+			Clients:     s.clientHolder.GetRoomCount(room),
+			Messages:    s.roomMessages[room],
+			MessageRate: rate(s.roomMessages[room]),
+		})
+		stats.RoomSizes.Observe(float64(s.clientHolder.GetRoomCount(room)))
+	}
+
+	return stats
+}
@@ -0,0 +1,133 @@
+package mobster
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats_perRoom(t *testing.T) {
+	s := NewServer()
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 1")
+	connectAndSend(t, "a bar 1")
+	connectAndSend(t, "a baz 2")
+	send(t, c, "hello")
+
+	stats := s.Stats()
+	if stats.Clients != 3 {
+		t.Error("expected three clients")
+	}
+	if stats.Messages != 1 {
+		t.Error("expected one message")
+	}
+	if len(stats.Rooms) != 2 {
+		t.Fatal("expected two rooms")
+	}
+	if stats.Rooms[0].Room != "1" || stats.Rooms[0].Clients != 2 || stats.Rooms[0].Messages != 1 {
+		t.Error("wrong stats for room 1")
+	}
+	if stats.Rooms[1].Room != "2" || stats.Rooms[1].Clients != 1 || stats.Rooms[1].Messages != 0 {
+		t.Error("wrong stats for room 2")
+	}
+
+	s.StopServer()
+}
+
+func TestWriteStats_formats(t *testing.T) {
+	s := NewServer()
+	s.StartServer(4009)
+
+	connectAndSend(t, "a foo 1")
+
+	var buf bytes.Buffer
+	if err := s.WriteStats(&buf, StatsText); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(buf.String(), "room 1: 1 clients") {
+		t.Errorf("no room line in text stats: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := s.WriteStats(&buf, StatsJSON); err != nil {
+		t.Error(err)
+	}
+	var stats ServerStats
+	if err := json.Unmarshal(buf.Bytes(), &stats); err != nil {
+		t.Error(err)
+	}
+	if stats.Clients != 1 || len(stats.Rooms) != 1 {
+		t.Error("wrong json stats")
+	}
+
+	s.StopServer()
+}
+
+func TestStatsHandler(t *testing.T) {
+	s := NewServer()
+	s.StartServer(4009)
+	connectAndSend(t, "a foo 1")
+
+	rec := httptest.NewRecorder()
+	s.StatsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/stats?format=json", nil))
+	var stats ServerStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Error(err)
+	}
+	if stats.Clients != 1 {
+		t.Errorf("wrong json stats: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.StatsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/stats", nil))
+	if !strings.Contains(rec.Body.String(), "connected clients: 1") {
+		t.Errorf("wrong text stats: %s", rec.Body.String())
+	}
+
+	s.StopServer()
+}
+
+func TestStatsHandler_notRunning(t *testing.T) {
+	s := NewServer()
+	check := func(when string) {
+		rec := httptest.NewRecorder()
+		s.StatsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/stats", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected unavailable %s, got %d", when, rec.Code)
+		}
+		if stats := s.Stats(); stats.Clients != 0 || stats.Uptime != 0 {
+			t.Errorf("expected zero stats %s, got %+v", when, stats)
+		}
+	}
+	check("before start")
+	s.StartServer(4009)
+	s.StopServer()
+	check("after stop")
+}
+
+func TestOnStats(t *testing.T) {
+	reports := make(chan ServerStats, 10)
+	s := NewServer()
+	s.StatsInterval = 5 * time.Millisecond
+	s.OnStats = func(stats ServerStats) {
+		reports <- stats
+	}
+	s.StartServer(4009)
+	connectAndSend(t, "a foo 1")
+
+	deadline := time.After(time.Second)
+	for found := false; !found; {
+		select {
+		case stats := <-reports:
+			found = stats.Clients == 1
+		case <-deadline:
+			t.Fatal("no stats reported")
+		}
+	}
+	s.StopServer()
+}
@@ -0,0 +1,83 @@
+package mobster
+
+import "sync"
+
+// persists messages sent to users which are not connected,
+// called from processing loop so implementations should be fast
+type MessageStore interface {
+	// stores message for user
+	Save(user, message string) error
+	// returns stored messages of user in order they were saved and forgets them
+	LoadAndClear(user string) ([]string, error)
+}
+
+// default limit of messages kept per user by memory store
+const DefaultStoredMessages = 100
+
+// keeps messages in memory, oldest messages are dropped over the limit
+type MemoryMessageStore struct {
+	mu       sync.Mutex
+	limit    int
+	messages map[string][]string
+}
+
+// limit of messages per user, DefaultStoredMessages when zero
+func NewMemoryMessageStore(limit int) *MemoryMessageStore {
+	if limit <= 0 {
+		limit = DefaultStoredMessages
+	}
+	return &MemoryMessageStore{limit: limit, messages: make(map[string][]string)}
+}
+
+func (m *MemoryMessageStore) Save(user, message string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := m.messages[user]
+	if len(messages) >= m.limit {
+		messages = messages[1:]
+	}
+	m.messages[user] = append(messages, message)
+	return nil
+}
+
+func (m *MemoryMessageStore) LoadAndClear(user string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := m.messages[user]
+	delete(m.messages, user)
+	return messages, nil
+}
+
+// buffers message for recently disconnected user, passes it to other instances
+// or stores it for later delivery,
+// must be called from processingLoop only
+func (s *Server) sendToOffline(user, message string) {
+	if s.queuePending(user, message) {
+		return
+	}
+	if s.Backplane != nil {
+		s.backplanePublish("user", user, message)
+		return
+	}
+	if !s.StoreOffline {
+		return
+	}
+	if err := s.MessageStore.Save(user, message); err != nil {
+		s.OnError(user, "store", err)
+	}
+}
+
+// delivers stored messages to client, must be called from processingLoop only
+func (s *Server) flushStored(c *Client) {
+	if !s.StoreOffline {
+		return
+	}
+	messages, err := s.MessageStore.LoadAndClear(c.user)
+	if err != nil {
+		s.OnError(c.user, "store", err)
+		return
+	}
+	for _, message := range messages {
+		s.write(c, message)
+	}
+}
@@ -0,0 +1,36 @@
+package mobster
+
+import "testing"
+
+func TestMemoryMessageStore(t *testing.T) {
+	m := NewMemoryMessageStore(2)
+	m.Save("foo", "1")
+	m.Save("foo", "2")
+	m.Save("foo", "3")
+	m.Save("bar", "4")
+
+	messages, _ := m.LoadAndClear("foo")
+	if len(messages) != 2 || messages[0] != "2" || messages[1] != "3" {
+		t.Errorf("expected two latest messages, got %v", messages)
+	}
+	messages, _ = m.LoadAndClear("foo")
+	if len(messages) != 0 {
+		t.Error("messages should be cleared")
+	}
+}
+
+func TestFlow_offlineMessages(t *testing.T) {
+	s := NewServer()
+	s.StoreOffline = true
+	s.StartServer(4009)
+
+	s.SendTo("foo", "while you were away")
+	sleep()
+
+	c := connectAndSend(t, "a foo 123")
+	if r := readFromServer(t, c); r != "while you were away" {
+		t.Errorf("expected stored message, got %q", r)
+	}
+
+	s.StopServer()
+}
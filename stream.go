@@ -0,0 +1,163 @@
+package mobster
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// message oriented bidirectional stream, e.g. grpc one, where generated
+// Send(*Msg) and Recv() (*Msg, error) are wrapped to pass message payloads
+type MessageStream interface {
+	Send(message []byte) error
+	Recv() ([]byte, error)
+}
+
+// serves client talking over message stream, so that grpc services can bridge their
+// streams into rooms; every received message is one client message, like with packets
+// on tcp, so text framed messages should not exceed 512 bytes. Blocks until client
+// is disconnected, as grpc stream handler has to, then stream should be finished
+// by returning from handler. Server has to be running.
+func (s *Server) ServeStream(stream MessageStream, remote net.Addr) {
+	s.serveStream(stream, remote, "stream")
+}
+
+// network is reported as client transport
+func (s *Server) serveStream(stream MessageStream, remote net.Addr, network string) {
+	if remote == nil {
+		remote = streamAddr{network, "unknown"}
+	}
+	conn := &streamConn{stream: stream, remote: remote, local: streamAddr{network, "mobster"}, framing: s.Framing,
+		done: make(chan struct{}), received: make(chan streamMessage, 1)}
+	s.ServeConn(conn)
+	<-conn.done
+}
+
+var errStreamClosed = errors.New("stream closed")
+
+type streamConn struct {
+	stream  MessageStream
+	remote  net.Addr
+	local   net.Addr
+	framing Framing
+	pending []byte // rest of received message not read yet
+
+	closeOnce sync.Once
+	done      chan struct{}
+
+	// Recv runs in background, so that Read returns when stream is closed
+	receiving bool
+	received  chan streamMessage
+	// read deadline closes the stream, Recv cannot be interrupted otherwise
+	deadlineMu sync.Mutex
+	deadline   *time.Timer
+	expired    atomic.Bool
+}
+
+type streamMessage struct {
+	message []byte
+	err     error
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	if len(c.pending) == 0 {
+		if !c.receiving {
+			c.receiving = true
+			go func() {
+				message, err := c.stream.Recv()
+				c.received <- streamMessage{message, err}
+			}()
+		}
+		var r streamMessage
+		select {
+		case r = <-c.received:
+			c.receiving = false
+		case <-c.done:
+			if c.expired.Load() {
+				return 0, os.ErrDeadlineExceeded
+			}
+			return 0, errStreamClosed
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		if c.framing == FramingLengthPrefixed {
+			c.pending = binary.BigEndian.AppendUint32(nil, uint32(len(r.message)))
+		}
+		c.pending = append(c.pending, r.message...)
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// sends every message of written data separately
+func (c *streamConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, errStreamClosed
+	default:
+	}
+	if c.framing != FramingLengthPrefixed {
+		return len(b), c.stream.Send(b)
+	}
+	for data := b; len(data) > 0; {
+		if len(data) < frameHeaderSize {
+			return 0, io.ErrShortWrite
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		data = data[frameHeaderSize:]
+		if len(data) < size {
+			return 0, io.ErrShortWrite
+		}
+		if err := c.stream.Send(data[:size]); err != nil {
+			return 0, err
+		}
+		data = data[size:]
+	}
+	return len(b), nil
+}
+
+func (c *streamConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+func (c *streamConn) LocalAddr() net.Addr  { return c.local }
+func (c *streamConn) RemoteAddr() net.Addr { return c.remote }
+
+// Send cannot be interrupted, so only read deadline is enforced
+func (c *streamConn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+// stream is closed when deadline passes, unlike net.Conn it cannot be extended then
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	if c.deadline != nil {
+		c.deadline.Stop()
+		c.deadline = nil
+	}
+	if t.IsZero() {
+		return nil
+	}
+	c.deadline = time.AfterFunc(time.Until(t), func() {
+		c.expired.Store(true)
+		c.Close()
+	})
+	return nil
+}
+
+func (c *streamConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type streamAddr struct {
+	network string
+	addr    string
+}
+
+func (a streamAddr) Network() string { return a.network }
+func (a streamAddr) String() string  { return a.addr }
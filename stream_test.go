@@ -0,0 +1,113 @@
+package mobster
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+type chanStream struct {
+	in  chan []byte
+	out chan []byte
+}
+
+func (s *chanStream) Send(message []byte) error {
+	s.out <- append([]byte(nil), message...)
+	return nil
+}
+
+func (s *chanStream) Recv() ([]byte, error) {
+	message, ok := <-s.in
+	if !ok {
+		return nil, io.EOF
+	}
+	return message, nil
+}
+
+func TestServeStream(t *testing.T) {
+	for _, framing := range []Framing{FramingText, FramingLengthPrefixed} {
+		s := NewServer()
+		s.Framing = framing
+		s.DisableAudit = true
+		var transport string
+		s.OnConnect = func(ops *Ops, name, room string) {
+			info, _ := ops.GetClientInfo(name)
+			transport = info.Transport
+		}
+		s.OnMessage = func(ops *Ops, name, room, message string) {
+			if message == "bye" {
+				ops.Disconnect(name)
+				return
+			}
+			ops.SendToRoom(room, "echo "+message)
+		}
+		s.StartServer(4009)
+
+		stream := &chanStream{in: make(chan []byte, 10), out: make(chan []byte, 10)}
+		done := make(chan bool)
+		go func() {
+			s.ServeStream(stream, nil)
+			done <- true
+		}()
+
+		stream.in <- []byte("a foo 123")
+		stream.in <- []byte("hello")
+		select {
+		case msg := <-stream.out:
+			if string(msg) != "echo hello" {
+				t.Errorf("framing %d: unexpected message %q", framing, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("framing %d: no message sent to stream", framing)
+		}
+
+		stream.in <- []byte("bye")
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("framing %d: stream not finished after disconnect", framing)
+		}
+		// grpc ends the stream when handler returns
+		close(stream.in)
+		s.StopServer()
+
+		if transport != "stream" {
+			t.Errorf("framing %d: wrong transport %q", framing, transport)
+		}
+	}
+}
+
+func TestServeStream_handshakeTimeout(t *testing.T) {
+	s := NewServer()
+	s.DisableAudit = true
+	s.HandshakeTimeout = 50 * time.Millisecond
+	s.MaxPendingHandshakes = 1
+	var op string
+	s.OnError = func(user, o string, err error) {
+		op = o
+	}
+	s.StartServer(4009)
+
+	// stream which never sends auth packet
+	stream := &chanStream{in: make(chan []byte), out: make(chan []byte, 10)}
+	done := make(chan bool)
+	go func() {
+		s.ServeStream(stream, nil)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream without auth not closed after handshake timeout")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if pending := s.Stats().PendingHandshakes; pending != 0 {
+		t.Errorf("handshake slot not released, %d pending", pending)
+	}
+	close(stream.in)
+	s.StopServer()
+
+	if op != "auth" {
+		t.Errorf("expected auth error, got %q", op)
+	}
+}
@@ -0,0 +1,37 @@
+package mobster
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// applies tcp options from server config, connections of other transports are left untouched
+func (s *Server) tuneTCP(conn net.Conn) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	var errs []error
+	if s.TCPKeepAlive < 0 {
+		errs = append(errs, tcp.SetKeepAlive(false))
+	} else if s.TCPKeepAlive > 0 {
+		errs = append(errs, tcp.SetKeepAlive(true), tcp.SetKeepAlivePeriod(s.TCPKeepAlive))
+	}
+	if s.TCPDelay {
+		errs = append(errs, tcp.SetNoDelay(false))
+	}
+	if s.TCPReadBuffer > 0 {
+		errs = append(errs, tcp.SetReadBuffer(s.TCPReadBuffer))
+	}
+	if s.TCPWriteBuffer > 0 {
+		errs = append(errs, tcp.SetWriteBuffer(s.TCPWriteBuffer))
+	}
+	for _, err := range errs {
+		if err != nil {
+			s.OnError("", "tcp", err)
+		}
+	}
+}
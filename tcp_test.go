@@ -0,0 +1,41 @@
+package mobster
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTuneTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := NewServer()
+	s.TCPKeepAlive = 30 * time.Second
+	s.TCPDelay = true
+	s.TCPReadBuffer = 64 * 1024
+	s.TCPWriteBuffer = 64 * 1024
+	s.OnError = func(user, op string, err error) {
+		t.Error(op, err)
+	}
+	s.tuneTCP(conn)
+
+	s.TCPKeepAlive = -1
+	s.tuneTCP(conn)
+
+	// other transports are ignored
+	s.tuneTCP(&readerConn{})
+}
@@ -0,0 +1,163 @@
+package mobster
+
+import (
+	"errors"
+	"time"
+)
+
+// default of ShapingQueueSize
+const DefaultShapingQueueSize = 256 * 1024
+
+// ErrThrottled is reported to OnError with "throttle" op when writes waiting for bandwidth
+// of client exceed ShapingQueueSize and oldest of them are dropped
+var ErrThrottled = errors.New("client over bandwidth, writes dropped")
+
+// token bucket of client bandwidth with writes waiting for it, bursts of one second
+// worth of bytes are let through at once
+type shaper struct {
+	rate   int // bytes per second, unlimited when zero
+	tokens float64
+	last   time.Time
+	queue  []shapedWrite
+	queued int // bytes in queue
+	timer  *time.Timer
+}
+
+type shapedWrite struct {
+	data     []byte
+	messages []string
+}
+
+func newShaper(rate int, now time.Time) *shaper {
+	return &shaper{rate: rate, tokens: float64(rate), last: now}
+}
+
+func (sh *shaper) refill(now time.Time) {
+	sh.tokens = min(float64(sh.rate), sh.tokens+now.Sub(sh.last).Seconds()*float64(sh.rate))
+	sh.last = now
+}
+
+// takes bandwidth for write of n bytes, writes bigger than burst pass once bucket is full
+func (sh *shaper) take(n int) bool {
+	if sh.rate <= 0 {
+		return true
+	}
+	if sh.tokens < float64(n) && sh.tokens < float64(sh.rate) {
+		return false
+	}
+	sh.tokens -= float64(n)
+	return true
+}
+
+// time until write of n bytes may pass
+func (sh *shaper) wait(n int) time.Duration {
+	missing := min(float64(n), float64(sh.rate)) - sh.tokens
+	return max(time.Millisecond, time.Duration(missing/float64(sh.rate)*float64(time.Second)))
+}
+
+// shaper of client, nil when its writes are not throttled, must be called from processingLoop only
+func (s *Server) shaperOf(c *Client) *shaper {
+	if c.shaper == nil && s.ClientBandwidth > 0 && c.bot == nil {
+		c.shaper = newShaper(s.ClientBandwidth, time.Now())
+	}
+	return c.shaper
+}
+
+// writes data right away when client has bandwidth for it, queues it otherwise; false
+// when data has to be written by caller, must be called from processingLoop only
+func (s *Server) shape(c *Client, data []byte, messages []string) bool {
+	sh := s.shaperOf(c)
+	if sh == nil || (sh.rate <= 0 && len(sh.queue) == 0) {
+		return false
+	}
+	now := time.Now()
+	sh.refill(now)
+	if len(sh.queue) == 0 && sh.take(len(data)) {
+		return false
+	}
+	limit := s.ShapingQueueSize
+	if limit <= 0 {
+		limit = DefaultShapingQueueSize
+	}
+	dropped := false
+	for len(sh.queue) > 0 && sh.queued+len(data) > limit {
+		sh.queued -= len(sh.queue[0].data)
+		sh.queue = sh.queue[1:]
+		dropped = true
+	}
+	if dropped {
+		s.OnError(c.user, "throttle", ErrThrottled)
+	}
+	// data may come from shared write buffer
+	sh.queue = append(sh.queue, shapedWrite{data: append([]byte(nil), data...), messages: messages})
+	sh.queued += len(data)
+	s.armShaper(c, sh)
+	return true
+}
+
+// charges bandwidth of write which skipped the queue, bulk writes wait for it then;
+// must be called from processingLoop only
+func (s *Server) chargeShaper(c *Client, n int) {
+	if sh := s.shaperOf(c); sh != nil && sh.rate > 0 {
+		sh.refill(time.Now())
+		sh.tokens -= float64(n)
+	}
+}
+
+func (s *Server) armShaper(c *Client, sh *shaper) {
+	if sh.timer != nil || len(sh.queue) == 0 {
+		return
+	}
+	wait := time.Duration(0)
+	if sh.rate > 0 {
+		wait = sh.wait(len(sh.queue[0].data))
+	}
+	sh.timer = time.AfterFunc(wait, func() {
+		select {
+		case s.shaped <- c:
+		case <-s.stopping:
+		}
+	})
+}
+
+// writes queued data client has bandwidth for, must be called from processingLoop only
+func (s *Server) drainShaper(c *Client) {
+	sh := c.shaper
+	if sh == nil || !s.clientHolder.Has(c) {
+		return
+	}
+	sh.timer = nil
+	sh.refill(time.Now())
+	for len(sh.queue) > 0 && sh.take(len(sh.queue[0].data)) {
+		w := sh.queue[0]
+		sh.queue = sh.queue[1:]
+		sh.queued -= len(w.data)
+		if s.writeNow(c, w.data, w.messages...) != nil {
+			return
+		}
+	}
+	s.armShaper(c, sh)
+}
+
+// limits bytes per second written to each connection of user, overriding ClientBandwidth;
+// unlimited when zero
+func (o *Ops) SetBandwidth(user string, bytesPerSecond int) {
+	now := time.Now()
+	for _, c := range o.server.clientHolder.GetAllByName(user) {
+		if c.bot != nil {
+			continue
+		}
+		if c.shaper == nil {
+			c.shaper = newShaper(bytesPerSecond, now)
+			continue
+		}
+		c.shaper.refill(now)
+		c.shaper.rate = bytesPerSecond
+		c.shaper.tokens = min(c.shaper.tokens, float64(bytesPerSecond))
+		if c.shaper.timer != nil {
+			c.shaper.timer.Stop()
+			c.shaper.timer = nil
+		}
+		o.server.armShaper(c, c.shaper)
+	}
+}
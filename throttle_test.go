@@ -0,0 +1,102 @@
+package mobster
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShaper(t *testing.T) {
+	now := time.Now()
+	sh := newShaper(1000, now)
+	if !sh.take(600) || sh.take(600) {
+		t.Error("burst of one second should pass, more should wait")
+	}
+	if wait := sh.wait(600); wait < 150*time.Millisecond || wait > 250*time.Millisecond {
+		t.Errorf("unexpected wait %s", wait)
+	}
+	sh.refill(now.Add(time.Second))
+	if sh.tokens != 1000 {
+		t.Errorf("bucket should not hold more than burst, got %g", sh.tokens)
+	}
+	if !sh.take(5000) {
+		t.Error("write bigger than burst should pass with full bucket")
+	}
+	if !(&shaper{}).take(1 << 20) {
+		t.Error("zero rate should not throttle")
+	}
+}
+
+// reads from connection until it stays quiet for given time
+func readFor(conn net.Conn, quiet time.Duration) string {
+	var b strings.Builder
+	buf := make([]byte, 4096)
+	for {
+		conn.SetReadDeadline(time.Now().Add(quiet))
+		n, err := conn.Read(buf)
+		b.Write(buf[:n])
+		if err != nil {
+			return b.String()
+		}
+	}
+}
+
+func TestFlow_clientBandwidth(t *testing.T) {
+	s := NewServer()
+	s.ClientBandwidth = 1000
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		for range 3 {
+			ops.SendTo(user, strings.Repeat("x", 400))
+		}
+	}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo 123", "go")
+
+	start := time.Now()
+	first := readFor(c, 50*time.Millisecond)
+	rest := readFor(c, 500*time.Millisecond)
+	elapsed := time.Since(start)
+	s.StopServer()
+
+	if len(first) != 800 {
+		t.Errorf("burst should pass right away, got %d bytes", len(first))
+	}
+	if len(rest) != 400 || elapsed < 150*time.Millisecond {
+		t.Errorf("rest should be delayed, got %d bytes after %s", len(rest), elapsed)
+	}
+}
+
+func TestFlow_clientBandwidthDropsOldest(t *testing.T) {
+	var errs []error
+	s := NewServer()
+	s.ClientBandwidth = 100
+	s.ShapingQueueSize = 250
+	s.OnConnect = func(ops *Ops, user, room string) {}
+	s.OnError = func(user, op string, err error) {
+		if op == "throttle" {
+			errs = append(errs, err)
+		}
+	}
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		for i := range 6 {
+			ops.SendTo(user, strings.Repeat(string(rune('a'+i)), 100))
+		}
+		// lifts limit, so that queue is flushed right away
+		ops.SetBandwidth(user, 0)
+	}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo 123", "go")
+
+	got := readFor(c, 50*time.Millisecond)
+	s.StopServer()
+
+	if want := strings.Repeat("a", 100) + strings.Repeat("e", 100) + strings.Repeat("f", 100); got != want {
+		t.Errorf("oldest queued writes should be dropped, got %q", got)
+	}
+	if len(errs) == 0 || !errors.Is(errs[0], ErrThrottled) {
+		t.Errorf("drops should be reported, got %v", errs)
+	}
+}
@@ -0,0 +1,62 @@
+package mobster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// returns OnCertAuth function using certificate subject common name as username,
+// all clients land in given room
+func CertCommonNameAuth(room string) func(cert *x509.Certificate) (username, room string, err error) {
+	return func(cert *x509.Certificate) (string, string, error) {
+		if cert.Subject.CommonName == "" {
+			return "", "", errors.New("no common name in client certificate")
+		}
+		return cert.Subject.CommonName, room, nil
+	}
+}
+
+// returns verified client certificate of tls connection, nil if there is none
+func peerCertificate(conn net.Conn) (*x509.Certificate, error) {
+	tlsConn, ok := unwrapRecorded(conn).(*tls.Conn)
+	if !ok {
+		return nil, nil
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 {
+		return nil, nil
+	}
+	return state.VerifiedChains[0][0], nil
+}
+
+// authenticates client either by its certificate or by auth packet,
+// returned auth packet is empty for certificate auth
+func (s *Server) authenticate(conn net.Conn, reader *frameReader) (username, room, req string, err error) {
+	if s.OnCertAuth != nil {
+		cert, err := peerCertificate(conn)
+		if err != nil {
+			return "", "", "", fmt.Errorf("tls handshake failed: %s", err)
+		}
+		if cert != nil {
+			username, room, err = s.OnCertAuth(cert)
+			return username, room, "", err
+		}
+	}
+
+	req, err = reader.readAuth()
+	if err != nil {
+		return "", "", "", fmt.Errorf("cannot read auth packet: %s", err)
+	}
+	if s.GuestAuth && isGuestPacket(req) {
+		username, room, err = s.guestAuth(req)
+		return username, room, req, err
+	}
+	username, room, err = s.OnAuth(req)
+	return username, room, req, err
+}
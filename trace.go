@@ -0,0 +1,79 @@
+package mobster
+
+import (
+	"context"
+	"strconv"
+)
+
+// tracing backend, e.g. thin adapter over OpenTelemetry tracer; attributes are
+// "mobster.user", "mobster.room" and "mobster.recipients"
+type Tracer interface {
+	// starts span as a child of span in ctx, returned context carries the new span
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+}
+
+type Span interface {
+	SetError(err error)
+	End()
+}
+
+// returns context of message being handled, carrying its span when Tracer is set;
+// it is cancelled when sender connection is lost or closed, or after MessageTimeout,
+// so that calls done on behalf of gone clients can stop; background context outside
+// of message handlers
+func (o *Ops) Context() context.Context {
+	if o.server.handlerCtx != nil {
+		return o.server.handlerCtx
+	}
+	return context.Background()
+}
+
+// starts span of message read from client, called from connection goroutines
+func (s *Server) traceRead(r *Request) {
+	if s.Tracer == nil {
+		return
+	}
+	r.ctx, r.span = s.Tracer.Start(context.Background(), "mobster.message", map[string]string{
+		"mobster.user": r.client.currentUser(),
+		"mobster.room": r.client.currentRoom(),
+	})
+}
+
+// handles request within span of its handler, must be called from processingLoop only
+func (s *Server) traceRequest(ops *Ops, r Request) {
+	if r.span == nil {
+		s.handleInContext(ops, r, context.Background())
+		return
+	}
+	ctx, span := s.Tracer.Start(r.ctx, "mobster.handle", map[string]string{
+		"mobster.user": r.client.currentUser(),
+		"mobster.room": r.client.room,
+	})
+	defer func() {
+		span.End()
+		r.span.End()
+	}()
+	s.handleInContext(ops, r, ctx)
+}
+
+// starts span of write done by handler, returned function ends it,
+// must be called from processingLoop only
+func (s *Server) traceWrite(name, user, room string, recipients int) func(err error) {
+	if s.handlerCtx == nil || s.Tracer == nil {
+		return func(error) {}
+	}
+	attrs := map[string]string{"mobster.recipients": strconv.Itoa(recipients)}
+	if user != "" {
+		attrs["mobster.user"] = user
+	}
+	if room != "" {
+		attrs["mobster.room"] = room
+	}
+	_, span := s.Tracer.Start(s.handlerCtx, name, attrs)
+	return func(err error) {
+		if err != nil {
+			span.SetError(err)
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,127 @@
+package mobster
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]string
+	ended  bool
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordedSpan{name: name, attrs: attrs}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), &recordingSpan{t, span}
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	span   *recordedSpan
+}
+
+func (s *recordingSpan) SetError(err error) {}
+
+func (s *recordingSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.ended = true
+}
+
+func TestFlow_tracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	s := NewServer()
+	s.Tracer = tracer
+	var handlerSpan string
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		if span, ok := ops.Context().Value(spanKey{}).(*recordedSpan); ok {
+			handlerSpan = span.name
+		}
+		ops.SendToRoom(room, message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123", "hello")
+	readFromServer(t, c)
+	s.StopServer()
+
+	if handlerSpan != "mobster.handle" {
+		t.Errorf("handler context should carry handler span, got %q", handlerSpan)
+	}
+	var names []string
+	for _, span := range tracer.spans {
+		names = append(names, span.name+"<"+span.parent)
+		if !span.ended {
+			t.Errorf("span %s not ended", span.name)
+		}
+	}
+	expected := []string{"mobster.message<", "mobster.handle<mobster.message", "mobster.broadcast<mobster.handle"}
+	if len(names) != len(expected) {
+		t.Fatalf("unexpected spans %v", names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("unexpected spans %v", names)
+		}
+	}
+	if room := tracer.spans[0].attrs["mobster.room"]; room != "123" {
+		t.Errorf("message span should have room attribute, got %q", room)
+	}
+	if n := tracer.spans[2].attrs["mobster.recipients"]; n != "1" {
+		t.Errorf("broadcast span should have recipients attribute, got %q", n)
+	}
+}
+
+func TestFlow_tracingAfterMove(t *testing.T) {
+	tracer := &recordingTracer{}
+	s := NewServer()
+	s.Tracer = tracer
+	s.OnMessage = func(ops *Ops, user, room, message string) {
+		if message == "move" {
+			ops.MoveToRoom(user, "456")
+		}
+		ops.SendTo(user, message)
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123", "move")
+	readFromServer(t, c)
+	send(t, c, "hello")
+	readFromServer(t, c)
+	s.StopServer()
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	var rooms []string
+	for _, span := range tracer.spans {
+		if span.name == "mobster.message" {
+			rooms = append(rooms, span.attrs["mobster.room"])
+		}
+	}
+	if len(rooms) != 2 || rooms[0] != "123" || rooms[1] != "456" {
+		t.Errorf("message spans should have room of client when read, got %v", rooms)
+	}
+}
+
+func TestOpsContext_outsideHandler(t *testing.T) {
+	s := NewServer()
+	if (&Ops{s}).Context() == nil {
+		t.Error("context should never be nil")
+	}
+}
@@ -0,0 +1,59 @@
+package mobster
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// marshals typed messages, see RegisterMessage
+type Encoding interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// default encoding of typed messages
+type JSONEncoding struct{}
+
+func (JSONEncoding) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (JSONEncoding) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// registers handler for typed messages sent as "<name> <encoded message>", message is
+// decoded with server Encoding before handler is called; has to be called before server starts
+func RegisterMessage[T any](s *Server, name string, handler func(ops *Ops, user, room string, msg T)) {
+	s.Handle(name, func(ops *Ops, user, room, args string) {
+		var msg T
+		if err := s.Encoding.Unmarshal([]byte(args), &msg); err != nil {
+			s.OnError(user, "decode", fmt.Errorf("cannot decode %s message: %s", name, err))
+			return
+		}
+		handler(ops, user, room, msg)
+	})
+}
+
+// encodes typed message as "<name> <encoded message>"
+func (s *Server) encodeMessage(name string, v any) (string, error) {
+	data, err := s.Encoding.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return name + " " + string(data), nil
+}
+
+// send typed message to given user, symmetric to RegisterMessage
+func (o *Ops) SendMessage(user, name string, v any) error {
+	message, err := o.server.encodeMessage(name, v)
+	if err != nil {
+		return err
+	}
+	return o.SendToWithResult(user, message)
+}
+
+// send typed message to all users in given room, symmetric to RegisterMessage
+func (o *Ops) SendMessageToRoom(room, name string, v any) error {
+	message, err := o.server.encodeMessage(name, v)
+	if err != nil {
+		return err
+	}
+	o.SendToRoom(room, message)
+	return nil
+}
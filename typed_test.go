@@ -0,0 +1,34 @@
+package mobster
+
+import "testing"
+
+type moveMsg struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func TestFlow_typedMessages(t *testing.T) {
+	var errs []string
+	s := NewServer()
+	s.OnError = func(user, op string, err error) {
+		errs = append(errs, op)
+	}
+	RegisterMessage(s, "move", func(ops *Ops, name, room string, msg moveMsg) {
+		ops.SendMessage(name, "moved", moveMsg{From: msg.To, To: msg.From})
+	})
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	send(t, c, `move {"from": "e2", "to": "e4"}`)
+
+	if r := readFromServer(t, c); r != `moved {"from":"e4","to":"e2"}` {
+		t.Errorf("unexpected typed reply: %q", r)
+	}
+
+	send(t, c, `move {"from": `)
+	if len(errs) != 1 || errs[0] != "decode" {
+		t.Errorf("expected decode error, got %v", errs)
+	}
+
+	s.StopServer()
+}
@@ -0,0 +1,83 @@
+package mobster
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// env variable telling process started by Upgrade which fd holds inherited listener
+const listenerFDEnv = "MOBSTER_LISTENER_FD"
+
+// returns listener passed by parent process with Upgrade, nil if there is none
+func InheritedListener() (net.Listener, error) {
+	value := os.Getenv(listenerFDEnv)
+	if value == "" {
+		return nil, nil
+	}
+	os.Unsetenv(listenerFDEnv)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("bad %s: %w", listenerFDEnv, err)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// like StartServerOn, but serves listener inherited from parent process if there is one
+func (s *Server) StartServerInheriting(network, address string) error {
+	listener, err := InheritedListener()
+	if err != nil {
+		return err
+	}
+	if listener == nil {
+		return s.StartServerOn(network, address)
+	}
+	log.Printf("inherited listener")
+	s.ServeListener(listener)
+	return nil
+}
+
+// starts new process of given binary passing it server listener, so that it can take over
+// with StartServerInheriting without refusing connections for a moment; this server stops
+// accepting, but keeps serving clients connected already until StopServer is called.
+// Works with tcp and unix listeners only.
+func (s *Server) Upgrade(binary string, args ...string) (*os.Process, error) {
+	filer, ok := s.listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errors.New("listener cannot be handed over")
+	}
+	f, err := filer.File()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{f}
+	// extra files start right after stdin, stdout and stderr
+	cmd.Env = append(os.Environ(), listenerFDEnv+"=3")
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	log.Printf("listener handed over to process %d", cmd.Process.Pid)
+	s.stopAccepting()
+	return cmd.Process, nil
+}
+
+// closes listener keeping current clients connected
+func (s *Server) stopAccepting() {
+	s.acceptStopped.Store(true)
+	// socket file is still used by process which took the listener over
+	if ul, ok := s.listener.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	s.listener.Close()
+}
@@ -0,0 +1,74 @@
+//go:build unix
+
+package mobster
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestInheritedListener(t *testing.T) {
+	if l, err := InheritedListener(); l != nil || err != nil {
+		t.Fatal("nothing should be inherited", l, err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// inherited fd is owned and closed by InheritedListener
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(listenerFDEnv, strconv.Itoa(fd))
+
+	inherited, err := InheritedListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	if inherited.Addr().String() != l.Addr().String() {
+		t.Error("wrong listener inherited:", inherited.Addr())
+	}
+	if os.Getenv(listenerFDEnv) != "" {
+		t.Error("env should be cleared")
+	}
+}
+
+func TestUpgrade_keepsClients(t *testing.T) {
+	var connected, messages []string
+	s := NewServer()
+	s.OnConnect = func(ops *Ops, name, room string) {
+		connected = append(connected, name)
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		messages = append(messages, message)
+	}
+	s.StartServer(4009)
+	c := connectAndSend(t, "a foo 123")
+
+	// test binary exits right away when started with inherited listener, see TestMain
+	p, err := s.Upgrade(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+
+	send(t, c, "still here")
+	sleep()
+	s.StopServer()
+
+	if len(connected) != 1 || len(messages) != 1 {
+		t.Errorf("existing client should be served, got %v %v", connected, messages)
+	}
+}
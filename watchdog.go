@@ -0,0 +1,40 @@
+package mobster
+
+import (
+	"log"
+	"runtime"
+	"time"
+)
+
+// max size of stack dump passed to OnSlowHandler
+const maxStackDump = 1 << 20
+
+// starts timer reporting handler of client that does not return within HandlerTimeout,
+// nil when disabled; must be called from processingLoop only
+func (s *Server) startWatchdog(c *Client) *time.Timer {
+	if s.HandlerTimeout <= 0 {
+		return nil
+	}
+	start := time.Now()
+	// handler may rename or move client meanwhile, timer must not read it
+	user, room, conn := c.user, c.room, c.conn
+	return time.AfterFunc(s.HandlerTimeout, func() {
+		buf := make([]byte, maxStackDump)
+		stack := buf[:runtime.Stack(buf, true)]
+		s.OnSlowHandler(user, room, time.Since(start), stack)
+		if s.DisconnectSlowClients {
+			// safe outside of processing loop, client is removed once read fails
+			conn.Close()
+		}
+	})
+}
+
+func stopWatchdog(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+func logSlowHandler(user, room string, elapsed time.Duration, stack []byte) {
+	log.Printf("warn: %s: handler for %s still running after %s\n%s", room, user, elapsed, stack)
+}
@@ -0,0 +1,47 @@
+package mobster
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlow_slowHandler(t *testing.T) {
+	slow := make(chan string, 1)
+	disconnected := false
+	s := NewServer()
+	s.HandlerTimeout = 5 * time.Millisecond
+	s.DisconnectSlowClients = true
+	s.OnSlowHandler = func(user, room string, elapsed time.Duration, stack []byte) {
+		if strings.Contains(string(stack), "processingLoop") {
+			slow <- user
+		}
+	}
+	s.OnMessage = func(ops *Ops, name, room, message string) {
+		if message == "slow" {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	s.OnDisconnect = func(ops *Ops, name, room string) {
+		disconnected = true
+	}
+	s.StartServer(4009)
+
+	c := connectAndSend(t, "a foo 123")
+	send(t, c, "fast", "slow")
+	time.Sleep(30 * time.Millisecond)
+
+	select {
+	case user := <-slow:
+		if user != "foo" {
+			t.Errorf("wrong user reported: %s", user)
+		}
+	default:
+		t.Error("slow handler not reported")
+	}
+	if !disconnected {
+		t.Error("slow client should be disconnected")
+	}
+
+	s.StopServer()
+}